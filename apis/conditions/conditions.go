@@ -12,6 +12,16 @@ const (
 	ReasonReady                  = "Available"
 	ReasonNotReady               = "NotAvailable"
 	ReasonProgressing            = "ProgressingResource"
+	ReasonReconcileSuccess       = "ReconcileSuccess"
+	ReasonReconcileError         = "ReconcileError"
+	ReasonBackupDisabled         = "BackupDisabled"
+	ReasonDriftDetected          = "DriftDetected"
+	ReasonDriftReverted          = "DriftReverted"
+	ReasonNoDrift                = "NoDrift"
+	ReasonHibernated             = "Hibernated"
+	ReasonResuming               = "Resuming"
+	ReasonResumed                = "Resumed"
+	ReasonPaused                 = "ReconciliationPaused"
 )
 
 const (
@@ -21,6 +31,24 @@ const (
 	TypeReady = "Ready"
 	// TypeProgressing indicates that an instance is being updated.
 	TypeProgressing = "Progressing"
+	// TypeSynced indicates whether the last reconciliation of an instance has been successful.
+	TypeSynced = "Synced"
+	// TypeNamespaceReady indicates whether the deployment namespace of an instance exists.
+	TypeNamespaceReady = "NamespaceReady"
+	// TypeStorageReady indicates whether the persistent storage of an instance exists.
+	TypeStorageReady = "StorageReady"
+	// TypeReleaseReady indicates whether the deployment of an instance has become ready.
+	TypeReleaseReady = "ReleaseReady"
+	// TypeBackupConfigured indicates whether backups are configured for an instance.
+	TypeBackupConfigured = "BackupConfigured"
+	// TypeConnectionSecretReady indicates whether the connection secret of an instance has been written.
+	TypeConnectionSecretReady = "ConnectionSecretReady"
+	// TypeDrifted indicates that the deployment of an instance has been changed by someone else than the operator.
+	TypeDrifted = "Drifted"
+	// TypeHibernated indicates that PostgreSQL of an instance is stopped, or hasn't been started again yet after resuming.
+	TypeHibernated = "Hibernated"
+	// TypePaused indicates that the reconciliation of an instance is paused.
+	TypePaused = "Paused"
 )
 
 // Ready creates a condition with TypeReady, ReasonReady and empty message.
@@ -84,3 +112,129 @@ func MaintenanceFailed(message string) metav1.Condition {
 		Message:            message,
 	}
 }
+
+// Synced creates an active condition with TypeSynced, ReasonReconcileSuccess and empty message.
+func Synced() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeSynced,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReconcileSuccess,
+	}
+}
+
+// ReconcileError creates an inactive condition with TypeSynced, ReasonReconcileError and given message.
+func ReconcileError(message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeSynced,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReconcileError,
+		Message:            message,
+	}
+}
+
+// ResourceReady creates an active condition with given type, ReasonReady and empty message.
+func ResourceReady(conditionType string) metav1.Condition {
+	return metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReady,
+	}
+}
+
+// ResourceNotReady creates an inactive condition with given type, ReasonNotReady and given message.
+func ResourceNotReady(conditionType, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNotReady,
+		Message:            message,
+	}
+}
+
+// BackupDisabled creates an inactive condition with TypeBackupConfigured, ReasonBackupDisabled and empty message.
+func BackupDisabled() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeBackupConfigured,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonBackupDisabled,
+	}
+}
+
+// Drifted creates an active condition with TypeDrifted, ReasonDriftDetected and given message.
+func Drifted(message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDriftDetected,
+		Message:            message,
+	}
+}
+
+// DriftReverted creates an inactive condition with TypeDrifted, ReasonDriftReverted and given message.
+func DriftReverted(message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDriftReverted,
+		Message:            message,
+	}
+}
+
+// NoDrift creates an inactive condition with TypeDrifted, ReasonNoDrift and empty message.
+func NoDrift() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNoDrift,
+	}
+}
+
+// Hibernated creates an active condition with TypeHibernated, ReasonHibernated and empty message.
+func Hibernated() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeHibernated,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonHibernated,
+	}
+}
+
+// Resuming creates an active condition with TypeHibernated, ReasonResuming and given message.
+func Resuming(message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeHibernated,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonResuming,
+		Message:            message,
+	}
+}
+
+// Resumed creates an inactive condition with TypeHibernated, ReasonResumed and empty message.
+func Resumed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeHibernated,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonResumed,
+	}
+}
+
+// Paused creates an active condition with TypePaused, ReasonPaused and given message.
+func Paused(message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypePaused,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPaused,
+		Message:            message,
+	}
+}
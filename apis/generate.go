@@ -9,5 +9,6 @@
 
 // Generate webhook manifests
 //go:generate go run -tags generate sigs.k8s.io/controller-tools/cmd/controller-gen webhook paths=./... output:artifacts:config=../package/webhook
+//go:generate yq -i e "(.webhooks[] | select(.name == \"deploymentnamespaces.postgresql.appcat.vshn.io\")).namespaceSelector.matchLabels[\"app.kubernetes.io/managed-by\"] = \"postgresql.appcat.vshn.io\"" ../package/webhook/manifests.yaml
 
 package apis
@@ -6,4 +6,10 @@ type DeploymentStrategy string
 const (
 	// StrategyHelmChart refers to a DeploymentStrategy that deploys the instance using a Helm chart.
 	StrategyHelmChart DeploymentStrategy = "HelmChart"
+	// StrategyStatefulSet refers to a DeploymentStrategy that deploys the instance with a StatefulSet that is rendered by the operator.
+	StrategyStatefulSet DeploymentStrategy = "StatefulSet"
+	// StrategyCloudNativePG refers to a DeploymentStrategy that deploys the instance with a CloudNativePG Cluster.
+	StrategyCloudNativePG DeploymentStrategy = "CloudNativePG"
+	// StrategyHelmSDK refers to a DeploymentStrategy that deploys the instance using a Helm chart that the operator installs itself with the Helm SDK.
+	StrategyHelmSDK DeploymentStrategy = "HelmSDK"
 )
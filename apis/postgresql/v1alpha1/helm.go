@@ -1,6 +1,17 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// PinnedChartVersionAnnotationKey is the annotation key of a PostgresqlStandalone that pins the instance to a chart version.
+	// The chart version has to be a concrete semantic version that is listed in the HelmReleases of the PostgresqlStandaloneOperatorConfig, either exactly or by a constraint.
+	// Only platform admins are allowed to set the annotation.
+	PinnedChartVersionAnnotationKey = fmt.Sprintf("%s/pinned-chart-version", Group)
+)
 
 // ChartMeta contains the metadata to a Helm chart.
 type ChartMeta struct {
@@ -19,6 +30,18 @@ type ChartMetaStatus struct {
 	ModifiedTime metav1.Time `json:"modifiedAt,omitempty"`
 	// DeploymentNamespace is the observed namespace name where the instance is deployed.
 	DeploymentNamespace string `json:"deploymentNamespace,omitempty"`
+	// AppliedValuesHash is the canonical hash sum of the Helm values that the operator applied last.
+	// It's a copy of the hash sum in the annotations of the Helm release, which is used to detect changes of the Helm values that haven't been made by the operator.
+	AppliedValuesHash string `json:"appliedValuesHash,omitempty"`
+	// PinnedVersion is the chart version that the instance is pinned to.
+	// Pinned instances aren't part of rollouts.
+	PinnedVersion string `json:"pinnedVersion,omitempty"`
+	// Revision is the revision of the Helm release.
+	// Only set if the release is installed by the operator with the Helm SDK.
+	Revision int `json:"revision,omitempty"`
+	// ReleaseStatus is the status of the Helm release, for example `deployed` or `failed`.
+	// Only set if the release is installed by the operator with the Helm SDK.
+	ReleaseStatus string `json:"releaseStatus,omitempty"`
 
 	existingHashSum uint32 `json:"-"`
 }
@@ -0,0 +1,75 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Plan is a named instance size that instances reference instead of specifying their resources individually.
+type Plan struct {
+	// Name is the name that instances use to reference the plan.
+	Name string `json:"name"`
+
+	// Resources are the resources that instances with this plan get.
+	// Changing the plan of an instance replaces its resources with the resources of the new plan, except the storage capacity which never shrinks.
+	Resources Resources `json:"resources,omitempty"`
+
+	// Backup contains the backup settings that new instances with this plan get by default.
+	Backup BackupSpec `json:"backup,omitempty"`
+
+	// Scheduling constrains the nodes that instances with this plan are scheduled on.
+	// The fields that are set replace the corresponding fields of the Scheduling in the config.
+	Scheduling SchedulingSpec `json:"scheduling,omitempty"`
+
+	// +kubebuilder:pruning:PreserveUnknownFields
+
+	// HelmValues are deep-merged into the Helm values of instances with this plan.
+	// Values that are derived from the instance, like resources and credentials, can't be overridden.
+	HelmValues runtime.RawExtension `json:"helmValues,omitempty"`
+}
+
+// SchedulingSpec contains the constraints that decide on which nodes an instance is scheduled.
+type SchedulingSpec struct {
+	// NodeSelector selects the nodes that the instance is scheduled on by their labels.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations allow the instance to be scheduled on tainted nodes.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity contains the node and pod affinities of the instance.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints describe how the instances are spread across topology domains like zones.
+	// They aren't applied to instances that are deployed with CloudNativePG, whose Cluster doesn't support them.
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// PriorityClassName is the name of the PriorityClass of the instance.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// WithOverrides returns a copy of the scheduling constraints where the fields that are set in the given overrides replace the existing ones.
+func (in SchedulingSpec) WithOverrides(overrides SchedulingSpec) SchedulingSpec {
+	merged := *in.DeepCopy()
+	if overrides.NodeSelector != nil {
+		merged.NodeSelector = overrides.NodeSelector
+	}
+	if overrides.Tolerations != nil {
+		merged.Tolerations = overrides.Tolerations
+	}
+	if overrides.Affinity != nil {
+		merged.Affinity = overrides.Affinity
+	}
+	if overrides.TopologySpreadConstraints != nil {
+		merged.TopologySpreadConstraints = overrides.TopologySpreadConstraints
+	}
+	if overrides.PriorityClassName != "" {
+		merged.PriorityClassName = overrides.PriorityClassName
+	}
+	return merged
+}
+
+// GetPlan returns the plan with the given name, or nil if there is no such plan.
+func (in *PostgresqlStandaloneOperatorConfigSpec) GetPlan(name string) *Plan {
+	for i := range in.Plans {
+		if in.Plans[i].Name == name {
+			return &in.Plans[i]
+		}
+	}
+	return nil
+}
@@ -11,37 +11,92 @@ import (
 
 // A PostgresqlStandaloneOperatorConfigSpec defines the desired state of a PostgresqlStandaloneOperatorConfig.
 type PostgresqlStandaloneOperatorConfigSpec struct {
-	// DeploymentStrategy defines the DeploymentStrategy in case there isn't a 1:1 match.
+	// DeploymentStrategy defines the DeploymentStrategy that new instances are deployed with, either `HelmChart` (default), `HelmSDK`, `StatefulSet` or `CloudNativePG`.
+	// Existing instances keep the DeploymentStrategy they have been deployed with.
 	DeploymentStrategy DeploymentStrategy `json:"defaultDeploymentStrategy,omitempty"`
 
 	// ResourceMinima defines the minimum supported resources an instance can have.
 	ResourceMinima Resources `json:"resourceMinima,omitempty"`
 	// ResourceMaxima defines the maximum supported resources an instance can have.
 	ResourceMaxima Resources `json:"resourceMaxima,omitempty"`
+	// ResourceRatio defines how the missing request or limit of an instance is derived from the other one.
+	ResourceRatio ResourceRatio `json:"resourceRatio,omitempty"`
+
+	// Tuning defines how PostgreSQL settings are derived from the resources of an instance.
+	Tuning TuningSpec `json:"tuning,omitempty"`
+
+	// Plans are the named instance sizes that instances can reference.
+	// The name of a plan has to be unique.
+	Plans []Plan `json:"plans,omitempty"`
+
+	// Scheduling constrains the nodes that all instances are scheduled on.
+	// The fields that a plan sets in its Scheduling replace the fields of this Scheduling for instances with that plan.
+	// It's used when DeploymentStrategy is StrategyHelmChart or StrategyHelmSDK.
+	Scheduling SchedulingSpec `json:"scheduling,omitempty"`
 
 	// HelmReleaseTemplate is the default release config that is used for all HelmReleases.
+	// It's used when DeploymentStrategy is StrategyHelmChart or StrategyHelmSDK.
+	// With StrategyHelmSDK, the chart repository is either an OCI registry (`oci://`), an HTTP chart repository or a local chart directory.
 	// Changing values in this field affects also existing deployed Helm releases unless they are pinned in HelmReleases for a specific chart version.
 	// New instances use this config unless there's a specific HelmReleaseConfig for a version that matches the version in this spec.
 	HelmReleaseTemplate *HelmReleaseConfig `json:"helmReleaseTemplate,omitempty"`
 
 	// HelmReleases allows to override settings for a specific deployable Helm chart.
+	// The chart version of an entry is either an exact version or a semver constraint like `>=11.1 <12`.
+	// If multiple entries match the chart version of HelmReleaseTemplate, an entry with the exact version takes precedence over entries with a constraint.
+	// Among entries with the same precedence, the first one in the list is used and the others are reported as conflicts in the status.
 	HelmReleases []HelmReleaseConfig `json:"helmReleases,omitempty"`
 
 	// HelmProviderConfigReference is the name of the ProviderConfig CR from crossplane-contrib/provider-helm.
 	// Used when DeploymentStrategy is StrategyHelmChart.
 	HelmProviderConfigReference string `json:"helmProviderConfigReference,omitempty"`
 
+	//+kubebuilder:validation:Enum=Report;Revert
+	//+kubebuilder:default=Report
+
+	// HelmValuesDriftPolicy defines what happens if the Helm values of a deployed release have been changed by someone else than the operator.
+	// With `Report`, the changes are left untouched and the instance gets a `Drifted` condition.
+	// With `Revert`, the values that the operator applied last are restored.
+	HelmValuesDriftPolicy DriftPolicy `json:"helmValuesDriftPolicy,omitempty"`
+
+	// StatefulSet configures instances that are deployed with the StatefulSet strategy.
+	StatefulSet *StatefulSetConfig `json:"statefulSet,omitempty"`
+
+	// CloudNativePG configures instances that are deployed with the CloudNativePG strategy.
+	CloudNativePG *CloudNativePGConfig `json:"cloudNativePG,omitempty"`
+
+	// Rollout defines how existing instances are upgraded to the chart version of HelmReleaseTemplate.
+	// Without Rollout, existing instances keep the chart version they have been deployed with.
+	Rollout *RolloutSpec `json:"rollout,omitempty"`
+
 	// Persistence contains default PVC settings.
 	Persistence PersistenceSpec `json:"persistence,omitempty"`
 
+	// DeploymentNamespace configures the namespaces that the instances are deployed in.
+	DeploymentNamespace DeploymentNamespaceConfig `json:"deploymentNamespace,omitempty"`
+
+	// MetadataPropagation defines the labels and annotations that are copied from an instance and its namespace to the resources that are deployed for the instance.
+	MetadataPropagation MetadataPropagationSpec `json:"metadataPropagation,omitempty"`
+
 	// BackupConfigSpec defines settings for instance backups.
 	BackupConfigSpec BackupConfigSpec `json:"backupConfigSpec,omitempty"`
 }
 
+// DriftPolicy defines how the operator handles resources that have been changed by someone else.
+type DriftPolicy string
+
+const (
+	// DriftPolicyReport only reports drift in the conditions of an instance.
+	DriftPolicyReport DriftPolicy = "Report"
+	// DriftPolicyRevert reverts drift to the state the operator applied last.
+	DriftPolicyRevert DriftPolicy = "Revert"
+)
+
 // HelmReleaseConfig describes a Helm chart release.
 type HelmReleaseConfig struct {
 	// Chart sets the scope of this config to a specific version.
 	// At least chart version is required in order for this HelmReleaseConfig to take effect.
+	// In PostgresqlStandaloneOperatorConfigSpec.HelmReleases, the chart version may also be a semver constraint.
 	Chart ChartMeta `json:"chart,omitempty"`
 
 	// +kubebuilder:pruning:PreserveUnknownFields
@@ -53,6 +108,100 @@ type HelmReleaseConfig struct {
 	MergeValuesFromTemplate bool `json:"mergeValuesFromTemplate,omitempty"`
 }
 
+// StatefulSetConfig configures instances that are deployed with the StatefulSet strategy.
+type StatefulSetConfig struct {
+	// Image is the PostgreSQL container image, for example `docker.io/bitnami/postgresql:14.4.0`.
+	// The image has to be compatible with the Bitnami PostgreSQL image.
+	Image string `json:"image,omitempty"`
+	// ImagePullPolicy is the pull policy of the image.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Parameters are PostgreSQL configuration parameters that are written to the extended configuration of the server.
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// CloudNativePGConfig configures instances that are deployed with the CloudNativePG strategy.
+type CloudNativePGConfig struct {
+	// ImageName is the PostgreSQL container image of the Cluster.
+	// Defaults to the image of CloudNativePG for the major version, for example `ghcr.io/cloudnative-pg/postgresql:14`.
+	ImageName string `json:"imageName,omitempty"`
+	// Parameters are PostgreSQL configuration parameters that are set in the Cluster.
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// DeploymentNamespaceConfig configures the namespaces that the instances are deployed in.
+// It limits what the deployed resources can do, regardless of the deployment strategy.
+type DeploymentNamespaceConfig struct {
+	// PodSecurityLabels are the Pod Security Admission labels of the namespaces, for example `pod-security.kubernetes.io/enforce: baseline`.
+	// Labels with the prefix `pod-security.kubernetes.io/` that aren't listed here are removed from the namespaces.
+	PodSecurityLabels map[string]string `json:"podSecurityLabels,omitempty"`
+	// ResourceQuota defines the ResourceQuota that limits the resources in the namespace of an instance to the resources of the instance.
+	// If omitted, no ResourceQuota is created.
+	ResourceQuota *ResourceQuotaTemplate `json:"resourceQuota,omitempty"`
+	// LimitRange is the spec of the LimitRange in the namespace of an instance.
+	// It sets the default resources of containers that don't specify them, which is required for containers in namespaces with a ResourceQuota.
+	// The operator adds container defaults for the compute resources that the ResourceQuota limits, unless they're given here.
+	// If omitted, a LimitRange is only created if the ResourceQuota limits compute resources.
+	LimitRange *corev1.LimitRangeSpec `json:"limitRange,omitempty"`
+}
+
+// ResourceQuotaTemplate defines how the ResourceQuota in the namespace of an instance is derived from the resources of the instance.
+// The CPU and memory requests and limits are taken from the instance, and the storage requests from its StorageCapacity.
+// While the storage of the instance is migrated, the storage requests are tripled to make room for the PersistentVolumeClaims of the backup and the new storage class.
+type ResourceQuotaTemplate struct {
+	//+kubebuilder:validation:Minimum=0
+
+	// HeadroomPercentage is added to the resources of the instance in percent,
+	// to leave room for additional containers and jobs, for example for metrics and backups.
+	HeadroomPercentage int64 `json:"headroomPercentage,omitempty"`
+	// Hard contains additional limits of the ResourceQuota, for example `pods` or `count/secrets`.
+	// They take precedence over the limits that are derived from the resources of the instance.
+	Hard corev1.ResourceList `json:"hard,omitempty"`
+}
+
+// MetadataPropagationSpec defines the labels and annotations that are copied from an instance and its namespace
+// to the deployment namespace, the Helm release, the PersistentVolumeClaim, the k8up schedule and the connection secret of the instance.
+// An entry is either the key of a label or annotation, for example `example.com/cost-center`,
+// or a prefix that ends with `*`, for example `billing.example.com/*`.
+// If both the instance and its namespace have a matching label or annotation, the one of the instance is used.
+// Labels and annotations that are removed from the instance or its namespace are kept on the resources.
+type MetadataPropagationSpec struct {
+	// Labels are the keys or prefixes of the labels that are copied.
+	Labels []string `json:"labels,omitempty"`
+	// Annotations are the keys or prefixes of the annotations that are copied.
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// RolloutSpec defines how existing instances are upgraded to a new chart version in batches.
+type RolloutSpec struct {
+	// CanarySelector selects the instances that are upgraded first, before any batch.
+	// The selector matches the labels of the instances.
+	CanarySelector *metav1.LabelSelector `json:"canarySelector,omitempty"`
+
+	//+kubebuilder:validation:MinItems=1
+	//+kubebuilder:default={100}
+
+	// BatchPercentages are the cumulative percentages of instances that are upgraded after each batch, for example `[10, 50, 100]`.
+	// The last batch always includes all instances, even if its percentage is lower than 100.
+	BatchPercentages []int `json:"batchPercentages,omitempty"`
+
+	// PauseBetweenBatches is the duration to wait after all instances of a batch have been upgraded before the next batch starts.
+	PauseBetweenBatches metav1.Duration `json:"pauseBetweenBatches,omitempty"`
+
+	//+kubebuilder:default="10m"
+
+	// ProgressDeadline is the duration in which the release of an upgraded instance has to become ready again.
+	// Instances that don't become ready within this duration count as failed.
+	// Instances that haven't been upgraded to the new chart version within this duration after their batch started count as failed, too,
+	// e.g. because they are paused or their config is broken.
+	ProgressDeadline metav1.Duration `json:"progressDeadline,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:default=1
+
+	// MaxFailures is the number of failed instances that stops the rollout.
+	MaxFailures int `json:"maxFailures,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
@@ -73,8 +222,28 @@ type PostgresqlStandaloneOperatorConfig struct {
 // PersistenceSpec contains default PVC settings.
 type PersistenceSpec struct {
 	// storageClassName is the name of the StorageClass required by the claim.
+	// It's used for instances that don't specify a storage class.
 	StorageClassName *string                             `json:"storageClassName,omitempty"`
 	AccessModes      []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+	// AllowedStorageClasses are the names of the storage classes that instances can choose from, next to StorageClassName.
+	AllowedStorageClasses []string `json:"allowedStorageClasses,omitempty"`
+	// MigrationImage is the PostgreSQL image that backs up and restores the data when the storage class of an instance changes.
+	// Its PostgreSQL version must match the major version of the config.
+	// Defaults to the Bitnami PostgreSQL image of the major version.
+	MigrationImage string `json:"migrationImage,omitempty"`
+}
+
+// IsStorageClassAllowed returns true if instances can choose the given storage class.
+func (in *PersistenceSpec) IsStorageClassAllowed(name string) bool {
+	if in.StorageClassName != nil && *in.StorageClassName == name {
+		return true
+	}
+	for _, allowed := range in.AllowedStorageClasses {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
 }
 
 // +kubebuilder:object:root=true
@@ -88,6 +257,59 @@ type PostgresqlStandaloneOperatorConfigList struct {
 
 // A PostgresqlStandaloneConfigStatus reflects the observed state of a PostgresqlStandaloneOperatorConfig.
 type PostgresqlStandaloneConfigStatus struct {
+	GenerationStatus `json:",inline"`
+	// HelmReleaseConflicts lists the entries of HelmReleases that match the chart version of HelmReleaseTemplate with the same precedence.
+	HelmReleaseConflicts []HelmReleaseConflict `json:"helmReleaseConflicts,omitempty"`
+	// Rollout is the observed progress of upgrading existing instances to the chart version of HelmReleaseTemplate.
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+// RolloutPhase describes the state of a rollout.
+type RolloutPhase string
+
+const (
+	// RolloutPhaseProgressing means that instances of the current batch are being upgraded.
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	// RolloutPhasePaused means that all instances of the current batch have been upgraded and the next batch waits for PauseBetweenBatches to pass.
+	RolloutPhasePaused RolloutPhase = "Paused"
+	// RolloutPhaseCompleted means that all instances have been upgraded.
+	RolloutPhaseCompleted RolloutPhase = "Completed"
+	// RolloutPhaseFailed means that the rollout has been stopped because too many instances failed to upgrade.
+	// The rollout is restarted by removing and adding the rollout spec again or by changing the chart version.
+	RolloutPhaseFailed RolloutPhase = "Failed"
+)
+
+// RolloutStatus is the observed progress of a rollout.
+type RolloutStatus struct {
+	// Version is the chart version that is rolled out.
+	Version string `json:"version,omitempty"`
+	// Phase is the state of the rollout.
+	Phase RolloutPhase `json:"phase,omitempty"`
+	// CurrentBatch is the index of the batch that is being upgraded.
+	// If there are canary instances, they are the batch with index 0.
+	CurrentBatch int `json:"currentBatch"`
+	// Batches is the total number of batches.
+	Batches int `json:"batches,omitempty"`
+	// Total is the number of instances that are part of the rollout.
+	Total int `json:"total"`
+	// Upgraded is the number of instances whose release has become ready with the new chart version.
+	Upgraded int `json:"upgraded"`
+	// FailedInstances are the instances whose release didn't become ready within the ProgressDeadline, in the format `namespace/name`.
+	FailedInstances []string `json:"failedInstances,omitempty"`
+	// BatchStartedAt is the time when the instances of the current batch have been told to upgrade.
+	BatchStartedAt *metav1.Time `json:"batchStartedAt,omitempty"`
+	// BatchCompletedAt is the time when all instances of the current batch have been upgraded.
+	BatchCompletedAt *metav1.Time `json:"batchCompletedAt,omitempty"`
+}
+
+// HelmReleaseConflict describes multiple entries of HelmReleases that match the same chart version.
+type HelmReleaseConflict struct {
+	// Version is the chart version that is matched by multiple entries.
+	Version string `json:"version,omitempty"`
+	// Selected is the chart version or constraint of the entry that is used.
+	Selected string `json:"selected,omitempty"`
+	// Ignored are the chart versions or constraints of the entries that are ignored.
+	Ignored []string `json:"ignored,omitempty"`
 }
 
 // PostgresqlStandaloneOperatorConfig type metadata.
@@ -10,6 +10,11 @@ import (
 // PostgresqlStandaloneParameters defines the PostgreSQL specific settings.
 type PostgresqlStandaloneParameters struct {
 
+	// Plan is the name of a plan in the operator config that defines the size of the instance.
+	// The resources of the plan are set as default for Resources.
+	// Changing the plan resizes the instance to the resources of the new plan.
+	Plan string `json:"plan,omitempty"`
+
 	// Resources contain the storage and compute resources.
 	Resources Resources `json:"resources,omitempty"`
 
@@ -27,6 +32,17 @@ type PostgresqlStandaloneParameters struct {
 
 	// EnableSuperUser also provisions the 'postgres' superuser credentials for consumption.
 	EnableSuperUser bool `json:"enableSuperUser,omitempty"`
+
+	// PostgresqlSettings are PostgreSQL configuration parameters like `max_connections`.
+	// They take precedence over the settings that the operator derives from the resources of the instance and over the settings of the platform.
+	PostgresqlSettings map[string]string `json:"postgresqlSettings,omitempty"`
+
+	// Hibernated stops PostgreSQL while keeping its data, credentials and backup schedule.
+	// The connection secret is marked with `POSTGRESQL_HIBERNATED` while the instance is hibernated.
+	// Scheduled backups don't back up anything while the instance is hibernated, since K8up only backs up running pods.
+	// Changes to the instance that require a new release of the Helm chart are applied once the instance is resumed.
+	// Setting it to false resumes the instance.
+	Hibernated bool `json:"hibernated,omitempty"`
 }
 
 // PostgresqlStandaloneSpec defines the desired state of a PostgresqlStandalone.
@@ -48,11 +64,17 @@ type PostgresqlStandaloneStatus struct {
 // +kubebuilder:object:root=true
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:printcolumn:name="Progressing",type="string",JSONPath=".status.conditions[?(@.type=='Progressing')].status"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status"
+// +kubebuilder:printcolumn:name="Plan",type="string",JSONPath=".spec.forInstance.plan"
+// +kubebuilder:printcolumn:name="Pinned",type="string",JSONPath=".status.helmChart.pinnedVersion"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced,categories={appcat,postgresql}
 // +kubebuilder:webhook:verbs=create;update;delete,path=/validate-postgresql-appcat-vshn-io-v1alpha1-postgresqlstandalone,mutating=false,failurePolicy=fail,groups=postgresql.appcat.vshn.io,resources=postgresqlstandalones,versions=v1alpha1,name=postgresqlstandalones.postgresql.appcat.vshn.io,sideEffects=None,admissionReviewVersions=v1
 // +kubebuilder:webhook:verbs=create;update,path=/mutate-postgresql-appcat-vshn-io-v1alpha1-postgresqlstandalone,mutating=true,failurePolicy=fail,groups=postgresql.appcat.vshn.io,resources=postgresqlstandalones,versions=v1alpha1,name=postgresqlstandalones.postgresql.appcat.vshn.io,sideEffects=None,admissionReviewVersions=v1
+// The webhook that protects the resources in the deployment namespaces is restricted to namespaces with the label `app.kubernetes.io/managed-by=postgresql.appcat.vshn.io`.
+// controller-gen can't generate the namespaceSelector, it's added to the generated manifest in apis/generate.go.
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-deployment-namespace-resources,mutating=false,failurePolicy=fail,groups="";apps,resources=secrets;persistentvolumeclaims;services;configmaps;statefulsets,versions=v1,name=deploymentnamespaces.postgresql.appcat.vshn.io,sideEffects=None,admissionReviewVersions=v1
 
 // PostgresqlStandalone is the user-facing and consumer-friendly API that abstracts the provisioning of standalone Postgresql service instances.
 type PostgresqlStandalone struct {
@@ -80,6 +102,21 @@ var (
 	PostgresqlStandaloneGroupVersionKind = SchemeGroupVersion.WithKind(PostgresqlStandaloneKind)
 )
 
+// PausedAnnotationKey is the annotation key that pauses the reconciliation of a PostgresqlStandalone if its value is "true".
+// It can be set on the instance or on the namespace of the instance.
+// Since the operator only watches its own namespaces, changes on the namespace of the instance take effect with the next reconciliation of the instance.
+var PausedAnnotationKey = Group + "/paused"
+
+// IsPaused returns true if the given object has the PausedAnnotationKey annotation set to "true".
+func IsPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[PausedAnnotationKey] == "true"
+}
+
+// GetPinnedChartVersion returns the chart version that the instance is pinned to, or an empty string if the instance isn't pinned.
+func (in *PostgresqlStandalone) GetPinnedChartVersion() string {
+	return in.Annotations[PinnedChartVersionAnnotationKey]
+}
+
 func init() {
 	SchemeBuilder.Register(&PostgresqlStandalone{}, &PostgresqlStandaloneList{})
 }
@@ -14,7 +14,17 @@ type Resources struct {
 type ComputeResources struct {
 	// MemoryLimit defines the maximum memory limit designated for the instance.
 	// It can be freely scaled up or down within the operator-configured limits.
+	// If omitted, it's derived from MemoryRequest with the operator-configured ResourceRatio.
 	MemoryLimit *resource.Quantity `json:"memoryLimit,omitempty"`
+	// MemoryRequest defines the amount of memory that is reserved for the instance.
+	// If omitted, it's derived from MemoryLimit with the operator-configured ResourceRatio.
+	MemoryRequest *resource.Quantity `json:"memoryRequest,omitempty"`
+	// CPULimit defines the maximum CPU designated for the instance.
+	// If omitted, it's derived from CPURequest with the operator-configured ResourceRatio.
+	CPULimit *resource.Quantity `json:"cpuLimit,omitempty"`
+	// CPURequest defines the amount of CPU that is reserved for the instance.
+	// If omitted, it's derived from CPULimit with the operator-configured ResourceRatio.
+	CPURequest *resource.Quantity `json:"cpuRequest,omitempty"`
 }
 
 // StorageResources contains the high-level scalable storage resources for an instance.
@@ -24,4 +34,62 @@ type StorageResources struct {
 	// Attempt to shrink the size will throw a validation error.
 	// Minimum and Maximum is defined on an operator level.
 	StorageCapacity *resource.Quantity `json:"storageCapacity,omitempty"`
+	// StorageClassName is the name of the StorageClass of the PersistentVolume.
+	// It has to be one of the storage classes that the operator allows.
+	// If omitted, the operator-configured default storage class is used.
+	// Changing the storage class of an existing instance migrates the data to a new PersistentVolume, during which the instance is in maintenance.
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// StorageAutoscaling increases StorageCapacity automatically once the PersistentVolume fills up.
+	// If omitted, StorageCapacity is only changed manually.
+	StorageAutoscaling *StorageAutoscaling `json:"storageAutoscaling,omitempty"`
+}
+
+// StorageAutoscaling defines how StorageCapacity is increased depending on the usage of the PersistentVolume.
+type StorageAutoscaling struct {
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=99
+
+	// ThresholdPercentage is the usage of the PersistentVolume in percent of its capacity, from which StorageCapacity is increased.
+	ThresholdPercentage int64 `json:"thresholdPercentage"`
+	// Increment is the amount by which StorageCapacity is increased each time the threshold is reached.
+	Increment resource.Quantity `json:"increment"`
+	// Maximum is the StorageCapacity up to which the storage is increased.
+	// The storage is never increased beyond the operator-configured maximum storage capacity.
+	// If omitted, only the operator-configured maximum applies.
+	Maximum *resource.Quantity `json:"maximum,omitempty"`
+}
+
+// ResourceRatio defines how the request of a resource is derived from its limit and vice versa, if an instance only specifies one of them.
+type ResourceRatio struct {
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+
+	// CPURequestPercentage is the CPU request in percent of the CPU limit.
+	// If omitted, a missing CPU request or limit isn't derived.
+	CPURequestPercentage int64 `json:"cpuRequestPercentage,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+
+	// MemoryRequestPercentage is the memory request in percent of the memory limit.
+	// If omitted, a missing memory request or limit isn't derived.
+	MemoryRequestPercentage int64 `json:"memoryRequestPercentage,omitempty"`
+}
+
+// GetQuantities returns the quantities of the resources by the JSON name of their field.
+// Quantities that aren't set are omitted.
+func (in *Resources) GetQuantities() map[string]*resource.Quantity {
+	quantities := map[string]*resource.Quantity{}
+	for name, quantity := range map[string]*resource.Quantity{
+		"memoryLimit":     in.MemoryLimit,
+		"memoryRequest":   in.MemoryRequest,
+		"cpuLimit":        in.CPULimit,
+		"cpuRequest":      in.CPURequest,
+		"storageCapacity": in.StorageCapacity,
+	} {
+		if quantity != nil {
+			quantities[name] = quantity
+		}
+	}
+	return quantities
 }
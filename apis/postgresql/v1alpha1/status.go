@@ -1,6 +1,8 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -8,8 +10,88 @@ import (
 type PostgresqlStandaloneObservation struct {
 	// DeploymentStrategy is the observed deployed strategy.
 	DeploymentStrategy DeploymentStrategy `json:"deploymentStrategy,omitempty"`
+	// DeploymentNamespace is the observed namespace name where the instance is deployed.
+	DeploymentNamespace string `json:"deploymentNamespace,omitempty"`
 	// HelmChart is the observed deployed Helm chart version.
 	HelmChart *ChartMetaStatus `json:"helmChart,omitempty"`
+	// DerivedSettings are the PostgreSQL settings that the operator derived from the resources of the instance.
+	// Settings that are overridden by the PostgresqlSettings of the instance are omitted.
+	DerivedSettings map[string]string `json:"derivedSettings,omitempty"`
+	// PersistentVolumeClaimName is the observed name of the PersistentVolumeClaim that contains the data of the instance.
+	PersistentVolumeClaimName string `json:"persistentVolumeClaimName,omitempty"`
+	// StorageClassName is the observed storage class of the PersistentVolumeClaim that contains the data of the instance.
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// StorageMigration is the progress of migrating the data to another storage class.
+	StorageMigration *StorageMigrationStatus `json:"storageMigration,omitempty"`
+	// StorageCapacity is the observed capacity of the PersistentVolumeClaim that contains the data of the instance.
+	// It lags behind the requested StorageCapacity while the volume is being expanded.
+	StorageCapacity *resource.Quantity `json:"storageCapacity,omitempty"`
+	// StorageResizePhase is the observed progress of expanding the PersistentVolumeClaim that contains the data of the instance.
+	// It's empty if no expansion is in progress.
+	StorageResizePhase StorageResizePhase `json:"storageResizePhase,omitempty"`
+	// StorageAutoscaling is the observed usage of the storage and the record of the automatic increases of StorageCapacity.
+	StorageAutoscaling *StorageAutoscalingStatus `json:"storageAutoscaling,omitempty"`
+}
+
+// StorageAutoscalingStatus is the observed state of the storage autoscaling of an instance.
+type StorageAutoscalingStatus struct {
+	// UsedPercentage is the last observed usage of the PersistentVolume in percent of its capacity.
+	UsedPercentage int64 `json:"usedPercentage,omitempty"`
+	// LastObservedTime is the time when the usage of the PersistentVolume has been observed the last time.
+	LastObservedTime metav1.Time `json:"lastObservedTime,omitempty"`
+	// LimitReached is true if the usage reached the threshold, but StorageCapacity can't be increased beyond the maximum.
+	LimitReached bool `json:"limitReached,omitempty"`
+	// Resizes are the most recent automatic increases of StorageCapacity, the oldest first.
+	Resizes []StorageResize `json:"resizes,omitempty"`
+}
+
+// StorageResize is the record of an automatic increase of StorageCapacity.
+type StorageResize struct {
+	// Time is the time of the increase.
+	Time metav1.Time `json:"time"`
+	// UsedPercentage is the usage of the PersistentVolume in percent of its capacity that caused the increase.
+	UsedPercentage int64 `json:"usedPercentage"`
+	// PreviousCapacity is the StorageCapacity before the increase.
+	PreviousCapacity resource.Quantity `json:"previousCapacity"`
+	// Capacity is the StorageCapacity after the increase.
+	Capacity resource.Quantity `json:"capacity"`
+}
+
+// StorageResizePhase describes the state of a volume expansion.
+type StorageResizePhase string
+
+const (
+	// StorageResizePhaseResizing means that the volume is being expanded by the storage provider.
+	StorageResizePhaseResizing StorageResizePhase = "Resizing"
+	// StorageResizePhaseFileSystemResizePending means that the volume has been expanded, but the file system is only expanded once PostgreSQL restarts.
+	StorageResizePhaseFileSystemResizePending StorageResizePhase = "FileSystemResizePending"
+)
+
+// StorageMigrationPhase describes the state of a storage migration.
+type StorageMigrationPhase string
+
+const (
+	// StorageMigrationPhaseBackingUp means that the data is being backed up from the current PersistentVolumeClaim.
+	StorageMigrationPhaseBackingUp StorageMigrationPhase = "BackingUp"
+	// StorageMigrationPhaseRestoring means that the instance has been switched to the new PersistentVolumeClaim and the backup is being restored.
+	StorageMigrationPhaseRestoring StorageMigrationPhase = "Restoring"
+	// StorageMigrationPhaseFailed means that the migration failed.
+	// It's retried once the storage class of the instance changes again.
+	StorageMigrationPhaseFailed StorageMigrationPhase = "Failed"
+)
+
+// StorageMigrationStatus is the progress of migrating the data of an instance to another storage class.
+type StorageMigrationStatus struct {
+	// Phase is the state of the migration.
+	Phase StorageMigrationPhase `json:"phase,omitempty"`
+	// StorageClassName is the storage class that the data is migrated to.
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// SourceStorageClassName is the storage class that the data is migrated from.
+	SourceStorageClassName string `json:"sourceStorageClassName,omitempty"`
+	// SourceClaimName is the name of the PersistentVolumeClaim that the data is migrated from.
+	SourceClaimName string `json:"sourceClaimName,omitempty"`
+	// TargetClaimName is the name of the PersistentVolumeClaim that the data is migrated to.
+	TargetClaimName string `json:"targetClaimName,omitempty"`
 }
 
 type GenerationStatus struct {
@@ -23,7 +105,11 @@ func (in *GenerationStatus) SetObservedGeneration(obj client.Object) {
 }
 
 // GetDeploymentNamespace returns the name of the namespace where the instance is deployed.
+// Instances that have been deployed before DeploymentNamespace existed only have the namespace in HelmChart.
 func (in PostgresqlStandaloneObservation) GetDeploymentNamespace() string {
+	if in.DeploymentNamespace != "" {
+		return in.DeploymentNamespace
+	}
 	if in.HelmChart == nil {
 		return ""
 	}
@@ -0,0 +1,99 @@
+package v1alpha1
+
+import "strings"
+
+// TuningSpec defines how PostgreSQL settings are derived from the resources of an instance.
+// Memory settings are derived from the memory limit, or from the memory request if there is no limit.
+// Settings for parallel workers are derived from the CPU limit, or from the CPU request if there is no limit.
+// Fields that are omitted use their default.
+type TuningSpec struct {
+	// Disabled turns off deriving PostgreSQL settings from the resources of instances.
+	Disabled bool `json:"disabled,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+
+	// SharedBuffersPercentage is the percentage of memory that is used for `shared_buffers`.
+	// Defaults to 25.
+	SharedBuffersPercentage int64 `json:"sharedBuffersPercentage,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+
+	// EffectiveCacheSizePercentage is the percentage of memory that is used for `effective_cache_size`.
+	// Defaults to 75.
+	EffectiveCacheSizePercentage int64 `json:"effectiveCacheSizePercentage,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+
+	// MaintenanceWorkMemPercentage is the percentage of memory that is used for `maintenance_work_mem`.
+	// Defaults to 5.
+	MaintenanceWorkMemPercentage int64 `json:"maintenanceWorkMemPercentage,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=100
+
+	// WorkMemPercentage is the percentage of the memory next to the shared buffers that is split among all connections for `work_mem`.
+	// Defaults to 25.
+	WorkMemPercentage int64 `json:"workMemPercentage,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+
+	// ConnectionsPerGiB is the number of connections per GiB of memory for `max_connections`.
+	// Defaults to 100.
+	ConnectionsPerGiB int64 `json:"connectionsPerGiB,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+
+	// MinConnections is the lower bound for `max_connections`.
+	// Defaults to 20.
+	MinConnections int64 `json:"minConnections,omitempty"`
+
+	//+kubebuilder:validation:Minimum=1
+
+	// MaxConnections is the upper bound for `max_connections`.
+	// Defaults to 500.
+	MaxConnections int64 `json:"maxConnections,omitempty"`
+
+	// AllowedSettings are the names of the PostgreSQL settings that instances can set in their PostgresqlSettings.
+	// If empty, instances can set all settings except the DeniedSettings.
+	AllowedSettings []string `json:"allowedSettings,omitempty"`
+
+	// DeniedSettings are the names of the PostgreSQL settings that instances can't set in their PostgresqlSettings.
+	// Settings that run commands, load libraries or change files, directories and ports that the operator relies on are always denied,
+	// for example `archive_command`, `shared_preload_libraries` or `data_directory`.
+	DeniedSettings []string `json:"deniedSettings,omitempty"`
+}
+
+// alwaysDeniedSettings are the PostgreSQL settings that instances can never set, see TuningSpec.DeniedSettings.
+var alwaysDeniedSettings = []string{
+	"archive_cleanup_command", "archive_command", "archive_library", "recovery_end_command", "restore_command", "ssl_passphrase_command",
+	"dynamic_library_path", "local_preload_libraries", "session_preload_libraries", "shared_preload_libraries",
+	"config_file", "data_directory", "external_pid_file", "hba_file", "ident_file", "log_directory", "stats_temp_directory",
+	"ssl_ca_file", "ssl_cert_file", "ssl_crl_dir", "ssl_crl_file", "ssl_dh_params_file", "ssl_key_file",
+	"listen_addresses", "port", "unix_socket_directories", "unix_socket_group", "unix_socket_permissions",
+	"primary_conninfo", "primary_slot_name",
+}
+
+// IsSettingAllowed returns true if instances can set the PostgreSQL setting with the given name.
+// Names are compared case-insensitively, like PostgreSQL does.
+func (in *TuningSpec) IsSettingAllowed(name string) bool {
+	name = strings.ToLower(name)
+	for _, denied := range [][]string{alwaysDeniedSettings, in.DeniedSettings} {
+		for _, deniedName := range denied {
+			if strings.ToLower(deniedName) == name {
+				return false
+			}
+		}
+	}
+	if len(in.AllowedSettings) == 0 {
+		return true
+	}
+	for _, allowed := range in.AllowedSettings {
+		if strings.ToLower(allowed) == name {
+			return true
+		}
+	}
+	return false
+}
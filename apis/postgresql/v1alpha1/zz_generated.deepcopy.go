@@ -90,6 +90,28 @@ func (in *ChartMetaStatus) DeepCopy() *ChartMetaStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudNativePGConfig) DeepCopyInto(out *CloudNativePGConfig) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudNativePGConfig.
+func (in *CloudNativePGConfig) DeepCopy() *CloudNativePGConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudNativePGConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComputeResources) DeepCopyInto(out *ComputeResources) {
 	*out = *in
@@ -98,6 +120,21 @@ func (in *ComputeResources) DeepCopyInto(out *ComputeResources) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.MemoryRequest != nil {
+		in, out := &in.MemoryRequest, &out.MemoryRequest
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.CPULimit != nil {
+		in, out := &in.CPULimit, &out.CPULimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.CPURequest != nil {
+		in, out := &in.CPURequest, &out.CPURequest
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComputeResources.
@@ -141,6 +178,38 @@ func (in *ConnectionSecretRef) DeepCopy() *ConnectionSecretRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeploymentNamespaceConfig) DeepCopyInto(out *DeploymentNamespaceConfig) {
+	*out = *in
+	if in.PodSecurityLabels != nil {
+		in, out := &in.PodSecurityLabels, &out.PodSecurityLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = new(ResourceQuotaTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LimitRange != nil {
+		in, out := &in.LimitRange, &out.LimitRange
+		*out = new(v1.LimitRangeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeploymentNamespaceConfig.
+func (in *DeploymentNamespaceConfig) DeepCopy() *DeploymentNamespaceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(DeploymentNamespaceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GenerationStatus) DeepCopyInto(out *GenerationStatus) {
 	*out = *in
@@ -173,6 +242,51 @@ func (in *HelmReleaseConfig) DeepCopy() *HelmReleaseConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseConflict) DeepCopyInto(out *HelmReleaseConflict) {
+	*out = *in
+	if in.Ignored != nil {
+		in, out := &in.Ignored, &out.Ignored
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseConflict.
+func (in *HelmReleaseConflict) DeepCopy() *HelmReleaseConflict {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseConflict)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataPropagationSpec) DeepCopyInto(out *MetadataPropagationSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataPropagationSpec.
+func (in *MetadataPropagationSpec) DeepCopy() *MetadataPropagationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataPropagationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PersistenceSpec) DeepCopyInto(out *PersistenceSpec) {
 	*out = *in
@@ -186,6 +300,11 @@ func (in *PersistenceSpec) DeepCopyInto(out *PersistenceSpec) {
 		*out = make([]v1.PersistentVolumeAccessMode, len(*in))
 		copy(*out, *in)
 	}
+	if in.AllowedStorageClasses != nil {
+		in, out := &in.AllowedStorageClasses, &out.AllowedStorageClasses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PersistenceSpec.
@@ -198,6 +317,25 @@ func (in *PersistenceSpec) DeepCopy() *PersistenceSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Plan) DeepCopyInto(out *Plan) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+	out.Backup = in.Backup
+	in.Scheduling.DeepCopyInto(&out.Scheduling)
+	in.HelmValues.DeepCopyInto(&out.HelmValues)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Plan.
+func (in *Plan) DeepCopy() *Plan {
+	if in == nil {
+		return nil
+	}
+	out := new(Plan)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgresqlStandalone) DeepCopyInto(out *PostgresqlStandalone) {
 	*out = *in
@@ -228,6 +366,19 @@ func (in *PostgresqlStandalone) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PostgresqlStandaloneConfigStatus) DeepCopyInto(out *PostgresqlStandaloneConfigStatus) {
 	*out = *in
+	out.GenerationStatus = in.GenerationStatus
+	if in.HelmReleaseConflicts != nil {
+		in, out := &in.HelmReleaseConflicts, &out.HelmReleaseConflicts
+		*out = make([]HelmReleaseConflict, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgresqlStandaloneConfigStatus.
@@ -280,6 +431,28 @@ func (in *PostgresqlStandaloneObservation) DeepCopyInto(out *PostgresqlStandalon
 		*out = new(ChartMetaStatus)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.DerivedSettings != nil {
+		in, out := &in.DerivedSettings, &out.DerivedSettings
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.StorageMigration != nil {
+		in, out := &in.StorageMigration, &out.StorageMigration
+		*out = new(StorageMigrationStatus)
+		**out = **in
+	}
+	if in.StorageCapacity != nil {
+		in, out := &in.StorageCapacity, &out.StorageCapacity
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.StorageAutoscaling != nil {
+		in, out := &in.StorageAutoscaling, &out.StorageAutoscaling
+		*out = new(StorageAutoscalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgresqlStandaloneObservation.
@@ -298,7 +471,7 @@ func (in *PostgresqlStandaloneOperatorConfig) DeepCopyInto(out *PostgresqlStanda
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgresqlStandaloneOperatorConfig.
@@ -356,6 +529,16 @@ func (in *PostgresqlStandaloneOperatorConfigSpec) DeepCopyInto(out *PostgresqlSt
 	*out = *in
 	in.ResourceMinima.DeepCopyInto(&out.ResourceMinima)
 	in.ResourceMaxima.DeepCopyInto(&out.ResourceMaxima)
+	out.ResourceRatio = in.ResourceRatio
+	in.Tuning.DeepCopyInto(&out.Tuning)
+	if in.Plans != nil {
+		in, out := &in.Plans, &out.Plans
+		*out = make([]Plan, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Scheduling.DeepCopyInto(&out.Scheduling)
 	if in.HelmReleaseTemplate != nil {
 		in, out := &in.HelmReleaseTemplate, &out.HelmReleaseTemplate
 		*out = new(HelmReleaseConfig)
@@ -368,7 +551,24 @@ func (in *PostgresqlStandaloneOperatorConfigSpec) DeepCopyInto(out *PostgresqlSt
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.StatefulSet != nil {
+		in, out := &in.StatefulSet, &out.StatefulSet
+		*out = new(StatefulSetConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CloudNativePG != nil {
+		in, out := &in.CloudNativePG, &out.CloudNativePG
+		*out = new(CloudNativePGConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Persistence.DeepCopyInto(&out.Persistence)
+	in.DeploymentNamespace.DeepCopyInto(&out.DeploymentNamespace)
+	in.MetadataPropagation.DeepCopyInto(&out.MetadataPropagation)
 	in.BackupConfigSpec.DeepCopyInto(&out.BackupConfigSpec)
 }
 
@@ -386,6 +586,13 @@ func (in *PostgresqlStandaloneOperatorConfigSpec) DeepCopy() *PostgresqlStandalo
 func (in *PostgresqlStandaloneParameters) DeepCopyInto(out *PostgresqlStandaloneParameters) {
 	*out = *in
 	in.Resources.DeepCopyInto(&out.Resources)
+	if in.PostgresqlSettings != nil {
+		in, out := &in.PostgresqlSettings, &out.PostgresqlSettings
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostgresqlStandaloneParameters.
@@ -440,6 +647,43 @@ func (in *PostgresqlStandaloneStatus) DeepCopy() *PostgresqlStandaloneStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceQuotaTemplate) DeepCopyInto(out *ResourceQuotaTemplate) {
+	*out = *in
+	if in.Hard != nil {
+		in, out := &in.Hard, &out.Hard
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceQuotaTemplate.
+func (in *ResourceQuotaTemplate) DeepCopy() *ResourceQuotaTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceQuotaTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceRatio) DeepCopyInto(out *ResourceRatio) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRatio.
+func (in *ResourceRatio) DeepCopy() *ResourceRatio {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceRatio)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Resources) DeepCopyInto(out *Resources) {
 	*out = *in
@@ -457,6 +701,61 @@ func (in *Resources) DeepCopy() *Resources {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutSpec) DeepCopyInto(out *RolloutSpec) {
+	*out = *in
+	if in.CanarySelector != nil {
+		in, out := &in.CanarySelector, &out.CanarySelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BatchPercentages != nil {
+		in, out := &in.BatchPercentages, &out.BatchPercentages
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	out.PauseBetweenBatches = in.PauseBetweenBatches
+	out.ProgressDeadline = in.ProgressDeadline
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutSpec.
+func (in *RolloutSpec) DeepCopy() *RolloutSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStatus) DeepCopyInto(out *RolloutStatus) {
+	*out = *in
+	if in.FailedInstances != nil {
+		in, out := &in.FailedInstances, &out.FailedInstances
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BatchStartedAt != nil {
+		in, out := &in.BatchStartedAt, &out.BatchStartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.BatchCompletedAt != nil {
+		in, out := &in.BatchCompletedAt, &out.BatchCompletedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStatus.
+func (in *RolloutStatus) DeepCopy() *RolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *S3BucketConfigSpec) DeepCopyInto(out *S3BucketConfigSpec) {
 	*out = *in
@@ -476,6 +775,146 @@ func (in *S3BucketConfigSpec) DeepCopy() *S3BucketConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchedulingSpec) DeepCopyInto(out *SchedulingSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]v1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchedulingSpec.
+func (in *SchedulingSpec) DeepCopy() *SchedulingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SchedulingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatefulSetConfig) DeepCopyInto(out *StatefulSetConfig) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatefulSetConfig.
+func (in *StatefulSetConfig) DeepCopy() *StatefulSetConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StatefulSetConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageAutoscaling) DeepCopyInto(out *StorageAutoscaling) {
+	*out = *in
+	out.Increment = in.Increment.DeepCopy()
+	if in.Maximum != nil {
+		in, out := &in.Maximum, &out.Maximum
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageAutoscaling.
+func (in *StorageAutoscaling) DeepCopy() *StorageAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageAutoscalingStatus) DeepCopyInto(out *StorageAutoscalingStatus) {
+	*out = *in
+	in.LastObservedTime.DeepCopyInto(&out.LastObservedTime)
+	if in.Resizes != nil {
+		in, out := &in.Resizes, &out.Resizes
+		*out = make([]StorageResize, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageAutoscalingStatus.
+func (in *StorageAutoscalingStatus) DeepCopy() *StorageAutoscalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageAutoscalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageMigrationStatus) DeepCopyInto(out *StorageMigrationStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageMigrationStatus.
+func (in *StorageMigrationStatus) DeepCopy() *StorageMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageResize) DeepCopyInto(out *StorageResize) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	out.PreviousCapacity = in.PreviousCapacity.DeepCopy()
+	out.Capacity = in.Capacity.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageResize.
+func (in *StorageResize) DeepCopy() *StorageResize {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageResize)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StorageResources) DeepCopyInto(out *StorageResources) {
 	*out = *in
@@ -484,6 +923,11 @@ func (in *StorageResources) DeepCopyInto(out *StorageResources) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.StorageAutoscaling != nil {
+		in, out := &in.StorageAutoscaling, &out.StorageAutoscaling
+		*out = new(StorageAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageResources.
@@ -495,3 +939,28 @@ func (in *StorageResources) DeepCopy() *StorageResources {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TuningSpec) DeepCopyInto(out *TuningSpec) {
+	*out = *in
+	if in.AllowedSettings != nil {
+		in, out := &in.AllowedSettings, &out.AllowedSettings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedSettings != nil {
+		in, out := &in.DeniedSettings, &out.DeniedSettings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TuningSpec.
+func (in *TuningSpec) DeepCopy() *TuningSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TuningSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -1,9 +1,14 @@
 package helmvalues
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"sort"
+
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -67,6 +72,60 @@ func MustHashSum(from runtime.RawExtension) uint32 {
 	return h.Sum32()
 }
 
+// CanonicalHashSum returns the SHA-256 hash sum of the values in hex format.
+// Unlike MustHashSum, values that are semantically equal have the same hash sum regardless of the order of their keys.
+func CanonicalHashSum(v V) (string, error) {
+	// json.Marshal sorts the keys of maps.
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Diff returns the paths of all values that are different in the given values, sorted alphabetically.
+// Keys that exist only in one of the values are considered different as well.
+// The keys of nested values are delimited with a dot, e.g. `primary.resources.limits.memory`.
+func Diff(a, b V) []string {
+	paths := make([]string, 0)
+	diff("", a, b, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func diff(prefix string, a, b map[string]interface{}, paths *[]string) {
+	for key, aVal := range a {
+		path := prefix + key
+		bVal, exists := b[key]
+		if !exists {
+			*paths = append(*paths, path)
+			continue
+		}
+		aMap, aIsMap := aVal.(map[string]interface{})
+		bMap, bIsMap := bVal.(map[string]interface{})
+		if aIsMap && bIsMap {
+			diff(path+".", aMap, bMap, paths)
+			continue
+		}
+		if !jsonEqual(aVal, bVal) {
+			*paths = append(*paths, path)
+		}
+	}
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			*paths = append(*paths, prefix+key)
+		}
+	}
+}
+
+// jsonEqual compares the values by their JSON representation, so that e.g. an int and a float64 with the same value are equal.
+func jsonEqual(a, b interface{}) bool {
+	aRaw, aErr := json.Marshal(a)
+	bRaw, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aRaw, bRaw)
+}
+
 // Copied from github.com/knadh/koanf/maps/maps.go (v1.4.1)
 // Modified so that empty maps in map 'a' overwrite existing maps in 'b'.
 // (https://github.com/knadh/koanf/blob/516880fe32716d1b03e95a5ba844b6a3c8fba2a1/maps/maps.go#L107)
@@ -227,3 +227,51 @@ func TestMustHashSum(t *testing.T) {
 	result := MustHashSum(runtime.RawExtension{Raw: []byte((`{"key":"value"}`))})
 	assert.Equal(t, uint32(0x5b495ab5), result)
 }
+
+func TestHelmValues_CanonicalHashSum(t *testing.T) {
+	first := V{}
+	second := V{}
+	MustUnmarshal(runtime.RawExtension{Raw: []byte(`{"key":"value","nested":{"a":1,"b":true}}`)}, &first)
+	MustUnmarshal(runtime.RawExtension{Raw: []byte(`{"nested":{"b":true,"a":1.0},"key":"value"}`)}, &second)
+
+	firstHash, err := CanonicalHashSum(first)
+	require.NoError(t, err)
+	secondHash, err := CanonicalHashSum(second)
+	require.NoError(t, err)
+	assert.Equal(t, firstHash, secondHash, "hash of equal values in different order")
+
+	second["key"] = "changed"
+	changedHash, err := CanonicalHashSum(second)
+	require.NoError(t, err)
+	assert.NotEqual(t, firstHash, changedHash, "hash of changed values")
+}
+
+func TestHelmValues_Diff(t *testing.T) {
+	tests := map[string]struct {
+		givenA        V
+		givenB        V
+		expectedPaths []string
+	}{
+		"GivenEqualValues_ThenExpectNoPaths": {
+			givenA:        V{"key": "value", "nested": V{"number": 1}},
+			givenB:        V{"key": "value", "nested": V{"number": float64(1)}},
+			expectedPaths: []string{},
+		},
+		"GivenChangedNestedValue_ThenExpectPath": {
+			givenA:        V{"primary": V{"resources": V{"limits": V{"memory": "1Gi"}}}},
+			givenB:        V{"primary": V{"resources": V{"limits": V{"memory": "2Gi"}}}},
+			expectedPaths: []string{"primary.resources.limits.memory"},
+		},
+		"GivenAddedAndRemovedKeys_ThenExpectSortedPaths": {
+			givenA:        V{"removed": "value", "nested": V{"key": "value"}},
+			givenB:        V{"added": "value", "nested": "not a map"},
+			expectedPaths: []string{"added", "nested", "removed"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := Diff(tc.givenA, tc.givenB)
+			assert.Equal(t, tc.expectedPaths, result)
+		})
+	}
+}
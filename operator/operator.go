@@ -8,7 +8,9 @@ import (
 // SetupControllers creates all Postgresql controllers with the supplied logger and adds them to the supplied manager.
 func SetupControllers(mgr ctrl.Manager) error {
 	for _, setup := range []func(ctrl.Manager) error{
+		standalone.SetupFieldIndexes,
 		standalone.SetupController,
+		standalone.SetupConfigController,
 	} {
 		if err := setup(mgr); err != nil {
 			return err
@@ -0,0 +1,49 @@
+package standalone
+
+import (
+	"context"
+	"time"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/steps"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// OperatorConfigReconciler reconciles v1alpha1.PostgresqlStandaloneOperatorConfig.
+// It rolls out new chart versions to existing instances and reports the progress and problems in the status of the config.
+type OperatorConfigReconciler struct {
+	client client.Client
+}
+
+// Reconcile implements reconcile.Reconciler.
+func (r *OperatorConfigReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	ctx = pipeline.MutableContext(ctx)
+	steps.SetClientInContext(ctx, r.client)
+	log := ctrl.LoggerFrom(ctx)
+	log.V(1).Info("Reconciling")
+	obj := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+	err := r.client.Get(ctx, request.NamespacedName, obj)
+	if err != nil && apierrors.IsNotFound(err) {
+		// doesn't exist anymore, nothing to do
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		// some other error
+		return reconcile.Result{}, err
+	}
+	pipeline.StoreInContext(ctx, steps.ConfigKey{}, obj)
+	err = pipeline.NewPipeline().
+		WithSteps(
+			pipeline.NewStepFromFunc("reconcile rollout", steps.ReconcileRolloutFn()),
+			pipeline.NewStepFromFunc("update status", steps.UpdateOperatorConfigStatusFn()),
+		).
+		RunWithContext(ctx).Err()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: steps.RolloutRequeueAfter(obj, time.Now())}, nil
+}
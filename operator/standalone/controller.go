@@ -2,6 +2,7 @@ package standalone
 
 import (
 	"context"
+	"fmt"
 	"github.com/vshn/appcat-service-postgresql/operator/steps"
 	"strings"
 	"time"
@@ -9,8 +10,10 @@ import (
 	pipeline "github.com/ccremer/go-command-pipeline"
 	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -21,8 +24,26 @@ var finalizer = strings.ToLower(strings.ReplaceAll(v1alpha1.PostgresqlStandalone
 var (
 	// OperatorNamespace is the namespace where the controller looks for v1alpha1.PostgresqlStandaloneOperatorConfig.
 	OperatorNamespace = ""
+	// OperatorServiceAccount is the name of the service account in the OperatorNamespace that the operator runs with.
+	// If empty, all service accounts in the OperatorNamespace are considered to be the operator, see NamespaceGuard.
+	OperatorServiceAccount = ""
 	// ServiceNamespacePrefix is the namespace prefix which the controller uses to create the namespaces where the PostgreSQL instances are actually deployed in.
 	ServiceNamespacePrefix = "sv-postgresql-s-"
+	// NamespaceNamingScheme is the scheme of the names of the namespaces where the PostgreSQL instances are deployed in.
+	// It's either NamingSchemeCodename, NamingSchemeHash or a template, see ValidateNamespaceNamingScheme.
+	NamespaceNamingScheme = NamingSchemeCodename
+	// TrustedUsers are the users besides the operator that are allowed to change the resources in the deployment namespaces, see NamespaceGuard.
+	TrustedUsers = []string{}
+	// TrustedServiceAccountNamespaces are the namespaces whose service accounts are allowed to change the resources in the deployment namespaces, see NamespaceGuard.
+	// These are the namespaces of the controllers that deploy or back up the instances, like provider-helm, CloudNativePG, K8up or CSI drivers.
+	// The service accounts are trusted by namespace, since their names can change, for example provider-helm runs with a service account per package revision by default.
+	TrustedServiceAccountNamespaces = []string{"crossplane-system", "cnpg-system"}
+	// AdminGroups are the groups of platform admins, which are allowed to make changes that are forbidden for regular users.
+	AdminGroups = []string{"system:masters"}
+	// HelmCacheDir is the directory where the HelmSDK deployment strategy caches downloaded charts and repository indexes.
+	HelmCacheDir = "/tmp/helm"
+	// StorageAutoscalingInterval is the interval in which the storage usage of instances with storage autoscaling is checked.
+	StorageAutoscalingInterval = 5 * time.Minute
 )
 
 // +kubebuilder:rbac:groups=postgresql.appcat.vshn.io,resources=postgresqlstandalones,verbs=get;list;watch;create;update;patch;delete
@@ -33,21 +54,38 @@ var (
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services;configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=resourcequotas;limitranges,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=nodes/proxy,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;create;update
 // +kubebuilder:rbac:groups=helm.crossplane.io,resources=releases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=helm.crossplane.io,resources=providerconfigs,verbs=get;list;watch
 // +kubebuilder:rbac:groups=k8up.io,resources=schedules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=postgresql.cnpg.io,resources=clusters,verbs=get;list;watch;create;update;patch;delete
 
 // PostgresStandaloneReconciler reconciles v1alpha1.PostgresqlStandalone.
 type PostgresStandaloneReconciler struct {
-	client client.Client
+	client            client.Client
+	recorder          record.EventRecorder
+	volumeUsageReader steps.VolumeUsageReader
 }
 
 // Reconcile implements reconcile.Reconciler.
 func (r *PostgresStandaloneReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
 	ctx = pipeline.MutableContext(ctx)
 	steps.SetClientInContext(ctx, r.client)
+	if r.recorder != nil {
+		pipeline.StoreInContext(ctx, steps.EventRecorderKey{}, r.recorder)
+	}
+	if r.volumeUsageReader != nil {
+		pipeline.StoreInContext(ctx, steps.VolumeUsageReaderKey{}, r.volumeUsageReader)
+	}
 	obj := &v1alpha1.PostgresqlStandalone{}
 	steps.SetInstanceInContext(ctx, obj)
 	log := ctrl.LoggerFrom(ctx)
@@ -61,12 +99,43 @@ func (r *PostgresStandaloneReconciler) Reconcile(ctx context.Context, request re
 		// some other error
 		return reconcile.Result{}, err
 	}
+	if paused, err := r.pauseIfRequested(ctx, obj); paused || err != nil {
+		return reconcile.Result{}, err
+	}
 	if !obj.DeletionTimestamp.IsZero() {
 		return r.DeleteDeployment(ctx)
 	}
 	return r.ProvisionDeployment(ctx, obj)
 }
 
+// pauseIfRequested sets the Paused condition and returns true if the instance or its namespace has the v1alpha1.PausedAnnotationKey annotation.
+// Neither the provisioning nor the deletion of a paused instance is reconciled, so that the deployed resources can be changed manually.
+// Otherwise, the Paused condition is removed, the status is persisted by the pipeline that runs next.
+func (r *PostgresStandaloneReconciler) pauseIfRequested(ctx context.Context, instance *v1alpha1.PostgresqlStandalone) (bool, error) {
+	message := ""
+	if v1alpha1.IsPaused(instance) {
+		message = fmt.Sprintf("Reconciliation is paused by the annotation %s on the instance", v1alpha1.PausedAnnotationKey)
+	} else {
+		ns := &corev1.Namespace{}
+		if err := r.client.Get(ctx, client.ObjectKey{Name: instance.Namespace}, ns); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+		if v1alpha1.IsPaused(ns) {
+			message = fmt.Sprintf("Reconciliation is paused by the annotation %s on the namespace %s", v1alpha1.PausedAnnotationKey, ns.Name)
+		}
+	}
+	if message == "" {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, conditions.TypePaused)
+		return false, nil
+	}
+	if condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypePaused); condition != nil && condition.Message == message {
+		return true, nil
+	}
+	ctrl.LoggerFrom(ctx).Info("Reconciliation is paused")
+	meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(conditions.Paused(message)).WithGeneration(instance).Build())
+	return true, r.client.Status().Update(ctx, instance)
+}
+
 // ProvisionDeployment reconciles the given instance
 func (r *PostgresStandaloneReconciler) ProvisionDeployment(ctx context.Context, instance *v1alpha1.PostgresqlStandalone) (reconcile.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
@@ -78,8 +147,12 @@ func (r *PostgresStandaloneReconciler) ProvisionDeployment(ctx context.Context,
 	}
 	if !meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeReady) {
 		// The instance has provisioned all the resources, now we'll have to wait until everything is ready.
+		// There's no need to requeue, the controller watches the deployed resources and gets notified once they become ready.
 		log.Info("Waiting until instance becomes ready")
-		return reconcile.Result{RequeueAfter: 2 * time.Second}, nil
+	}
+	if instance.Spec.Parameters.Resources.StorageAutoscaling != nil {
+		// The usage of the storage changes without any change to the watched resources.
+		return reconcile.Result{RequeueAfter: StorageAutoscalingInterval}, nil
 	}
 	return reconcile.Result{}, nil
 }
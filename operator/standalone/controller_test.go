@@ -0,0 +1,88 @@
+package standalone
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPostgresStandaloneReconciler_PauseIfRequested(t *testing.T) {
+	tests := map[string]struct {
+		givenInstanceAnnotations  map[string]string
+		givenNamespaceAnnotations map[string]string
+		givenCondition            bool
+		expectedPaused            bool
+		expectedMessage           string
+	}{
+		"GivenNoAnnotation_ThenExpectNotPaused": {},
+		"GivenNoAnnotation_WhenPreviouslyPaused_ThenExpectConditionRemoved": {
+			givenCondition: true,
+		},
+		"GivenInstanceAnnotation_ThenExpectPaused": {
+			givenInstanceAnnotations: map[string]string{v1alpha1.PausedAnnotationKey: "true"},
+			expectedPaused:           true,
+			expectedMessage:          "Reconciliation is paused by the annotation postgresql.appcat.vshn.io/paused on the instance",
+		},
+		"GivenNamespaceAnnotation_ThenExpectPaused": {
+			givenNamespaceAnnotations: map[string]string{v1alpha1.PausedAnnotationKey: "true"},
+			expectedPaused:            true,
+			expectedMessage:           "Reconciliation is paused by the annotation postgresql.appcat.vshn.io/paused on the namespace my-app",
+		},
+		"GivenAnnotationWithOtherValue_ThenExpectNotPaused": {
+			givenInstanceAnnotations: map[string]string{v1alpha1.PausedAnnotationKey: "false"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			require.NoError(t, corev1.AddToScheme(scheme))
+			instance := &v1alpha1.PostgresqlStandalone{ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "my-app", Annotations: tc.givenInstanceAnnotations}}
+			if tc.givenCondition {
+				meta.SetStatusCondition(&instance.Status.Conditions, conditions.Paused("paused"))
+			}
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Annotations: tc.givenNamespaceAnnotations}}
+			r := &PostgresStandaloneReconciler{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(instance, ns).Build()}
+
+			// Act
+			paused, err := r.pauseIfRequested(context.Background(), instance)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPaused, paused, "paused")
+			condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypePaused)
+			if !tc.expectedPaused {
+				assert.Nil(t, condition, "paused condition")
+				return
+			}
+			require.NotNil(t, condition, "paused condition")
+			assert.Equal(t, tc.expectedMessage, condition.Message)
+		})
+	}
+}
+
+func TestMapNamespaceToInstances(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, apis.AddToScheme(scheme))
+	kube := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.PostgresqlStandalone{ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "my-app"}},
+		&v1alpha1.PostgresqlStandalone{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other-app"}},
+	).Build()
+
+	result := mapNamespaceToInstancesFn(kube)(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "my-app"}})
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "instance", Namespace: "my-app"}}}, result)
+}
@@ -16,12 +16,12 @@ func NewDeleteStandalonePipeline() *DeleteStandalonePipeline {
 
 // RunPipeline executes the pipeline with configured business logic steps.
 // The pipeline requires multiple reconciliations due to asynchronous deletion of resources in background
-// The Helm Release step requires a complete removal of its resources before moving to the next step
+// The deployment step requires a complete removal of its resources before moving to the next step
 func (d *DeleteStandalonePipeline) RunPipeline(ctx context.Context) error {
 	return pipeline.NewPipeline().
 		WithSteps(
 			pipeline.NewStepFromFunc("delete connection secret", steps.DeleteConnectionSecretFn()),
-			pipeline.NewStepFromFunc("delete helm release", steps.DeleteHelmReleaseFn()),
+			pipeline.NewStepFromFunc("delete deployment", steps.DeleteDeploymentFn()),
 			pipeline.NewStepFromFunc("delete pvc", steps.DeletePvcFn()),
 			pipeline.NewStepFromFunc("delete namespace", steps.DeleteNamespaceFn()),
 			pipeline.NewStepFromFunc("remove finalizer", steps.RemoveFinalizerFn(finalizer)),
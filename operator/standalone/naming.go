@@ -0,0 +1,142 @@
+package standalone
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/lucasepe/codename"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/steps"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Naming schemes of the namespaces where the PostgreSQL instances are deployed in, see NamespaceNamingScheme.
+const (
+	// NamingSchemeCodename appends a random codename to the ServiceNamespacePrefix, e.g. `sv-postgresql-s-merry-vigilante-7b16`.
+	NamingSchemeCodename = "codename"
+	// NamingSchemeHash appends a hash of the namespace and name of the instance to the ServiceNamespacePrefix, e.g. `sv-postgresql-s-6b1c2a3f9e`.
+	NamingSchemeHash = "hash"
+)
+
+// Placeholders of a NamespaceNamingScheme template.
+const (
+	prefixPlaceholder    = "{prefix}"
+	orgPlaceholder       = "{org}"
+	namespacePlaceholder = "{namespace}"
+	namePlaceholder      = "{name}"
+)
+
+const (
+	// maxNamingAttempts is the number of names that are tried until a name is found that isn't taken by an existing namespace.
+	maxNamingAttempts = 10
+	// maxNamespaceNameLength is the maximum length of a namespace name.
+	maxNamespaceNameLength = 63
+	// hashLength is the number of hexadecimal characters of the hashes in names.
+	hashLength = 10
+)
+
+var (
+	namegeneratorRNG      *rand.Rand
+	placeholderRegex      = regexp.MustCompile(`{[^}]*}`)
+	invalidNameCharsRegex = regexp.MustCompile(`[^a-z0-9-]+`)
+	repeatedDashesRegex   = regexp.MustCompile(`-{2,}`)
+)
+
+func init() {
+	rng, err := codename.DefaultRNG()
+	if err != nil {
+		panic(err)
+	}
+	namegeneratorRNG = rng
+}
+
+// ValidateNamespaceNamingScheme returns an error if the given scheme is neither NamingSchemeCodename, NamingSchemeHash nor a valid template.
+// A template contains the placeholders `{prefix}`, `{org}`, `{namespace}` and `{name}`, which are replaced by the ServiceNamespacePrefix,
+// the APPUiO organization of the namespace of the instance, and the namespace and name of the instance.
+// It has to contain `{name}`, so that the instances in a namespace get different names.
+func ValidateNamespaceNamingScheme(scheme string) error {
+	if scheme == NamingSchemeCodename || scheme == NamingSchemeHash {
+		return nil
+	}
+	for _, placeholder := range placeholderRegex.FindAllString(scheme, -1) {
+		switch placeholder {
+		case prefixPlaceholder, orgPlaceholder, namespacePlaceholder, namePlaceholder:
+		default:
+			return fmt.Errorf("namespace naming template %q contains unknown placeholder %s", scheme, placeholder)
+		}
+	}
+	if !strings.Contains(scheme, namePlaceholder) {
+		return fmt.Errorf("namespace naming scheme %q is neither %q, %q nor a template that contains %s", scheme, NamingSchemeCodename, NamingSchemeHash, namePlaceholder)
+	}
+	return nil
+}
+
+// generateDeploymentNamespaceName returns a name for a new deployment namespace of the instance according to the NamespaceNamingScheme,
+// that isn't taken by an existing namespace.
+// If the name is taken, another codename is generated, or a deterministic name gets a numbered suffix, e.g. `-2`.
+// It returns an error if no free name is found after maxNamingAttempts.
+func generateDeploymentNamespaceName(ctx context.Context, instance *v1alpha1.PostgresqlStandalone) (string, error) {
+	kube := steps.GetClientFromContext(ctx)
+	org := ""
+	if ns, exists := pipeline.LoadFromContext(ctx, steps.InstanceNamespaceKey{}); exists {
+		org = ns.(*corev1.Namespace).Labels[steps.AppuioOrganizationLabelKey]
+	}
+
+	for attempt := 1; attempt <= maxNamingAttempts; attempt++ {
+		name := renderNamespaceName(NamespaceNamingScheme, instance, org, attempt)
+		err := kube.Get(ctx, client.ObjectKey{Name: name}, &corev1.Namespace{})
+		if apierrors.IsNotFound(err) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("cannot find a deployment namespace name that isn't taken after %d attempts", maxNamingAttempts)
+}
+
+// renderNamespaceName returns the name of the given attempt according to the given scheme.
+// The name is turned into a valid namespace name, see sanitizeNamespaceName.
+func renderNamespaceName(scheme string, instance *v1alpha1.PostgresqlStandalone, org string, attempt int) string {
+	suffix := ""
+	var name string
+	switch scheme {
+	case NamingSchemeCodename:
+		name = ServiceNamespacePrefix + codename.Generate(namegeneratorRNG, 4)
+	case NamingSchemeHash:
+		name = ServiceNamespacePrefix + hashString(instance.Namespace+"/"+instance.Name)
+	default:
+		name = strings.NewReplacer(
+			prefixPlaceholder, ServiceNamespacePrefix,
+			orgPlaceholder, org,
+			namespacePlaceholder, instance.Namespace,
+			namePlaceholder, instance.Name,
+		).Replace(scheme)
+	}
+	if scheme != NamingSchemeCodename && attempt > 1 {
+		suffix = fmt.Sprintf("-%d", attempt)
+	}
+	return sanitizeNamespaceName(name, maxNamespaceNameLength-len(suffix)) + suffix
+}
+
+// sanitizeNamespaceName returns the given name in lower case, with invalid characters replaced by dashes and without leading, trailing or repeated dashes.
+// Names that are longer than maxLength are shortened and get a hash of the full name as suffix, so that they stay unique.
+func sanitizeNamespaceName(name string, maxLength int) string {
+	sanitized := invalidNameCharsRegex.ReplaceAllString(strings.ToLower(name), "-")
+	sanitized = strings.Trim(repeatedDashesRegex.ReplaceAllString(sanitized, "-"), "-")
+	if len(sanitized) <= maxLength {
+		return sanitized
+	}
+	return strings.TrimRight(sanitized[:maxLength-hashLength-1], "-") + "-" + hashString(name)
+}
+
+func hashString(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))[:hashLength]
+}
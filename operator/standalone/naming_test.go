@@ -0,0 +1,166 @@
+package standalone
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/steps"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateNamespaceNamingScheme(t *testing.T) {
+	tests := map[string]struct {
+		givenScheme   string
+		expectedError string
+	}{
+		"GivenCodename_ThenExpectNoError": {
+			givenScheme: NamingSchemeCodename,
+		},
+		"GivenHash_ThenExpectNoError": {
+			givenScheme: NamingSchemeHash,
+		},
+		"GivenTemplate_ThenExpectNoError": {
+			givenScheme: "{prefix}{org}-{namespace}-{name}",
+		},
+		"GivenTemplateWithoutName_ThenExpectError": {
+			givenScheme:   "{prefix}{org}",
+			expectedError: `namespace naming scheme "{prefix}{org}" is neither "codename", "hash" nor a template that contains {name}`,
+		},
+		"GivenTemplateWithUnknownPlaceholder_ThenExpectError": {
+			givenScheme:   "{prefix}{cluster}-{name}",
+			expectedError: `namespace naming template "{prefix}{cluster}-{name}" contains unknown placeholder {cluster}`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateNamespaceNamingScheme(tc.givenScheme)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRenderNamespaceName(t *testing.T) {
+	instance := &v1alpha1.PostgresqlStandalone{ObjectMeta: metav1.ObjectMeta{Name: "My_Instance", Namespace: "my-app"}}
+	tests := map[string]struct {
+		givenScheme   string
+		givenOrg      string
+		givenAttempt  int
+		expectedName  string
+		expectedRegex string
+	}{
+		"GivenCodename_ThenExpectRandomNameWithPrefix": {
+			givenScheme:   NamingSchemeCodename,
+			givenAttempt:  2,
+			expectedRegex: `^sv-postgresql-s-[a-z-]+-[0-9a-f]{4}$`,
+		},
+		"GivenHash_ThenExpectHashOfNamespaceAndName": {
+			givenScheme:  NamingSchemeHash,
+			givenAttempt: 1,
+			expectedName: "sv-postgresql-s-" + hashString("my-app/My_Instance"),
+		},
+		"GivenHash_WhenRetrying_ThenExpectSuffix": {
+			givenScheme:  NamingSchemeHash,
+			givenAttempt: 3,
+			expectedName: "sv-postgresql-s-" + hashString("my-app/My_Instance") + "-3",
+		},
+		"GivenTemplate_ThenExpectSanitizedName": {
+			givenScheme:  "{prefix}{org}-{name}",
+			givenOrg:     "Acme",
+			givenAttempt: 1,
+			expectedName: "sv-postgresql-s-acme-my-instance",
+		},
+		"GivenTemplate_WhenOrganizationMissing_ThenExpectNoRepeatedDashes": {
+			givenScheme:  "{prefix}{org}-{name}",
+			givenAttempt: 1,
+			expectedName: "sv-postgresql-s-my-instance",
+		},
+		"GivenTemplate_WhenNameTooLong_ThenExpectShortenedNameWithHash": {
+			givenScheme:  "{prefix}{org}-{name}",
+			givenOrg:     strings.Repeat("a", 60),
+			givenAttempt: 2,
+			expectedName: "sv-postgresql-s-" + strings.Repeat("a", 34) + "-" + hashString("sv-postgresql-s-"+strings.Repeat("a", 60)+"-My_Instance") + "-2",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := renderNamespaceName(tc.givenScheme, instance, tc.givenOrg, tc.givenAttempt)
+			assert.LessOrEqual(t, len(result), maxNamespaceNameLength)
+			if tc.expectedRegex != "" {
+				assert.Regexp(t, tc.expectedRegex, result)
+				return
+			}
+			assert.Equal(t, tc.expectedName, result)
+		})
+	}
+}
+
+func TestGenerateDeploymentNamespaceName(t *testing.T) {
+	tests := map[string]struct {
+		givenScheme     string
+		givenNamespaces []string
+		expectedName    string
+		expectedError   string
+	}{
+		"GivenTemplate_WhenNameIsFree_ThenExpectName": {
+			givenScheme:  "{prefix}{org}-{name}",
+			expectedName: "sv-postgresql-s-acme-instance",
+		},
+		"GivenTemplate_WhenNameIsTaken_ThenExpectSuffix": {
+			givenScheme:     "{prefix}{org}-{name}",
+			givenNamespaces: []string{"sv-postgresql-s-acme-instance", "sv-postgresql-s-acme-instance-2"},
+			expectedName:    "sv-postgresql-s-acme-instance-3",
+		},
+		"GivenTemplate_WhenAllNamesAreTaken_ThenExpectError": {
+			givenScheme: "{prefix}{org}-{name}",
+			givenNamespaces: []string{
+				"sv-postgresql-s-acme-instance", "sv-postgresql-s-acme-instance-2", "sv-postgresql-s-acme-instance-3",
+				"sv-postgresql-s-acme-instance-4", "sv-postgresql-s-acme-instance-5", "sv-postgresql-s-acme-instance-6",
+				"sv-postgresql-s-acme-instance-7", "sv-postgresql-s-acme-instance-8", "sv-postgresql-s-acme-instance-9",
+				"sv-postgresql-s-acme-instance-10",
+			},
+			expectedError: "cannot find a deployment namespace name that isn't taken after 10 attempts",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, corev1.AddToScheme(scheme))
+			instanceNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Labels: map[string]string{steps.AppuioOrganizationLabelKey: "acme"}}}
+			objects := []client.Object{instanceNamespace}
+			for _, ns := range tc.givenNamespaces {
+				objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+			}
+			ctx := pipeline.MutableContext(context.Background())
+			steps.SetClientInContext(ctx, fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build())
+			pipeline.StoreInContext(ctx, steps.InstanceNamespaceKey{}, instanceNamespace)
+			defer func(previous string) { NamespaceNamingScheme = previous }(NamespaceNamingScheme)
+			NamespaceNamingScheme = tc.givenScheme
+			instance := &v1alpha1.PostgresqlStandalone{ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "my-app"}}
+
+			// Act
+			result, err := generateDeploymentNamespaceName(ctx, instance)
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedName, result)
+		})
+	}
+}
@@ -5,24 +5,26 @@ import (
 	"fmt"
 	"github.com/vshn/appcat-service-postgresql/operator/steps"
 	"k8s.io/apimachinery/pkg/labels"
-	"math/rand"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"strings"
 
 	pipeline "github.com/ccremer/go-command-pipeline"
-	"github.com/lucasepe/codename"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 )
 
-var namegeneratorRNG *rand.Rand
-
-func init() {
-	rng, err := codename.DefaultRNG()
-	if err != nil {
-		panic(err)
-	}
-	namegeneratorRNG = rng
-}
+// Label keys that are set on all resources that belong to an instance.
+const (
+	// InstanceLabelKey identifies the name of the instance.
+	InstanceLabelKey = "app.kubernetes.io/instance"
+	// InstanceNamespaceLabelKey identifies the namespace of the instance.
+	InstanceNamespaceLabelKey = "app.kubernetes.io/instance-namespace"
+	// ManagedByLabelKey identifies the operator that manages the resource.
+	ManagedByLabelKey = "app.kubernetes.io/managed-by"
+	// InstanceUIDLabelKey identifies the UID of the instance.
+	// Since the UID changes if the instance is restored from a backup, it's only used to tell apart resources of instances with the same name.
+	InstanceUIDLabelKey = "postgresql.appcat.vshn.io/instance-uid"
+)
 
 // CreateStandalonePipeline is a pipeline that creates a new instance in the target deployment namespace.
 // Currently, it's optimized for first-time creation scenarios and may fail when reconciling existing instances.
@@ -41,49 +43,73 @@ func NewStandalonePipeline(operatorNamespace string) *CreateStandalonePipeline {
 // This should only be executed once per pipeline as it stores intermediate results in the struct.
 func (p *CreateStandalonePipeline) Run(ctx context.Context) error {
 	instance := steps.GetInstanceFromContext(ctx)
-	commonLabels := getCommonLabels(instance.Name)
-
-	// TODO: Add APPUiO cloud organization label that identifies ownership.
-	nsLabelSet := labels.Merge(commonLabels, labels.Set{"app.kubernetes.io/instance-namespace": instance.Namespace})
+	commonLabels := getCommonLabels(instance)
 
 	return pipeline.NewPipeline().
 		WithSteps(
 			pipeline.NewStepFromFunc("fetch operator config", steps.FetchOperatorConfigFn(p.operatorNamespace)),
+			pipeline.NewStepFromFunc("discover deployment", steps.DiscoverDeploymentFn(getInstanceSelector(instance), InstanceUIDLabelKey)),
+			pipeline.NewStepFromFunc("select deployment strategy", steps.SelectDeploymentStrategyFn()),
 			pipeline.NewStepFromFunc("fetch instance namespace", steps.FetchNamespaceFn(instance.Namespace, steps.InstanceNamespaceKey{})),
 
 			pipeline.NewStepFromFunc("add finalizer", steps.AddFinalizerFn(instance, finalizer)),
 			pipeline.NewStepFromFunc("mark instance as progressing", steps.MarkInstanceAsProgressingFn()),
 
 			pipeline.NewPipeline().WithNestedSteps("deploy resources",
-				pipeline.NewStepFromFunc("ensure deployment namespace", steps.EnsureNamespace(getDeploymentNamespaceOrGenerate(instance), nsLabelSet)),
-				pipeline.NewStepFromFunc("ensure PVC", steps.EnsurePvcFn(commonLabels)),
+				pipeline.NewStepFromFunc("ensure deployment namespace", ensureDeploymentNamespaceFn(instance, commonLabels)).
+					WithResultHandler(steps.SetConditionFromResultFn(conditions.ResourceReady(conditions.TypeNamespaceReady))),
+				pipeline.NewStepFromFunc("ensure namespace policies", steps.EnsureNamespacePoliciesFn(commonLabels)),
+				pipeline.NewStepFromFunc("ensure PVC", steps.EnsurePvcFn(commonLabels)).
+					WithResultHandler(steps.SetConditionFromResultFn(conditions.ResourceReady(conditions.TypeStorageReady))),
 				pipeline.NewStepFromFunc("ensure credentials secret", steps.EnsureCredentialsSecretFn(commonLabels)),
-				pipeline.NewStepFromFunc("ensure helm release", steps.EnsureHelmReleaseFn(commonLabels)),
-				pipeline.NewStepFromFunc("enrich status with chart meta", steps.EnrichStatusWithHelmChartMetaFn()),
+				pipeline.NewStepFromFunc("ensure deployment", steps.EnsureDeploymentFn(commonLabels)).
+					WithErrorHandler(steps.SetConditionFromErrorFn(conditions.TypeReleaseReady)),
+				pipeline.NewStepFromFunc("observe deployment", steps.ObserveDeploymentFn()),
+				pipeline.NewStepFromFunc("ensure hibernation", steps.EnsureHibernationFn()),
+				pipeline.NewStepFromFunc("migrate storage", steps.MigrateStorageFn(commonLabels)),
+				pipeline.NewStepFromFunc("restart primary for file system resize", steps.RestartPrimaryForFileSystemResizeFn()),
+				pipeline.NewStepFromFunc("autoscale storage", steps.AutoscaleStorageFn()),
 				pipeline.IfOrElse(steps.IsBackupEnabledP(),
 					pipeline.NewPipeline().WithNestedSteps("ensure backup",
 						// TODO: add step to provision S3 bucket
 						pipeline.NewStepFromFunc("fetch bucket secret", steps.FetchS3BucketSecretFn()),
 						pipeline.NewStepFromFunc("ensure encryption secret", steps.EnsureResticRepositorySecretFn(commonLabels)),
 						pipeline.NewStepFromFunc("ensure k8up schedule", steps.EnsureK8upScheduleFn(commonLabels)),
-					),
+					).WithResultHandler(steps.SetConditionFromResultFn(conditions.ResourceReady(conditions.TypeBackupConfigured))),
 					// else
-					pipeline.NewStepFromFunc("delete k8up schedule", steps.DeleteK8upScheduleFn())),
+					pipeline.NewStepFromFunc("delete k8up schedule", steps.DeleteK8upScheduleFn()).
+						WithResultHandler(steps.SetConditionFromResultFn(conditions.BackupDisabled()))),
 			),
 
-			pipeline.If(steps.IsHelmReleaseReadyP(),
-				pipeline.NewPipeline().WithNestedSteps("finish provisioning",
-					pipeline.NewPipeline().WithNestedSteps("create connection secret",
-						pipeline.NewStepFromFunc("fetch service", steps.FetchServiceFn()),
-						pipeline.NewStepFromFunc("ensure connection secret", steps.EnsureConnectionSecretFn(commonLabels)),
+			pipeline.IfOrElse(steps.IsHibernatedP(),
+				pipeline.NewPipeline().WithNestedSteps("finish hibernation",
+					createConnectionSecretStep(commonLabels),
+					pipeline.NewStepFromFunc("mark instance as hibernated", steps.MarkInstanceAsHibernatedFn()),
+				),
+				// else
+				pipeline.IfOrElse(steps.IsDeploymentReadyP(),
+					pipeline.NewPipeline().WithNestedSteps("finish provisioning",
+						pipeline.NewStepFromFunc("mark deployment as ready", steps.SetConditionFn(conditions.ResourceReady(conditions.TypeReleaseReady))),
+						createConnectionSecretStep(commonLabels),
+						pipeline.NewStepFromFunc("mark instance ready", steps.MarkInstanceAsReadyFn()).WithResultHandler(p.logProvisioningFinished),
 					),
-					pipeline.NewStepFromFunc("mark instance ready", steps.MarkInstanceAsReadyFn()).WithResultHandler(p.logProvisioningFinished),
+					// else
+					pipeline.NewStepFromFunc("mark deployment as progressing", steps.SetConditionFn(conditions.ResourceNotReady(conditions.TypeReleaseReady, "Waiting for deployment to become ready"))),
 				),
 			),
 		).
+		WithFinalizer(steps.UpdateSyncedConditionFn()).
 		RunWithContext(ctx).Err()
 }
 
+// createConnectionSecretStep returns a step that writes the connection secret of the instance.
+func createConnectionSecretStep(commonLabels labels.Set) pipeline.Step {
+	return pipeline.NewPipeline().WithNestedSteps("create connection secret",
+		pipeline.NewStepFromFunc("fetch service", steps.FetchServiceFn()),
+		pipeline.NewStepFromFunc("ensure connection secret", steps.EnsureConnectionSecretFn(commonLabels)),
+	).WithResultHandler(steps.SetConditionFromResultFn(conditions.ResourceReady(conditions.TypeConnectionSecretReady)))
+}
+
 func (p *CreateStandalonePipeline) logProvisioningFinished(ctx context.Context, result pipeline.Result) error {
 	if result.IsSuccessful() {
 		log := controllerruntime.LoggerFrom(ctx)
@@ -92,29 +118,39 @@ func (p *CreateStandalonePipeline) logProvisioningFinished(ctx context.Context,
 	return result.Err()
 }
 
-func getCommonLabels(instanceName string) labels.Set {
+func getCommonLabels(instance *v1alpha1.PostgresqlStandalone) labels.Set {
 	// https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
 	return labels.Set{
-		"app.kubernetes.io/instance":   instanceName,
-		"app.kubernetes.io/managed-by": v1alpha1.Group,
+		InstanceLabelKey:               instance.Name,
+		InstanceNamespaceLabelKey:      instance.Namespace,
+		ManagedByLabelKey:              v1alpha1.Group,
+		InstanceUIDLabelKey:            string(instance.UID),
 		"app.kubernetes.io/created-by": fmt.Sprintf("controller-%s", strings.ToLower(v1alpha1.PostgresqlStandaloneKind)),
 	}
 }
 
-func generateClusterScopedNameForInstance() string {
-	name := ""
-	for i := 0; i < 10; i++ {
-		name = fmt.Sprintf("%s%s", ServiceNamespacePrefix, codename.Generate(namegeneratorRNG, 4))
-		if len(name) <= 63 && !strings.HasSuffix(name, "-") {
-			return name
-		}
+// getInstanceSelector returns the labels that identify the resources of the instance regardless of its UID.
+func getInstanceSelector(instance *v1alpha1.PostgresqlStandalone) labels.Set {
+	return labels.Set{
+		InstanceLabelKey:          instance.Name,
+		InstanceNamespaceLabelKey: instance.Namespace,
+		ManagedByLabelKey:         v1alpha1.Group,
 	}
-	panic("no generated name under 63 chars without '-' suffix after 10 attempts, giving up")
 }
 
-func getDeploymentNamespaceOrGenerate(instance *v1alpha1.PostgresqlStandalone) string {
-	if instance.Status.HelmChart != nil && instance.Status.HelmChart.DeploymentNamespace != "" {
-		return instance.Status.HelmChart.DeploymentNamespace
+// ensureDeploymentNamespaceFn returns a func that ensures the deployment namespace of the instance.
+// The name is determined when the step runs, so that a namespace found by steps.DiscoverDeploymentFn is reused instead of generating a new name.
+// New names are generated according to the NamespaceNamingScheme, see generateDeploymentNamespaceName.
+func ensureDeploymentNamespaceFn(instance *v1alpha1.PostgresqlStandalone, commonLabels labels.Set) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		name := instance.Status.GetDeploymentNamespace()
+		if name == "" {
+			generated, err := generateDeploymentNamespaceName(ctx, instance)
+			if err != nil {
+				return err
+			}
+			name = generated
+		}
+		return steps.EnsureNamespace(name, commonLabels)(ctx)
 	}
-	return generateClusterScopedNameForInstance()
 }
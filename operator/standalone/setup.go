@@ -1,32 +1,234 @@
 package standalone
 
 import (
-	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"context"
 	"strings"
 
+	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
+	k8upv1 "github.com/k8up-io/k8up/v2/api/v1"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/steps"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// validatingWebhookPath is the path of the validating webhook for v1alpha1.PostgresqlStandalone, see SetupWebhook.
+	validatingWebhookPath = "/validate-postgresql-appcat-vshn-io-v1alpha1-postgresqlstandalone"
+	// mutatingWebhookPath is the path of the mutating webhook for v1alpha1.PostgresqlStandalone, see SetupWebhook.
+	mutatingWebhookPath = "/mutate-postgresql-appcat-vshn-io-v1alpha1-postgresqlstandalone"
 )
 
 // SetupController adds a controller that reconciles v1alpha1.PostgresqlStandalone managed resources.
+// Besides the instance itself, the controller watches the resources that are deployed for an instance.
+// Changes to those resources are mapped back to the instance with the labels that identify the instance.
+// Changes to a v1alpha1.PostgresqlStandaloneOperatorConfig are mapped to all instances with the same major version.
+// Changes to the labels and annotations of a namespace are mapped to all instances in the namespace,
+// so that they are reconciled once they are no longer paused and propagate the changed labels and annotations.
+// CloudNativePG clusters are only watched if the CloudNativePG CRDs are installed.
+// The controller requires the field indexes of SetupFieldIndexes.
 func SetupController(mgr ctrl.Manager) error {
 	name := strings.ToLower(v1alpha1.PostgresqlStandaloneGroupKind)
+	toInstance := handler.EnqueueRequestsFromMapFunc(mapToInstance)
+	steps.DeploymentStrategies[v1alpha1.StrategyHelmSDK] = &steps.HelmSDKStrategy{RESTConfig: mgr.GetConfig(), CacheDir: HelmCacheDir}
+	configToInstances := handler.EnqueueRequestsFromMapFunc(mapConfigToInstancesFn(mgr.GetClient()))
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&v1alpha1.PostgresqlStandalone{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		Watches(&source.Kind{Type: &helmv1beta1.Release{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, toInstance).
+		Watches(&source.Kind{Type: &k8upv1.Schedule{}}, toInstance).
+		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.Service{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, toInstance).
+		Watches(&source.Kind{Type: &networkingv1.NetworkPolicy{}}, toInstance).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.ResourceQuota{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.LimitRange{}}, toInstance).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(mapNamespaceToInstancesFn(mgr.GetClient())),
+			builder.WithPredicates(predicate.Or(predicate.AnnotationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		Watches(&source.Kind{Type: &v1alpha1.PostgresqlStandaloneOperatorConfig{}}, configToInstances,
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{})))
+	_, err := mgr.GetRESTMapper().RESTMapping(steps.CloudNativePGClusterGVK.GroupKind(), steps.CloudNativePGClusterGVK.Version)
+	switch {
+	case err == nil:
+		cluster := &unstructured.Unstructured{}
+		cluster.SetGroupVersionKind(steps.CloudNativePGClusterGVK)
+		b = b.Watches(&source.Kind{Type: cluster}, toInstance)
+	case meta.IsNoMatchError(err):
+		mgr.GetLogger().Info("CloudNativePG CRDs are not installed, CloudNativePG clusters are not watched")
+	default:
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	return b.Complete(&PostgresStandaloneReconciler{
+		client:            mgr.GetClient(),
+		recorder:          mgr.GetEventRecorderFor(name),
+		volumeUsageReader: &steps.KubeletVolumeUsageReader{Clientset: clientset},
+	})
+}
+
+// SetupConfigController adds a controller that reconciles v1alpha1.PostgresqlStandaloneOperatorConfig in the OperatorNamespace.
+// Changes to a v1alpha1.PostgresqlStandalone are mapped to the configs with the same major version, so that rollouts can progress.
+// The controller requires the field indexes of SetupFieldIndexes.
+func SetupConfigController(mgr ctrl.Manager) error {
+	name := strings.ToLower(v1alpha1.PostgresqlStandaloneOperatorConfigGroupKind)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
-		For(&v1alpha1.PostgresqlStandalone{}).
-		WithEventFilter(predicate.Or(predicate.GenerationChangedPredicate{})).
-		Complete(&PostgresStandaloneReconciler{
+		For(&v1alpha1.PostgresqlStandaloneOperatorConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{}, predicate.NewPredicateFuncs(isInOperatorNamespace))).
+		Watches(&source.Kind{Type: &v1alpha1.PostgresqlStandalone{}}, handler.EnqueueRequestsFromMapFunc(mapInstanceToConfigsFn(mgr.GetClient()))).
+		Complete(&OperatorConfigReconciler{
 			client: mgr.GetClient(),
 		})
 }
 
-// SetupWebhook adds a webhook for v1alpha1.PostgresqlStandalone managed resources.
+// SetupFieldIndexes adds the field indexes that the controllers rely on.
+func SetupFieldIndexes(mgr ctrl.Manager) error {
+	indexer := mgr.GetFieldIndexer()
+	err := indexer.IndexField(context.Background(), &v1alpha1.PostgresqlStandaloneOperatorConfig{}, steps.OperatorConfigMajorVersionIndex, steps.IndexOperatorConfigByMajorVersion)
+	if err != nil {
+		return err
+	}
+	return indexer.IndexField(context.Background(), &v1alpha1.PostgresqlStandalone{}, steps.InstanceMajorVersionIndex, steps.IndexInstanceByMajorVersion)
+}
+
+// mapConfigToInstancesFn returns a function that returns reconcile requests for all instances that are configured by the given v1alpha1.PostgresqlStandaloneOperatorConfig.
+// Configs outside the OperatorNamespace are ignored.
+func mapConfigToInstancesFn(kube client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		if !isInOperatorNamespace(obj) {
+			return nil
+		}
+		versions := steps.IndexOperatorConfigByMajorVersion(obj)
+		if len(versions) == 0 {
+			return nil
+		}
+		list := &v1alpha1.PostgresqlStandaloneList{}
+		err := kube.List(context.Background(), list, client.MatchingFields{steps.InstanceMajorVersionIndex: versions[0]})
+		if err != nil {
+			ctrl.Log.WithName("operatorconfig").Error(err, "Cannot list instances for operator config", "name", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, len(list.Items))
+		for i, instance := range list.Items {
+			requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)}
+		}
+		return requests
+	}
+}
+
+// mapNamespaceToInstancesFn returns a function that returns reconcile requests for all instances in the given namespace.
+func mapNamespaceToInstancesFn(kube client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		list := &v1alpha1.PostgresqlStandaloneList{}
+		err := kube.List(context.Background(), list, client.InNamespace(obj.GetName()))
+		if err != nil {
+			ctrl.Log.WithName("namespace").Error(err, "Cannot list instances in namespace", "name", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, len(list.Items))
+		for i, instance := range list.Items {
+			requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instance)}
+		}
+		return requests
+	}
+}
+
+// isInOperatorNamespace returns true if the given object is in the OperatorNamespace or if the OperatorNamespace is unset.
+func isInOperatorNamespace(obj client.Object) bool {
+	return OperatorNamespace == "" || obj.GetNamespace() == OperatorNamespace
+}
+
+// mapInstanceToConfigsFn returns a function that returns reconcile requests for the v1alpha1.PostgresqlStandaloneOperatorConfig that configure the given instance.
+func mapInstanceToConfigsFn(kube client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		instance, ok := obj.(*v1alpha1.PostgresqlStandalone)
+		if !ok {
+			return nil
+		}
+		list := &v1alpha1.PostgresqlStandaloneOperatorConfigList{}
+		err := kube.List(context.Background(), list,
+			client.MatchingFields{steps.OperatorConfigMajorVersionIndex: instance.Spec.Parameters.MajorVersion.String()},
+			client.InNamespace(OperatorNamespace))
+		if err != nil {
+			ctrl.Log.WithName("operatorconfig").Error(err, "Cannot list operator configs for instance", "name", obj.GetName(), "namespace", obj.GetNamespace())
+			return nil
+		}
+		requests := make([]reconcile.Request, len(list.Items))
+		for i, config := range list.Items {
+			requests[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&config)}
+		}
+		return requests
+	}
+}
+
+// NewCacheFunc returns a cache constructor for the manager that only caches the objects of the watched core kinds that are managed by this operator.
+// Those kinds are watched by SetupController, but clusters usually contain many more of them that don't belong to any instance.
+// Since the cache doesn't contain the other objects, the client of the manager has to read some kinds from the API server directly, see UncachedObjects.
+func NewCacheFunc() cache.NewCacheFunc {
+	managed := cache.ObjectSelector{Label: labels.SelectorFromSet(labels.Set{ManagedByLabelKey: v1alpha1.Group})}
+	return cache.BuilderWithOptions(cache.Options{SelectorsByObject: cache.SelectorsByObject{
+		&corev1.Secret{}:                managed,
+		&corev1.ConfigMap{}:             managed,
+		&corev1.Service{}:               managed,
+		&corev1.PersistentVolumeClaim{}: managed,
+		&corev1.Namespace{}:             managed,
+		&corev1.ResourceQuota{}:         managed,
+		&corev1.LimitRange{}:            managed,
+		&appsv1.StatefulSet{}:           managed,
+		&batchv1.Job{}:                  managed,
+		&networkingv1.NetworkPolicy{}:   managed,
+	}})
+}
+
+// UncachedObjects returns the kinds that the client of the manager reads from the API server instead of the cache of NewCacheFunc.
+// The operator also reads objects of those kinds that it doesn't label itself, e.g. the bucket secret, the release secrets of Helm,
+// the services, StatefulSets and PersistentVolumeClaims of the charts, the namespaces of the instances and the pods of PostgreSQL.
+func UncachedObjects() []client.Object {
+	return []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}, &corev1.Service{}, &corev1.PersistentVolumeClaim{}, &corev1.Namespace{}, &appsv1.StatefulSet{}, &corev1.Pod{}}
+}
+
+// mapToInstance returns a reconcile request for the instance that the given object belongs to.
+// Objects that are not managed by this operator or that don't identify an instance are ignored.
+func mapToInstance(obj client.Object) []reconcile.Request {
+	objLabels := obj.GetLabels()
+	if objLabels[ManagedByLabelKey] != v1alpha1.Group {
+		return nil
+	}
+	name, namespace := objLabels[InstanceLabelKey], objLabels[InstanceNamespaceLabelKey]
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
+
+// SetupWebhook adds a webhook for v1alpha1.PostgresqlStandalone managed resources,
+// and the webhook of the NamespaceGuard that protects the resources in the deployment namespaces.
 func SetupWebhook(mgr ctrl.Manager) error {
 	/*
-		Totally undocumented and hard-to-find feature is that the builder automatically registers the URL path for the webhook.
-		What's more, not even the tests in upstream controller-runtime reveal what this path is _actually_ going to look like.
-		So here's how the path is built (dots replaced with dash, lower-cased, single-form):
+		The paths of the webhooks follow the naming of the webhook builder of controller-runtime (dots replaced with dash, lower-cased, single-form):
 		 /validate-<group>-<version>-<kind>
 		 /mutate-<group>-<version>-<kind>
 		Example:
@@ -35,11 +237,16 @@ func SetupWebhook(mgr ctrl.Manager) error {
 		 +kubebuilder:webhook:verbs=create;update;delete,path=/validate-postgresql-appcat-vshn-io-v1alpha1-postgresqlstandalone,mutating=false,failurePolicy=fail,groups=postgresql.appcat.vshn.io,resources=postgresqlstandalones,versions=v1alpha1,name=postgresqlstandalones.postgresql.appcat.vshn.io,sideEffects=None,admissionReviewVersions=v1
 		Pay special attention to the plural forms and correct versions!
 	*/
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(&v1alpha1.PostgresqlStandalone{}).
-		WithValidator(&PostgresqlStandaloneValidator{
-			kube: mgr.GetClient(),
-		}).
-		WithDefaulter(&PostgresqlStandaloneDefaulter{}).
-		Complete()
+	// The validator needs to know the requesting user and the defaulter needs to know the instance before an update.
+	// So they are registered manually with the admission request in the context.
+	validator := admission.WithCustomValidator(&v1alpha1.PostgresqlStandalone{}, &PostgresqlStandaloneValidator{
+		kube: mgr.GetClient(),
+	})
+	mgr.GetWebhookServer().Register(validatingWebhookPath, &admission.Webhook{Handler: &requestInContextWebhook{Webhook: validator}})
+	defaulter := admission.WithCustomDefaulter(&v1alpha1.PostgresqlStandalone{}, &PostgresqlStandaloneDefaulter{
+		kube: mgr.GetClient(),
+	})
+	mgr.GetWebhookServer().Register(mutatingWebhookPath, &admission.Webhook{Handler: &requestInContextWebhook{Webhook: defaulter}})
+	mgr.GetWebhookServer().Register(namespaceGuardWebhookPath, &admission.Webhook{Handler: &NamespaceGuard{}})
+	return nil
 }
@@ -0,0 +1,74 @@
+package standalone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMapToInstance(t *testing.T) {
+	tests := map[string]struct {
+		givenLabels      map[string]string
+		expectedRequests []reconcile.Request
+	}{
+		"GivenManagedResource_ThenExpectRequestForInstance": {
+			givenLabels: map[string]string{
+				ManagedByLabelKey:         v1alpha1.Group,
+				InstanceLabelKey:          "instance",
+				InstanceNamespaceLabelKey: "my-app",
+			},
+			expectedRequests: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "instance", Namespace: "my-app"}}},
+		},
+		"GivenResourceManagedByOther_ThenExpectNoRequest": {
+			givenLabels: map[string]string{
+				ManagedByLabelKey:         "Helm",
+				InstanceLabelKey:          "instance",
+				InstanceNamespaceLabelKey: "my-app",
+			},
+		},
+		"GivenManagedResource_WhenInstanceNamespaceMissing_ThenExpectNoRequest": {
+			givenLabels: map[string]string{
+				ManagedByLabelKey: v1alpha1.Group,
+				InstanceLabelKey:  "instance",
+			},
+		},
+		"GivenResourceWithoutLabels_ThenExpectNoRequest": {},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "sv-postgresql-s-merry-vigilante-7b16", Labels: tc.givenLabels}}
+			result := mapToInstance(obj)
+			assert.Equal(t, tc.expectedRequests, result)
+		})
+	}
+}
+
+func TestMapConfigToInstances(t *testing.T) {
+	tests := map[string]struct {
+		givenNamespace string
+		givenLabels    map[string]string
+	}{
+		"GivenConfigOutsideOperatorNamespace_ThenExpectNoRequest": {
+			givenNamespace: "other-namespace",
+			givenLabels:    map[string]string{v1alpha1.PostgresqlMajorVersionLabelKey: v1alpha1.PostgresqlVersion14.String()},
+		},
+		"GivenConfigWithoutMajorVersionLabel_ThenExpectNoRequest": {
+			givenNamespace: "postgresql-system",
+		},
+	}
+	OperatorNamespace = "postgresql-system"
+	defer func() { OperatorNamespace = "" }()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj := &v1alpha1.PostgresqlStandaloneOperatorConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: tc.givenNamespace, Labels: tc.givenLabels}}
+			// the client is not needed if the config is ignored.
+			result := mapConfigToInstancesFn(nil)(obj)
+			assert.Empty(t, result)
+		})
+	}
+}
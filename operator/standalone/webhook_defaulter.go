@@ -4,17 +4,96 @@ import (
 	"context"
 
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // PostgresqlStandaloneDefaulter is the webhook that sets default values for the v1alpha1.PostgresqlStandalone.
-type PostgresqlStandaloneDefaulter struct{}
+type PostgresqlStandaloneDefaulter struct {
+	kube client.Client
+}
 
 // Default sets the default values for the instance.
-func (p *PostgresqlStandaloneDefaulter) Default(_ context.Context, obj runtime.Object) error {
+func (p *PostgresqlStandaloneDefaulter) Default(ctx context.Context, obj runtime.Object) error {
 	instance := obj.(*v1alpha1.PostgresqlStandalone)
 	if instance.Spec.WriteConnectionSecretToRef.Name == "" {
 		instance.Spec.WriteConnectionSecretToRef.Name = instance.Name
 	}
+	return p.applyPlan(ctx, instance)
+}
+
+// applyPlan sets the resources of the v1alpha1.Plan that the instance references.
+// New instances get the resources and the storage class of the plan that they don't specify themselves, and backups are enabled if the plan enables them.
+// If the plan of an existing instance changes, the instance is resized to the compute resources of the new plan.
+// The storage capacity is only ever increased though.
+// Unknown plans are left to the validator.
+func (p *PostgresqlStandaloneDefaulter) applyPlan(ctx context.Context, instance *v1alpha1.PostgresqlStandalone) error {
+	name := instance.Spec.Parameters.Plan
+	if name == "" {
+		return nil
+	}
+	oldInstance, err := getOldInstanceFromRequest(ctx)
+	if err != nil {
+		return err
+	}
+	if oldInstance != nil && oldInstance.Spec.Parameters.Plan == name {
+		return nil
+	}
+	plan, err := findPlan(ctx, p.kube, instance)
+	if plan == nil || err != nil {
+		return err
+	}
+
+	resources := &instance.Spec.Parameters.Resources
+	if oldInstance != nil {
+		resources.ComputeResources = plan.Resources.ComputeResources
+		if capacity := plan.Resources.StorageCapacity; capacity != nil && (resources.StorageCapacity == nil || capacity.Cmp(*resources.StorageCapacity) > 0) {
+			resources.StorageCapacity = capacity
+		}
+		return nil
+	}
+	for _, field := range []struct {
+		instance **resource.Quantity
+		plan     *resource.Quantity
+	}{
+		{&resources.MemoryLimit, plan.Resources.MemoryLimit},
+		{&resources.MemoryRequest, plan.Resources.MemoryRequest},
+		{&resources.CPULimit, plan.Resources.CPULimit},
+		{&resources.CPURequest, plan.Resources.CPURequest},
+		{&resources.StorageCapacity, plan.Resources.StorageCapacity},
+	} {
+		if *field.instance == nil {
+			*field.instance = field.plan
+		}
+	}
+	if resources.StorageClassName == "" {
+		resources.StorageClassName = plan.Resources.StorageClassName
+	}
+	if plan.Backup.Enabled {
+		instance.Spec.Backup.Enabled = true
+	}
 	return nil
 }
+
+// findPlan returns the v1alpha1.Plan that the instance references from the v1alpha1.PostgresqlStandaloneOperatorConfig for the major version of the instance.
+// It returns nil if there is no such plan.
+func findPlan(ctx context.Context, kube client.Client, instance *v1alpha1.PostgresqlStandalone) (*v1alpha1.Plan, error) {
+	configs, err := listOperatorConfigs(ctx, kube, instance)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range configs {
+		if plan := config.Spec.GetPlan(instance.Spec.Parameters.Plan); plan != nil {
+			return plan, nil
+		}
+	}
+	return nil, nil
+}
+
+// listOperatorConfigs returns the v1alpha1.PostgresqlStandaloneOperatorConfig in the OperatorNamespace for the major version of the instance.
+func listOperatorConfigs(ctx context.Context, kube client.Client, instance *v1alpha1.PostgresqlStandalone) ([]v1alpha1.PostgresqlStandaloneOperatorConfig, error) {
+	list := &v1alpha1.PostgresqlStandaloneOperatorConfigList{}
+	err := kube.List(ctx, list, client.InNamespace(OperatorNamespace), client.MatchingLabels{v1alpha1.PostgresqlMajorVersionLabelKey: instance.Spec.Parameters.MajorVersion.String()})
+	return list.Items, err
+}
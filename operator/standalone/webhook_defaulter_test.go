@@ -1,12 +1,19 @@
 package standalone
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 func TestPostgresqlStandaloneDefaulter_Default(t *testing.T) {
@@ -42,3 +49,140 @@ func TestPostgresqlStandaloneDefaulter_Default(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresqlStandaloneDefaulter_ApplyPlan(t *testing.T) {
+	tests := map[string]struct {
+		givenOldInstance  *v1alpha1.PostgresqlStandalone
+		givenInstance     *v1alpha1.PostgresqlStandalone
+		expectedResources v1alpha1.Resources
+		expectedBackup    bool
+	}{
+		"GivenNewInstance_WhenNoResources_ThenExpectResourcesFromPlan": {
+			givenInstance: newPlanInstance("small", "", ""),
+			expectedResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("10Gi")},
+			},
+			expectedBackup: true,
+		},
+		"GivenNewInstance_WhenResourcesSpecified_ThenExpectResourcesFromInstance": {
+			givenInstance: newPlanInstance("small", "2Gi", "20Gi"),
+			expectedResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("2Gi")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("20Gi")},
+			},
+			expectedBackup: true,
+		},
+		"GivenNewInstance_WhenPlanHasStorageClass_ThenExpectStorageClassFromPlan": {
+			givenInstance: newPlanInstance("large", "", ""),
+			expectedResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("4Gi"), CPULimit: parseResource("2")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("50Gi"), StorageClassName: "fast"},
+			},
+		},
+		"GivenNewInstance_WhenPlanUnknown_ThenExpectNoChanges": {
+			givenInstance: newPlanInstance("unknown", "", ""),
+		},
+		"GivenExistingInstance_WhenPlanUnchanged_ThenExpectNoChanges": {
+			givenOldInstance: newPlanInstance("small", "2Gi", "20Gi"),
+			givenInstance:    newPlanInstance("small", "3Gi", "20Gi"),
+			expectedResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("3Gi")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("20Gi")},
+			},
+		},
+		"GivenExistingInstance_WhenPlanChanged_ThenExpectResize": {
+			givenOldInstance: newPlanInstance("small", "1Gi", "10Gi"),
+			givenInstance:    newPlanInstance("large", "1Gi", "10Gi"),
+			expectedResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("4Gi"), CPULimit: parseResource("2")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("50Gi")},
+			},
+		},
+		"GivenExistingInstance_WhenPlanChangedToSmallerStorage_ThenExpectStorageKept": {
+			givenOldInstance: newPlanInstance("large", "4Gi", "50Gi"),
+			givenInstance:    newPlanInstance("small", "4Gi", "50Gi"),
+			expectedResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("50Gi")},
+			},
+		},
+	}
+	OperatorNamespace = "postgresql-system"
+	defer func() {
+		OperatorNamespace = ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			d := &PostgresqlStandaloneDefaulter{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(newPlanConfig()).Build()}
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create}}
+			if tc.givenOldInstance != nil {
+				raw, err := json.Marshal(tc.givenOldInstance)
+				require.NoError(t, err)
+				req.Operation = admissionv1.Update
+				req.OldObject = runtime.RawExtension{Raw: raw}
+			}
+			ctx := context.WithValue(context.Background(), admissionRequestKey{}, req)
+
+			// Act
+			err := d.Default(ctx, tc.givenInstance)
+
+			// Assert
+			require.NoError(t, err, "defaulter error")
+			assert.Equal(t, tc.expectedResources, tc.givenInstance.Spec.Parameters.Resources)
+			assert.Equal(t, tc.expectedBackup, tc.givenInstance.Spec.Backup.Enabled, "backup enabled")
+		})
+	}
+}
+
+func newPlanInstance(plan, memory, storage string) *v1alpha1.PostgresqlStandalone {
+	instance := &v1alpha1.PostgresqlStandalone{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "my-app"},
+		Spec: v1alpha1.PostgresqlStandaloneSpec{
+			ConnectableInstance: v1alpha1.ConnectableInstance{
+				WriteConnectionSecretToRef: v1alpha1.ConnectionSecretRef{Name: "instance"},
+			},
+			Parameters: v1alpha1.PostgresqlStandaloneParameters{
+				Plan:         plan,
+				MajorVersion: v1alpha1.PostgresqlVersion14,
+			},
+		},
+	}
+	if memory != "" {
+		instance.Spec.Parameters.Resources.MemoryLimit = parseResource(memory)
+	}
+	if storage != "" {
+		instance.Spec.Parameters.Resources.StorageCapacity = parseResource(storage)
+	}
+	return instance
+}
+
+func newPlanConfig() *v1alpha1.PostgresqlStandaloneOperatorConfig {
+	return &v1alpha1.PostgresqlStandaloneOperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "postgresql-system", Labels: map[string]string{
+			v1alpha1.PostgresqlMajorVersionLabelKey: v1alpha1.PostgresqlVersion14.String(),
+		}},
+		Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+			Plans: []v1alpha1.Plan{
+				{
+					Name: "small",
+					Resources: v1alpha1.Resources{
+						ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi")},
+						StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("10Gi")},
+					},
+					Backup: v1alpha1.BackupSpec{Enabled: true},
+				},
+				{
+					Name: "large",
+					Resources: v1alpha1.Resources{
+						ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("4Gi"), CPULimit: parseResource("2")},
+						StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("50Gi"), StorageClassName: "fast"},
+					},
+				},
+			},
+		},
+	}
+}
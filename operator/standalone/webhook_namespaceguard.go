@@ -0,0 +1,72 @@
+package standalone
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// namespaceGuardWebhookPath is the path of the validating webhook of the NamespaceGuard, see SetupWebhook.
+const namespaceGuardWebhookPath = "/validate-deployment-namespace-resources"
+
+var (
+	// kubernetesSystemGroups are the groups of the Kubernetes components that change resources of the operator in the deployment namespaces,
+	// for example the garbage collector, the namespace controller or the controller that binds PersistentVolumeClaims.
+	kubernetesSystemGroups = []string{"system:serviceaccounts:kube-system"}
+	// kubernetesSystemUsers are the users of the Kubernetes components if they don't use individual service accounts.
+	// The scheduler annotates PersistentVolumeClaims with the selected node.
+	kubernetesSystemUsers = []string{"system:kube-controller-manager", "system:kube-scheduler"}
+)
+
+// NamespaceGuard is an admission.Handler that protects the resources in the deployment namespaces against changes by tenants.
+// The resources in the deployment namespaces, like the credentials secret, the PersistentVolumeClaim and the resources of the Helm chart,
+// can only be created, changed or deleted by the operator, by the TrustedUsers, by the service accounts in the TrustedServiceAccountNamespaces,
+// by members of the AdminGroups and by Kubernetes system components.
+// Denied requests are logged with the requesting user.
+//
+// The webhook only receives requests for namespaces with the ManagedByLabelKey label of the operator, see the namespaceSelector in apis/generate.go,
+// so every request from any other user is denied, regardless of the labels of the object.
+type NamespaceGuard struct{}
+
+// Handle implements admission.Handler.
+func (g *NamespaceGuard) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if isTrustedUser(req.UserInfo) {
+		return admission.Allowed("")
+	}
+	log := ctrl.LoggerFrom(ctx)
+	log.Info("Denied change of resource in deployment namespace",
+		"user", req.UserInfo.Username, "groups", req.UserInfo.Groups, "operation", req.Operation,
+		"kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name)
+	return admission.Denied(fmt.Sprintf("%s %s in namespace %s is managed by %s and can only be changed by the operator or platform admins",
+		req.Kind.Kind, req.Name, req.Namespace, v1alpha1.Group))
+}
+
+// isTrustedUser returns true if the given user is the operator, one of the TrustedUsers, a service account in one of the TrustedServiceAccountNamespaces,
+// a member of the AdminGroups or a Kubernetes system component.
+func isTrustedUser(user authenticationv1.UserInfo) bool {
+	if isOperator(user) {
+		return true
+	}
+	for _, names := range [][]string{TrustedUsers, kubernetesSystemUsers} {
+		for _, name := range names {
+			if user.Username == name {
+				return true
+			}
+		}
+	}
+	return isMemberOfAny(user, getServiceAccountGroups(TrustedServiceAccountNamespaces)) ||
+		isMemberOfAny(user, AdminGroups) || isMemberOfAny(user, kubernetesSystemGroups)
+}
+
+// getServiceAccountGroups returns the groups that contain the service accounts of the given namespaces.
+func getServiceAccountGroups(namespaces []string) []string {
+	groups := make([]string, len(namespaces))
+	for i, ns := range namespaces {
+		groups[i] = "system:serviceaccounts:" + ns
+	}
+	return groups
+}
@@ -0,0 +1,196 @@
+package standalone
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestNamespaceGuard_Handle(t *testing.T) {
+	secretKind := metav1.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	managedSecret := `{"metadata":{"name":"postgresql-credentials","labels":{"app.kubernetes.io/managed-by":"postgresql.appcat.vshn.io"}}}`
+	tests := map[string]struct {
+		givenServiceAccount string
+		givenTrustedUsers   []string
+		givenNamespaces     []string
+		givenUser           authenticationv1.UserInfo
+		givenOperation      admissionv1.Operation
+		givenKind           metav1.GroupVersionKind
+		givenObject         string
+		givenOldObject      string
+		expectedAllowed     bool
+	}{
+		"GivenTenant_WhenUpdatingManagedObject_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "tenant", Groups: []string{"system:authenticated"}},
+			givenOperation: admissionv1.Update,
+			givenKind:      secretKind,
+			givenObject:    managedSecret,
+			givenOldObject: managedSecret,
+		},
+		"GivenTenant_WhenDeletingManagedObject_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "tenant"},
+			givenOperation: admissionv1.Delete,
+			givenKind:      secretKind,
+			givenOldObject: managedSecret,
+		},
+		"GivenTenant_WhenRemovingManagedByLabel_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "tenant"},
+			givenOperation: admissionv1.Update,
+			givenKind:      secretKind,
+			givenObject:    `{"metadata":{"name":"postgresql-credentials"}}`,
+			givenOldObject: managedSecret,
+		},
+		"GivenTenant_WhenCreatingUnlabelledSecret_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "tenant"},
+			givenOperation: admissionv1.Create,
+			givenKind:      secretKind,
+			givenObject:    `{"metadata":{"name":"postgresql-credentials"}}`,
+		},
+		"GivenTenant_WhenCreatingUnlabelledPersistentVolumeClaim_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "tenant"},
+			givenOperation: admissionv1.Create,
+			givenKind:      metav1.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"},
+			givenObject:    `{"metadata":{"name":"data-postgresql-0"}}`,
+		},
+		"GivenTenant_WhenUpdatingUnlabelledStatefulSetOfHelmChart_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "tenant"},
+			givenOperation: admissionv1.Update,
+			givenKind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+			givenObject:    `{"metadata":{"name":"postgresql","labels":{"app.kubernetes.io/managed-by":"Helm"}}}`,
+			givenOldObject: `{"metadata":{"name":"postgresql","labels":{"app.kubernetes.io/managed-by":"Helm"}}}`,
+		},
+		"GivenProviderHelm_WhenUpdatingUnlabelledStatefulSetOfHelmChart_ThenExpectAllowed": {
+			givenNamespaces: []string{"crossplane-system"},
+			givenUser:       authenticationv1.UserInfo{Username: "system:serviceaccount:crossplane-system:provider-helm", Groups: []string{"system:serviceaccounts:crossplane-system"}},
+			givenOperation:  admissionv1.Update,
+			givenKind:       metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+			givenObject:     `{"metadata":{"name":"postgresql","labels":{"app.kubernetes.io/managed-by":"Helm"}}}`,
+			givenOldObject:  `{"metadata":{"name":"postgresql","labels":{"app.kubernetes.io/managed-by":"Helm"}}}`,
+			expectedAllowed: true,
+		},
+		"GivenProviderHelmWithRevisionSpecificServiceAccount_WhenNamespaceTrusted_ThenExpectAllowed": {
+			givenNamespaces: []string{"crossplane-system"},
+			givenUser:       authenticationv1.UserInfo{Username: "system:serviceaccount:crossplane-system:provider-helm-a1b2c3d4e5f6", Groups: []string{"system:serviceaccounts:crossplane-system"}},
+			givenOperation:  admissionv1.Update,
+			givenKind:       metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+			givenObject:     `{"metadata":{"name":"postgresql","labels":{"app.kubernetes.io/managed-by":"Helm"}}}`,
+			givenOldObject:  `{"metadata":{"name":"postgresql","labels":{"app.kubernetes.io/managed-by":"Helm"}}}`,
+			expectedAllowed: true,
+		},
+		"GivenK8up_WhenNamespaceTrusted_ThenExpectAllowed": {
+			givenNamespaces: []string{"crossplane-system", "k8up"},
+			givenUser:       authenticationv1.UserInfo{Username: "system:serviceaccount:k8up:k8up", Groups: []string{"system:serviceaccounts:k8up"}},
+			givenOperation:  admissionv1.Create,
+			givenKind:       metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+			givenObject:     `{"metadata":{"name":"backup-postgresql"}}`,
+			expectedAllowed: true,
+		},
+		"GivenServiceAccountInProviderNamespace_WhenNamespaceNotTrusted_ThenExpectDenied": {
+			givenUser:      authenticationv1.UserInfo{Username: "system:serviceaccount:crossplane-system:provider-other", Groups: []string{"system:serviceaccounts:crossplane-system"}},
+			givenOperation: admissionv1.Create,
+			givenKind:      secretKind,
+			givenObject:    managedSecret,
+		},
+		"GivenServiceAccountInProviderNamespace_WhenOnlyOtherUserTrusted_ThenExpectDenied": {
+			givenTrustedUsers: []string{"system:serviceaccount:crossplane-system:provider-helm"},
+			givenUser:         authenticationv1.UserInfo{Username: "system:serviceaccount:crossplane-system:provider-other", Groups: []string{"system:serviceaccounts:crossplane-system"}},
+			givenOperation:    admissionv1.Create,
+			givenKind:         secretKind,
+			givenObject:       managedSecret,
+		},
+		"GivenTrustedUser_ThenExpectAllowed": {
+			givenTrustedUsers: []string{"system:serviceaccount:crossplane-system:provider-helm"},
+			givenUser:         authenticationv1.UserInfo{Username: "system:serviceaccount:crossplane-system:provider-helm", Groups: []string{"system:serviceaccounts:crossplane-system"}},
+			givenOperation:    admissionv1.Create,
+			givenKind:         secretKind,
+			givenObject:       managedSecret,
+			expectedAllowed:   true,
+		},
+		"GivenAdmin_ThenExpectAllowed": {
+			givenUser:       authenticationv1.UserInfo{Username: "admin", Groups: []string{"system:masters"}},
+			givenOperation:  admissionv1.Update,
+			givenKind:       secretKind,
+			givenObject:     managedSecret,
+			givenOldObject:  managedSecret,
+			expectedAllowed: true,
+		},
+		"GivenKubernetesController_ThenExpectAllowed": {
+			givenUser:       authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:generic-garbage-collector", Groups: []string{"system:serviceaccounts:kube-system"}},
+			givenOperation:  admissionv1.Delete,
+			givenKind:       secretKind,
+			givenOldObject:  managedSecret,
+			expectedAllowed: true,
+		},
+		"GivenKubernetesScheduler_ThenExpectAllowed": {
+			givenUser:       authenticationv1.UserInfo{Username: "system:kube-scheduler"},
+			givenOperation:  admissionv1.Update,
+			givenKind:       metav1.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"},
+			givenObject:     `{"metadata":{"name":"data-postgresql-0"}}`,
+			givenOldObject:  `{"metadata":{"name":"data-postgresql-0"}}`,
+			expectedAllowed: true,
+		},
+		"GivenOperatorNamespace_WhenNoServiceAccountConfigured_ThenExpectAllowed": {
+			givenUser:       authenticationv1.UserInfo{Username: "system:serviceaccount:postgresql-system:operator", Groups: []string{"system:serviceaccounts:postgresql-system"}},
+			givenOperation:  admissionv1.Create,
+			givenKind:       secretKind,
+			givenObject:     managedSecret,
+			expectedAllowed: true,
+		},
+		"GivenOperatorServiceAccount_ThenExpectAllowed": {
+			givenServiceAccount: "operator",
+			givenUser:           authenticationv1.UserInfo{Username: "system:serviceaccount:postgresql-system:operator", Groups: []string{"system:serviceaccounts:postgresql-system"}},
+			givenOperation:      admissionv1.Create,
+			givenKind:           secretKind,
+			givenObject:         managedSecret,
+			expectedAllowed:     true,
+		},
+		"GivenOtherServiceAccountInOperatorNamespace_WhenServiceAccountConfigured_ThenExpectDenied": {
+			givenServiceAccount: "operator",
+			givenUser:           authenticationv1.UserInfo{Username: "system:serviceaccount:postgresql-system:other", Groups: []string{"system:serviceaccounts:postgresql-system"}},
+			givenOperation:      admissionv1.Create,
+			givenKind:           secretKind,
+			givenObject:         managedSecret,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			defer func(namespace, serviceAccount string, users, namespaces []string) {
+				OperatorNamespace, OperatorServiceAccount = namespace, serviceAccount
+				TrustedUsers, TrustedServiceAccountNamespaces = users, namespaces
+			}(OperatorNamespace, OperatorServiceAccount, TrustedUsers, TrustedServiceAccountNamespaces)
+			OperatorNamespace, OperatorServiceAccount = "postgresql-system", tc.givenServiceAccount
+			TrustedUsers, TrustedServiceAccountNamespaces = tc.givenTrustedUsers, tc.givenNamespaces
+			g := &NamespaceGuard{}
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      tc.givenKind,
+				Name:      "postgresql",
+				Namespace: "sv-postgresql-s-merry-vigilante-7b16",
+				Operation: tc.givenOperation,
+				UserInfo:  tc.givenUser,
+				Object:    runtime.RawExtension{Raw: []byte(tc.givenObject)},
+				OldObject: runtime.RawExtension{Raw: []byte(tc.givenOldObject)},
+			}}
+
+			// Act
+			response := g.Handle(context.Background(), req)
+
+			// Assert
+			assert.Equal(t, tc.expectedAllowed, response.Allowed, response.Result.Message)
+		})
+	}
+}
+
+func TestIsTrustedUser_GivenDefaults_WhenRevisionSpecificProviderHelmServiceAccount_ThenExpectTrue(t *testing.T) {
+	user := authenticationv1.UserInfo{
+		Username: "system:serviceaccount:crossplane-system:provider-helm-7d3f9a2b1c4e",
+		Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:crossplane-system", "system:authenticated"},
+	}
+	assert.True(t, isTrustedUser(user))
+}
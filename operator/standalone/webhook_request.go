@@ -0,0 +1,72 @@
+package standalone
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type admissionRequestKey struct{}
+
+// requestInContextWebhook wraps an admission.Webhook and stores the admission request in the context before handling it.
+// An admission.CustomValidator or admission.CustomDefaulter doesn't have access to the admission request otherwise, which contains the info about the requesting user and the old object.
+type requestInContextWebhook struct {
+	*admission.Webhook
+}
+
+// Handle implements admission.Handler.
+func (w *requestInContextWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return w.Webhook.Handle(context.WithValue(ctx, admissionRequestKey{}, req), req)
+}
+
+// isAdminRequest returns true if the user of the admission request in the context is member of one of the AdminGroups.
+// It returns false if there is no admission request in the context.
+func isAdminRequest(ctx context.Context) bool {
+	req, ok := ctx.Value(admissionRequestKey{}).(admission.Request)
+	return ok && isMemberOfAny(req.UserInfo, AdminGroups)
+}
+
+// isOperatorRequest returns true if the user of the admission request in the context is the operator, see isOperator.
+// It returns false if there is no admission request in the context.
+func isOperatorRequest(ctx context.Context) bool {
+	req, ok := ctx.Value(admissionRequestKey{}).(admission.Request)
+	return ok && isOperator(req.UserInfo)
+}
+
+// isOperator returns true if the given user is the OperatorServiceAccount,
+// or any service account in the OperatorNamespace if the OperatorServiceAccount is unset.
+func isOperator(user authenticationv1.UserInfo) bool {
+	if OperatorServiceAccount != "" {
+		return user.Username == fmt.Sprintf("system:serviceaccount:%s:%s", OperatorNamespace, OperatorServiceAccount)
+	}
+	return isMemberOfAny(user, []string{"system:serviceaccounts:" + OperatorNamespace})
+}
+
+// isMemberOfAny returns true if the given user is member of one of the given groups.
+func isMemberOfAny(user authenticationv1.UserInfo, groups []string) bool {
+	for _, group := range user.Groups {
+		for _, g := range groups {
+			if group == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getOldInstanceFromRequest returns the instance before the update from the admission request in the context.
+// It returns nil if there is no admission request in the context or if the request isn't an update.
+func getOldInstanceFromRequest(ctx context.Context) (*v1alpha1.PostgresqlStandalone, error) {
+	req, ok := ctx.Value(admissionRequestKey{}).(admission.Request)
+	if !ok || req.Operation != admissionv1.Update || len(req.OldObject.Raw) == 0 {
+		return nil, nil
+	}
+	oldInstance := &v1alpha1.PostgresqlStandalone{}
+	err := json.Unmarshal(req.OldObject.Raw, oldInstance)
+	return oldInstance, err
+}
@@ -3,8 +3,14 @@ package standalone
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/steps"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -20,15 +26,40 @@ func (v *PostgresqlStandaloneValidator) ValidateCreate(ctx context.Context, obj
 	res := obj.(*v1alpha1.PostgresqlStandalone)
 	log := ctrl.LoggerFrom(ctx)
 	log.V(1).Info("Validate create", "name", res.Name)
-	//TODO implement me
-	return nil
+	if err := v.validatePlan(ctx, nil, res); err != nil {
+		return err
+	}
+	if err := v.validateResources(ctx, nil, res); err != nil {
+		return err
+	}
+	if err := v.validateStorageClass(ctx, nil, res); err != nil {
+		return err
+	}
+	if err := validateStorageAutoscaling(res); err != nil {
+		return err
+	}
+	if err := v.validatePostgresqlSettings(ctx, nil, res); err != nil {
+		return err
+	}
+	if err := validateRolloutChartVersion(ctx, nil, res); err != nil {
+		return err
+	}
+	return v.validatePinnedChartVersion(ctx, nil, res)
 }
 
 // ValidateUpdate implements admission.CustomValidator.
 // This validator:
 //  - prevents selecting another major version (major version upgrade is currently unsupported)
-//  - prevents storage capacity to be decreased
-func (v *PostgresqlStandaloneValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) error {
+//  - prevents storage capacity to be decreased, or increased if the storage class doesn't allow volume expansion
+//  - prevents non-admins from pinning the chart version
+//  - prevents users other than the operator and admins from changing the chart version of a rollout
+//  - prevents referencing a plan that doesn't exist
+//  - prevents resources outside the operator-configured minima and maxima, and requests that exceed limits
+//  - prevents storage classes that the operator doesn't allow, and changing the storage class while a migration is in progress
+//  - prevents storage autoscaling that doesn't increase the storage capacity
+//  - prevents hibernating an instance while its storage is being migrated
+//  - prevents PostgreSQL settings with invalid names or line breaks, and settings that the operator-config doesn't allow
+func (v *PostgresqlStandaloneValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
 	newInstance := newObj.(*v1alpha1.PostgresqlStandalone)
 	oldInstance := oldObj.(*v1alpha1.PostgresqlStandalone)
 	if newInstance.Spec.Parameters.MajorVersion != oldInstance.Spec.Parameters.MajorVersion {
@@ -37,7 +68,31 @@ func (v *PostgresqlStandaloneValidator) ValidateUpdate(_ context.Context, oldObj
 	if newInstance.Spec.Parameters.Resources.StorageCapacity.Cmp(*oldInstance.Spec.Parameters.Resources.StorageCapacity) == -1 {
 		return fmt.Errorf("storage capacity cannot be decreased")
 	}
-	return nil
+	if err := v.validateVolumeExpansion(ctx, oldInstance, newInstance); err != nil {
+		return err
+	}
+	if err := v.validatePlan(ctx, oldInstance, newInstance); err != nil {
+		return err
+	}
+	if err := v.validateResources(ctx, oldInstance, newInstance); err != nil {
+		return err
+	}
+	if err := v.validateStorageClass(ctx, oldInstance, newInstance); err != nil {
+		return err
+	}
+	if err := validateStorageAutoscaling(newInstance); err != nil {
+		return err
+	}
+	if err := validateHibernation(oldInstance, newInstance); err != nil {
+		return err
+	}
+	if err := v.validatePostgresqlSettings(ctx, oldInstance, newInstance); err != nil {
+		return err
+	}
+	if err := validateRolloutChartVersion(ctx, oldInstance, newInstance); err != nil {
+		return err
+	}
+	return v.validatePinnedChartVersion(ctx, oldInstance, newInstance)
 }
 
 // ValidateDelete implements admission.CustomValidator.
@@ -48,3 +103,258 @@ func (v *PostgresqlStandaloneValidator) ValidateDelete(ctx context.Context, obj
 	//TODO implement me
 	return nil
 }
+
+// validatePinnedChartVersion ensures that only admins change the v1alpha1.PinnedChartVersionAnnotationKey annotation.
+// The pinned chart version has to be a concrete semantic version that matches an entry of the HelmReleases of the v1alpha1.PostgresqlStandaloneOperatorConfig
+// for the major version of the instance, either exactly or by its constraint, see steps.FindHelmReleaseConfig.
+func (v *PostgresqlStandaloneValidator) validatePinnedChartVersion(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	pinned, oldPinned := newInstance.GetPinnedChartVersion(), ""
+	if oldInstance != nil {
+		oldPinned = oldInstance.GetPinnedChartVersion()
+	}
+	if pinned == oldPinned {
+		return nil
+	}
+	if !isAdminRequest(ctx) {
+		return fmt.Errorf("only platform admins are allowed to change the annotation %s", v1alpha1.PinnedChartVersionAnnotationKey)
+	}
+	if pinned == "" {
+		return nil
+	}
+	if _, err := semver.StrictNewVersion(pinned); err != nil {
+		return fmt.Errorf("chart version %s is not a concrete semantic version", pinned)
+	}
+
+	majorVersion := newInstance.Spec.Parameters.MajorVersion.String()
+	list := &v1alpha1.PostgresqlStandaloneOperatorConfigList{}
+	err := v.kube.List(ctx, list, client.InNamespace(OperatorNamespace), client.MatchingLabels{v1alpha1.PostgresqlMajorVersionLabelKey: majorVersion})
+	if err != nil {
+		return err
+	}
+	for _, config := range list.Items {
+		if release, _ := steps.FindHelmReleaseConfig(config.Spec.HelmReleases, pinned); release != nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("chart version %s is not listed in the HelmReleases of the %s for major version %s", pinned, v1alpha1.PostgresqlStandaloneOperatorConfigKind, majorVersion)
+}
+
+// validatePostgresqlSettings ensures that the added or changed PostgresqlSettings of the instance have valid names and no line breaks in their values,
+// and that the Tuning of the v1alpha1.PostgresqlStandaloneOperatorConfig for the major version of the instance allows them.
+// Unchanged settings aren't validated, so that changing the config doesn't block other changes to existing instances.
+func (v *PostgresqlStandaloneValidator) validatePostgresqlSettings(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	names := make([]string, 0)
+	for name, value := range newInstance.Spec.Parameters.PostgresqlSettings {
+		if oldInstance != nil {
+			if oldValue, exists := oldInstance.Spec.Parameters.PostgresqlSettings[name]; exists && oldValue == value {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !steps.PostgresqlSettingNamePattern.MatchString(name) {
+			return fmt.Errorf("PostgreSQL setting %q is not a valid name, it has to match %s", name, steps.PostgresqlSettingNamePattern)
+		}
+		if strings.ContainsAny(newInstance.Spec.Parameters.PostgresqlSettings[name], "\r\n") {
+			return fmt.Errorf("value of PostgreSQL setting %s cannot contain line breaks", name)
+		}
+	}
+
+	configs, err := listOperatorConfigs(ctx, v.kube, newInstance)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		for _, name := range names {
+			if !config.Spec.Tuning.IsSettingAllowed(name) {
+				return fmt.Errorf("PostgreSQL setting %s is not allowed by the %s for major version %s", name, v1alpha1.PostgresqlStandaloneOperatorConfigKind, newInstance.Spec.Parameters.MajorVersion)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRolloutChartVersion ensures that only the operator and admins change the steps.RolloutChartVersionAnnotationKey annotation.
+// Otherwise, tenants could upgrade their instance ahead of the rollout or hold it back.
+func validateRolloutChartVersion(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	version, oldVersion := newInstance.Annotations[steps.RolloutChartVersionAnnotationKey], ""
+	if oldInstance != nil {
+		oldVersion = oldInstance.Annotations[steps.RolloutChartVersionAnnotationKey]
+	}
+	if version == oldVersion || isOperatorRequest(ctx) || isAdminRequest(ctx) {
+		return nil
+	}
+	return fmt.Errorf("only the operator and platform admins are allowed to change the annotation %s", steps.RolloutChartVersionAnnotationKey)
+}
+
+// validatePlan ensures that a newly referenced v1alpha1.Plan exists in the v1alpha1.PostgresqlStandaloneOperatorConfig for the major version of the instance.
+// An unchanged plan isn't validated, so that removing a plan from the config doesn't block other changes to existing instances.
+func (v *PostgresqlStandaloneValidator) validatePlan(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	name := newInstance.Spec.Parameters.Plan
+	if name == "" || (oldInstance != nil && oldInstance.Spec.Parameters.Plan == name) {
+		return nil
+	}
+	plan, err := findPlan(ctx, v.kube, newInstance)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return fmt.Errorf("plan %s is not defined in the %s for major version %s", name, v1alpha1.PostgresqlStandaloneOperatorConfigKind, newInstance.Spec.Parameters.MajorVersion)
+	}
+	return nil
+}
+
+// validateResources ensures that the requests of the instance don't exceed its limits,
+// and that its resources are within the ResourceMinima and ResourceMaxima of the v1alpha1.PostgresqlStandaloneOperatorConfig for the major version of the instance.
+// Requests and limits that are derived with the ResourceRatio of the config are validated as well.
+// Resources that didn't change aren't validated against the minima and maxima, so that changing them doesn't block other changes to existing instances.
+func (v *PostgresqlStandaloneValidator) validateResources(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	resources := newInstance.Spec.Parameters.Resources
+	for _, pair := range []struct {
+		name           string
+		request, limit *resource.Quantity
+	}{
+		{"CPU", resources.CPURequest, resources.CPULimit},
+		{"memory", resources.MemoryRequest, resources.MemoryLimit},
+	} {
+		if pair.request != nil && pair.limit != nil && pair.request.Cmp(*pair.limit) > 0 {
+			return fmt.Errorf("%s request %s exceeds %s limit %s", pair.name, pair.request, pair.name, pair.limit)
+		}
+	}
+	if oldInstance != nil && getChangedQuantities(&oldInstance.Spec.Parameters.Resources, &resources) == nil {
+		return nil
+	}
+
+	configs, err := listOperatorConfigs(ctx, v.kube, newInstance)
+	if err != nil {
+		return err
+	}
+	given := resources.GetQuantities()
+	for i := range configs {
+		config := &configs[i]
+		var oldResources *v1alpha1.Resources
+		if oldInstance != nil {
+			oldResources = steps.GetDerivedResources(config, oldInstance)
+		}
+		changed := getChangedQuantities(oldResources, steps.GetDerivedResources(config, newInstance))
+		names := make([]string, 0, len(changed))
+		for name := range changed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		minima, maxima := config.Spec.ResourceMinima.GetQuantities(), config.Spec.ResourceMaxima.GetQuantities()
+		for _, name := range names {
+			quantity := changed[name]
+			description := quantity.String()
+			if _, exists := given[name]; !exists {
+				description += " (derived with the resource ratio)"
+			}
+			if minimum, exists := minima[name]; exists && quantity.Cmp(*minimum) < 0 {
+				return fmt.Errorf("%s %s is lower than the minimum of %s", name, description, minimum)
+			}
+			if maximum, exists := maxima[name]; exists && quantity.Cmp(*maximum) > 0 {
+				return fmt.Errorf("%s %s is higher than the maximum of %s", name, description, maximum)
+			}
+		}
+	}
+	return nil
+}
+
+// getChangedQuantities returns the quantities of the new resources that are different from the old resources.
+// All quantities are returned if there are no old resources, and nil if nothing changed.
+func getChangedQuantities(oldResources, newResources *v1alpha1.Resources) map[string]*resource.Quantity {
+	changed := newResources.GetQuantities()
+	if oldResources != nil {
+		for name, quantity := range oldResources.GetQuantities() {
+			if newQuantity, exists := changed[name]; exists && newQuantity.Cmp(*quantity) == 0 {
+				delete(changed, name)
+			}
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return changed
+}
+
+// validateStorageClass ensures that a newly chosen storage class is allowed by the Persistence of the v1alpha1.PostgresqlStandaloneOperatorConfig for the major version of the instance.
+// The storage class of an existing instance can't be changed while its data is being migrated,
+// nor if the instance is deployed with v1alpha1.StrategyCloudNativePG, which doesn't support storage migrations.
+// An unchanged storage class isn't validated, so that removing it from the config doesn't block other changes to existing instances.
+func (v *PostgresqlStandaloneValidator) validateStorageClass(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	name := newInstance.Spec.Parameters.Resources.StorageClassName
+	if name == "" || (oldInstance != nil && oldInstance.Spec.Parameters.Resources.StorageClassName == name) {
+		return nil
+	}
+	if oldInstance != nil {
+		if oldInstance.Status.DeploymentStrategy == v1alpha1.StrategyCloudNativePG {
+			return fmt.Errorf("storage class cannot be changed for instances deployed with %s", v1alpha1.StrategyCloudNativePG)
+		}
+		if migration := oldInstance.Status.StorageMigration; migration != nil && migration.Phase != v1alpha1.StorageMigrationPhaseFailed {
+			return fmt.Errorf("storage class cannot be changed while the migration to storage class %s is in progress", migration.StorageClassName)
+		}
+	}
+	configs, err := listOperatorConfigs(ctx, v.kube, newInstance)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		if config.Spec.Persistence.IsStorageClassAllowed(name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("storage class %s is not allowed in the %s for major version %s", name, v1alpha1.PostgresqlStandaloneOperatorConfigKind, newInstance.Spec.Parameters.MajorVersion)
+}
+
+// validateVolumeExpansion ensures that the storage capacity is only increased if the StorageClass of the instance allows volume expansion.
+// The storage class is the observed storage class in the status of the instance.
+// If it's unknown or doesn't exist, the increase is accepted, since it can't be verified.
+func (v *PostgresqlStandaloneValidator) validateVolumeExpansion(ctx context.Context, oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	oldCapacity, newCapacity := oldInstance.Spec.Parameters.Resources.StorageCapacity, newInstance.Spec.Parameters.Resources.StorageCapacity
+	name := oldInstance.Status.StorageClassName
+	if oldCapacity == nil || newCapacity == nil || newCapacity.Cmp(*oldCapacity) <= 0 || name == "" {
+		return nil
+	}
+	storageClass := &storagev1.StorageClass{}
+	err := v.kube.Get(ctx, client.ObjectKey{Name: name}, storageClass)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if storageClass.AllowVolumeExpansion == nil || !*storageClass.AllowVolumeExpansion {
+		return fmt.Errorf("storage capacity cannot be increased, storage class %s doesn't allow volume expansion", name)
+	}
+	return nil
+}
+
+// validateStorageAutoscaling ensures that the storage autoscaling of the instance increases the storage capacity.
+func validateStorageAutoscaling(instance *v1alpha1.PostgresqlStandalone) error {
+	autoscaling := instance.Spec.Parameters.Resources.StorageAutoscaling
+	if autoscaling == nil {
+		return nil
+	}
+	if autoscaling.Increment.Sign() <= 0 {
+		return fmt.Errorf("storage autoscaling increment %s has to be positive", &autoscaling.Increment)
+	}
+	capacity := instance.Spec.Parameters.Resources.StorageCapacity
+	if autoscaling.Maximum != nil && capacity != nil && autoscaling.Maximum.Cmp(*capacity) < 0 {
+		return fmt.Errorf("storage autoscaling maximum %s is lower than the storage capacity %s", autoscaling.Maximum, capacity)
+	}
+	return nil
+}
+
+// validateHibernation ensures that an instance isn't hibernated while its storage is being migrated, since the migration requires PostgreSQL to run.
+func validateHibernation(oldInstance, newInstance *v1alpha1.PostgresqlStandalone) error {
+	if !newInstance.Spec.Parameters.Hibernated || oldInstance.Spec.Parameters.Hibernated {
+		return nil
+	}
+	if migration := oldInstance.Status.StorageMigration; migration != nil && migration.Phase != v1alpha1.StorageMigrationPhaseFailed {
+		return fmt.Errorf("instance cannot be hibernated while the migration to storage class %s is in progress", migration.StorageClassName)
+	}
+	return nil
+}
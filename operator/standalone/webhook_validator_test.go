@@ -1,12 +1,23 @@
 package standalone
 
 import (
+	"context"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/steps"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 func TestPostgresqlStandaloneValidator_ValidateUpdate(t *testing.T) {
@@ -84,8 +95,10 @@ func TestPostgresqlStandaloneValidator_ValidateUpdate(t *testing.T) {
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			v := PostgresqlStandaloneValidator{}
-			err := v.ValidateUpdate(nil, tc.givenOldSpec, tc.givenNewSpec)
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).Build()}
+			err := v.ValidateUpdate(context.Background(), tc.givenOldSpec, tc.givenNewSpec)
 			if tc.expectedError != "" {
 				assert.EqualError(t, err, tc.expectedError, "validation error")
 				return
@@ -99,3 +112,620 @@ func parseResource(value string) *resource.Quantity {
 	parsed := resource.MustParse(value)
 	return &parsed
 }
+
+func TestPostgresqlStandaloneValidator_ValidatePinnedChartVersion(t *testing.T) {
+	tests := map[string]struct {
+		givenOldPin   string
+		givenNewPin   string
+		givenGroups   []string
+		expectedError string
+	}{
+		"GivenNoPin_ThenExpectNil": {},
+		"GivenUnchangedPin_WhenUserIsNoAdmin_ThenExpectNil": {
+			givenOldPin: "1.0.0",
+			givenNewPin: "1.0.0",
+			givenGroups: []string{"tenant"},
+		},
+		"GivenNewPin_WhenUserIsNoAdmin_ThenExpectError": {
+			givenNewPin:   "1.0.0",
+			givenGroups:   []string{"tenant"},
+			expectedError: "only platform admins are allowed to change the annotation postgresql.appcat.vshn.io/pinned-chart-version",
+		},
+		"GivenRemovedPin_WhenUserIsNoAdmin_ThenExpectError": {
+			givenOldPin:   "1.0.0",
+			givenGroups:   []string{"tenant"},
+			expectedError: "only platform admins are allowed to change the annotation postgresql.appcat.vshn.io/pinned-chart-version",
+		},
+		"GivenNewPin_WhenUserIsAdmin_ThenExpectNil": {
+			givenNewPin: "1.0.0",
+			givenGroups: []string{"tenant", "platform-admins"},
+		},
+		"GivenRemovedPin_WhenUserIsAdmin_ThenExpectNil": {
+			givenOldPin: "1.0.0",
+			givenGroups: []string{"platform-admins"},
+		},
+		"GivenNewPin_WhenVersionNotListed_ThenExpectError": {
+			givenNewPin:   "2.0.0",
+			givenGroups:   []string{"platform-admins"},
+			expectedError: "chart version 2.0.0 is not listed in the HelmReleases of the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenNewPin_WhenVersionMatchesConstraint_ThenExpectNil": {
+			givenNewPin: "3.1.0",
+			givenGroups: []string{"platform-admins"},
+		},
+		"GivenNewPin_WhenPinIsConstraint_ThenExpectError": {
+			givenNewPin:   ">=3.0 <4",
+			givenGroups:   []string{"platform-admins"},
+			expectedError: "chart version >=3.0 <4 is not a concrete semantic version",
+		},
+		"GivenNewPin_WhenPinIsIncompleteVersion_ThenExpectError": {
+			givenNewPin:   "1.0",
+			givenGroups:   []string{"platform-admins"},
+			expectedError: "chart version 1.0 is not a concrete semantic version",
+		},
+	}
+	AdminGroups = []string{"platform-admins"}
+	OperatorNamespace = "postgresql-system"
+	defer func() {
+		AdminGroups = []string{"system:masters"}
+		OperatorNamespace = ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "postgresql-system", Labels: map[string]string{
+					v1alpha1.PostgresqlMajorVersionLabelKey: v1alpha1.PostgresqlVersion14.String(),
+				}},
+				Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+					HelmReleases: []v1alpha1.HelmReleaseConfig{{Chart: v1alpha1.ChartMeta{Version: "1.0.0"}}, {Chart: v1alpha1.ChartMeta{Version: ">=3.0 <4"}}},
+				},
+			}
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()}
+			ctx := context.WithValue(context.Background(), admissionRequestKey{}, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "user", Groups: tc.givenGroups},
+			}})
+			oldInstance := newPinnedInstance(tc.givenOldPin)
+			newInstance := newPinnedInstance(tc.givenNewPin)
+
+			// Act
+			err := v.ValidateUpdate(ctx, oldInstance, newInstance)
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func newPinnedInstance(version string) *v1alpha1.PostgresqlStandalone {
+	instance := &v1alpha1.PostgresqlStandalone{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "my-app"},
+		Spec: v1alpha1.PostgresqlStandaloneSpec{
+			Parameters: v1alpha1.PostgresqlStandaloneParameters{
+				MajorVersion: v1alpha1.PostgresqlVersion14,
+				Resources: v1alpha1.Resources{
+					StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("1Gi")},
+				}},
+		},
+	}
+	if version != "" {
+		instance.Annotations = map[string]string{v1alpha1.PinnedChartVersionAnnotationKey: version}
+	}
+	return instance
+}
+
+func TestPostgresqlStandaloneValidator_ValidatePlan(t *testing.T) {
+	tests := map[string]struct {
+		givenOldPlan  string
+		givenNewPlan  string
+		expectedError string
+	}{
+		"GivenNoPlan_ThenExpectNil": {},
+		"GivenNewPlan_WhenPlanExists_ThenExpectNil": {
+			givenNewPlan: "small",
+		},
+		"GivenNewPlan_WhenPlanUnknown_ThenExpectError": {
+			givenNewPlan:  "unknown",
+			expectedError: "plan unknown is not defined in the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenChangedPlan_WhenPlanUnknown_ThenExpectError": {
+			givenOldPlan:  "small",
+			givenNewPlan:  "unknown",
+			expectedError: "plan unknown is not defined in the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenUnchangedPlan_WhenPlanRemovedFromConfig_ThenExpectNil": {
+			givenOldPlan: "removed",
+			givenNewPlan: "removed",
+		},
+	}
+	OperatorNamespace = "postgresql-system"
+	defer func() {
+		OperatorNamespace = ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(newPlanConfig()).Build()}
+			oldInstance := newPlanInstance(tc.givenOldPlan, "1Gi", "10Gi")
+			newInstance := newPlanInstance(tc.givenNewPlan, "1Gi", "10Gi")
+
+			// Act
+			err := v.ValidateUpdate(context.Background(), oldInstance, newInstance)
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestPostgresqlStandaloneValidator_ValidateResources(t *testing.T) {
+	tests := map[string]struct {
+		givenRatio        v1alpha1.ResourceRatio
+		givenOldResources *v1alpha1.Resources
+		givenNewResources v1alpha1.Resources
+		expectedError     string
+	}{
+		"GivenNewInstance_WhenWithinBounds_ThenExpectNil": {
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi"), CPURequest: parseResource("500m"), CPULimit: parseResource("1")},
+			},
+		},
+		"GivenNewInstance_WhenCPULimitAboveMaximum_ThenExpectError": {
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPULimit: parseResource("3")},
+			},
+			expectedError: "cpuLimit 3 is higher than the maximum of 2",
+		},
+		"GivenNewInstance_WhenMemoryRequestBelowMinimum_ThenExpectError": {
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryRequest: parseResource("128Mi")},
+			},
+			expectedError: "memoryRequest 128Mi is lower than the minimum of 256Mi",
+		},
+		"GivenNewInstance_WhenRequestExceedsLimit_ThenExpectError": {
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("1500m"), CPULimit: parseResource("1")},
+			},
+			expectedError: "CPU request 1500m exceeds CPU limit 1",
+		},
+		"GivenNewInstance_WhenDerivedMemoryRequestBelowMinimum_ThenExpectError": {
+			givenRatio: v1alpha1.ResourceRatio{MemoryRequestPercentage: 50},
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("256Mi")},
+			},
+			expectedError: "memoryRequest 128Mi (derived with the resource ratio) is lower than the minimum of 256Mi",
+		},
+		"GivenNewInstance_WhenDerivedCPULimitAboveMaximum_ThenExpectError": {
+			givenRatio: v1alpha1.ResourceRatio{CPURequestPercentage: 50},
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("1500m")},
+			},
+			expectedError: "cpuLimit 3 (derived with the resource ratio) is higher than the maximum of 2",
+		},
+		"GivenExistingInstance_WhenUnchangedDerivedResourceOutOfBounds_ThenExpectNil": {
+			givenRatio: v1alpha1.ResourceRatio{CPURequestPercentage: 50},
+			givenOldResources: &v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("1500m"), MemoryLimit: parseResource("1Gi")},
+			},
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("1500m"), MemoryLimit: parseResource("2Gi")},
+			},
+		},
+		"GivenExistingInstance_WhenUnchangedResourceOutOfBounds_ThenExpectNil": {
+			givenOldResources: &v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPULimit: parseResource("3"), MemoryLimit: parseResource("1Gi")},
+			},
+			givenNewResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPULimit: parseResource("3"), MemoryLimit: parseResource("2Gi")},
+			},
+		},
+	}
+	OperatorNamespace = "postgresql-system"
+	defer func() {
+		OperatorNamespace = ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			config := newPlanConfig()
+			config.Spec.ResourceMinima = v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{MemoryRequest: parseResource("256Mi"), CPULimit: parseResource("100m")},
+			}
+			config.Spec.ResourceMaxima = v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPULimit: parseResource("2")},
+			}
+			config.Spec.ResourceRatio = tc.givenRatio
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()}
+			newInstance := newPlanInstance("", "", "")
+			newInstance.Spec.Parameters.Resources = tc.givenNewResources
+
+			// Act
+			var err error
+			if tc.givenOldResources != nil {
+				oldInstance := newPlanInstance("", "", "")
+				oldInstance.Spec.Parameters.Resources = *tc.givenOldResources
+				err = v.validateResources(context.Background(), oldInstance, newInstance)
+			} else {
+				err = v.validateResources(context.Background(), nil, newInstance)
+			}
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestPostgresqlStandaloneValidator_ValidateStorageClass(t *testing.T) {
+	tests := map[string]struct {
+		givenOldStorageClass *string
+		givenNewStorageClass string
+		givenStatus          v1alpha1.PostgresqlStandaloneObservation
+		expectedError        string
+	}{
+		"GivenNewInstance_WhenNoStorageClass_ThenExpectNil": {},
+		"GivenNewInstance_WhenDefaultStorageClass_ThenExpectNil": {
+			givenNewStorageClass: "standard",
+		},
+		"GivenNewInstance_WhenAllowedStorageClass_ThenExpectNil": {
+			givenNewStorageClass: "fast",
+		},
+		"GivenNewInstance_WhenUnknownStorageClass_ThenExpectError": {
+			givenNewStorageClass: "unknown",
+			expectedError:        "storage class unknown is not allowed in the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenExistingInstance_WhenUnchangedStorageClassRemovedFromConfig_ThenExpectNil": {
+			givenOldStorageClass: pointer.String("removed"),
+			givenNewStorageClass: "removed",
+		},
+		"GivenExistingInstance_WhenChangedToAllowedStorageClass_ThenExpectNil": {
+			givenOldStorageClass: pointer.String(""),
+			givenNewStorageClass: "fast",
+		},
+		"GivenExistingInstance_WhenMigrationInProgress_ThenExpectError": {
+			givenOldStorageClass: pointer.String("fast"),
+			givenNewStorageClass: "standard",
+			givenStatus: v1alpha1.PostgresqlStandaloneObservation{StorageMigration: &v1alpha1.StorageMigrationStatus{
+				Phase: v1alpha1.StorageMigrationPhaseBackingUp, StorageClassName: "fast",
+			}},
+			expectedError: "storage class cannot be changed while the migration to storage class fast is in progress",
+		},
+		"GivenExistingInstance_WhenMigrationFailed_ThenExpectNil": {
+			givenOldStorageClass: pointer.String("fast"),
+			givenNewStorageClass: "standard",
+			givenStatus: v1alpha1.PostgresqlStandaloneObservation{StorageMigration: &v1alpha1.StorageMigrationStatus{
+				Phase: v1alpha1.StorageMigrationPhaseFailed, StorageClassName: "fast",
+			}},
+		},
+		"GivenExistingInstance_WhenDeployedWithCloudNativePG_ThenExpectError": {
+			givenOldStorageClass: pointer.String(""),
+			givenNewStorageClass: "fast",
+			givenStatus:          v1alpha1.PostgresqlStandaloneObservation{DeploymentStrategy: v1alpha1.StrategyCloudNativePG},
+			expectedError:        "storage class cannot be changed for instances deployed with CloudNativePG",
+		},
+	}
+	OperatorNamespace = "postgresql-system"
+	defer func() {
+		OperatorNamespace = ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			config := newPlanConfig()
+			config.Spec.Persistence.StorageClassName = pointer.String("standard")
+			config.Spec.Persistence.AllowedStorageClasses = []string{"fast", "bulk"}
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()}
+			newInstance := newPlanInstance("", "", "")
+			newInstance.Spec.Parameters.Resources.StorageClassName = tc.givenNewStorageClass
+
+			// Act
+			var err error
+			if tc.givenOldStorageClass != nil {
+				oldInstance := newPlanInstance("", "", "")
+				oldInstance.Spec.Parameters.Resources.StorageClassName = *tc.givenOldStorageClass
+				oldInstance.Status.PostgresqlStandaloneObservation = tc.givenStatus
+				err = v.validateStorageClass(context.Background(), oldInstance, newInstance)
+			} else {
+				err = v.validateStorageClass(context.Background(), nil, newInstance)
+			}
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestPostgresqlStandaloneValidator_ValidatePostgresqlSettings(t *testing.T) {
+	tests := map[string]struct {
+		givenOldSettings map[string]string
+		givenNewSettings map[string]string
+		expectedError    string
+	}{
+		"GivenNewInstance_WhenNoSettings_ThenExpectNil": {},
+		"GivenNewInstance_WhenValidSettings_ThenExpectNil": {
+			givenNewSettings: map[string]string{"work_mem": "8MB", "pg_stat_statements.max": "1000"},
+		},
+		"GivenNewInstance_WhenNameWithLineBreak_ThenExpectError": {
+			givenNewSettings: map[string]string{"work_mem = '8MB'\nshared_preload_libraries": "'evil'"},
+			expectedError:    `PostgreSQL setting "work_mem = '8MB'\nshared_preload_libraries" is not a valid name, it has to match ^[a-z_][a-z0-9_.]*$`,
+		},
+		"GivenNewInstance_WhenUppercaseName_ThenExpectError": {
+			givenNewSettings: map[string]string{"Work_Mem": "8MB"},
+			expectedError:    `PostgreSQL setting "Work_Mem" is not a valid name, it has to match ^[a-z_][a-z0-9_.]*$`,
+		},
+		"GivenNewInstance_WhenValueWithLineBreak_ThenExpectError": {
+			givenNewSettings: map[string]string{"work_mem": "8MB\narchive_command = 'evil'"},
+			expectedError:    "value of PostgreSQL setting work_mem cannot contain line breaks",
+		},
+		"GivenNewInstance_WhenAlwaysDeniedSetting_ThenExpectError": {
+			givenNewSettings: map[string]string{"archive_command": "true"},
+			expectedError:    "PostgreSQL setting archive_command is not allowed by the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenNewInstance_WhenSettingDeniedByConfig_ThenExpectError": {
+			givenNewSettings: map[string]string{"fsync": "off"},
+			expectedError:    "PostgreSQL setting fsync is not allowed by the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenNewInstance_WhenSettingNotInAllowlist_ThenExpectError": {
+			givenNewSettings: map[string]string{"max_connections": "1000"},
+			expectedError:    "PostgreSQL setting max_connections is not allowed by the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+		"GivenExistingInstance_WhenUnchangedDeniedSetting_ThenExpectNil": {
+			givenOldSettings: map[string]string{"fsync": "off"},
+			givenNewSettings: map[string]string{"fsync": "off", "work_mem": "8MB"},
+		},
+		"GivenExistingInstance_WhenChangedDeniedSetting_ThenExpectError": {
+			givenOldSettings: map[string]string{"fsync": "off"},
+			givenNewSettings: map[string]string{"fsync": "on"},
+			expectedError:    "PostgreSQL setting fsync is not allowed by the PostgresqlStandaloneOperatorConfig for major version v14",
+		},
+	}
+	OperatorNamespace = "postgresql-system"
+	defer func() {
+		OperatorNamespace = ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, apis.AddToScheme(scheme))
+			config := newPlanConfig()
+			config.Spec.Tuning.AllowedSettings = []string{"work_mem", "pg_stat_statements.max", "fsync", "archive_command"}
+			config.Spec.Tuning.DeniedSettings = []string{"fsync"}
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()}
+			newInstance := newPlanInstance("", "", "")
+			newInstance.Spec.Parameters.PostgresqlSettings = tc.givenNewSettings
+
+			// Act
+			var err error
+			if tc.givenOldSettings != nil {
+				oldInstance := newPlanInstance("", "", "")
+				oldInstance.Spec.Parameters.PostgresqlSettings = tc.givenOldSettings
+				err = v.validatePostgresqlSettings(context.Background(), oldInstance, newInstance)
+			} else {
+				err = v.validatePostgresqlSettings(context.Background(), nil, newInstance)
+			}
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestPostgresqlStandaloneValidator_ValidateVolumeExpansion(t *testing.T) {
+	tests := map[string]struct {
+		givenStorageClass string
+		givenNewCapacity  string
+		expectedError     string
+	}{
+		"GivenUnchangedCapacity_ThenExpectNil": {
+			givenStorageClass: "fixed",
+			givenNewCapacity:  "10Gi",
+		},
+		"GivenIncreasedCapacity_WhenExpansionAllowed_ThenExpectNil": {
+			givenStorageClass: "expandable",
+			givenNewCapacity:  "20Gi",
+		},
+		"GivenIncreasedCapacity_WhenExpansionNotAllowed_ThenExpectError": {
+			givenStorageClass: "fixed",
+			givenNewCapacity:  "20Gi",
+			expectedError:     "storage capacity cannot be increased, storage class fixed doesn't allow volume expansion",
+		},
+		"GivenIncreasedCapacity_WhenStorageClassUnknown_ThenExpectNil": {
+			givenNewCapacity: "20Gi",
+		},
+		"GivenIncreasedCapacity_WhenStorageClassNotFound_ThenExpectNil": {
+			givenStorageClass: "missing",
+			givenNewCapacity:  "20Gi",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			scheme := runtime.NewScheme()
+			require.NoError(t, storagev1.AddToScheme(scheme))
+			v := PostgresqlStandaloneValidator{kube: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "expandable"}, AllowVolumeExpansion: pointer.Bool(true)},
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fixed"}},
+			).Build()}
+			oldInstance := newPlanInstance("", "", "10Gi")
+			oldInstance.Status.StorageClassName = tc.givenStorageClass
+			newInstance := newPlanInstance("", "", tc.givenNewCapacity)
+
+			// Act
+			err := v.validateVolumeExpansion(context.Background(), oldInstance, newInstance)
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestValidateStorageAutoscaling(t *testing.T) {
+	tests := map[string]struct {
+		givenAutoscaling *v1alpha1.StorageAutoscaling
+		expectedError    string
+	}{
+		"GivenNoAutoscaling_ThenExpectNil": {},
+		"GivenAutoscaling_ThenExpectNil": {
+			givenAutoscaling: &v1alpha1.StorageAutoscaling{ThresholdPercentage: 80, Increment: resource.MustParse("5Gi"), Maximum: parseResource("50Gi")},
+		},
+		"GivenZeroIncrement_ThenExpectError": {
+			givenAutoscaling: &v1alpha1.StorageAutoscaling{ThresholdPercentage: 80},
+			expectedError:    "storage autoscaling increment 0 has to be positive",
+		},
+		"GivenMaximumBelowCapacity_ThenExpectError": {
+			givenAutoscaling: &v1alpha1.StorageAutoscaling{ThresholdPercentage: 80, Increment: resource.MustParse("5Gi"), Maximum: parseResource("5Gi")},
+			expectedError:    "storage autoscaling maximum 5Gi is lower than the storage capacity 10Gi",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newPlanInstance("", "", "10Gi")
+			instance.Spec.Parameters.Resources.StorageAutoscaling = tc.givenAutoscaling
+
+			err := validateStorageAutoscaling(instance)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestValidateHibernation(t *testing.T) {
+	tests := map[string]struct {
+		givenMigration *v1alpha1.StorageMigrationStatus
+		givenHibernate bool
+		expectedError  string
+	}{
+		"GivenHibernate_WhenNoMigration_ThenExpectNil": {
+			givenHibernate: true,
+		},
+		"GivenHibernate_WhenMigrationInProgress_ThenExpectError": {
+			givenMigration: &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseBackingUp, StorageClassName: "fast"},
+			givenHibernate: true,
+			expectedError:  "instance cannot be hibernated while the migration to storage class fast is in progress",
+		},
+		"GivenHibernate_WhenMigrationFailed_ThenExpectNil": {
+			givenMigration: &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseFailed, StorageClassName: "fast"},
+			givenHibernate: true,
+		},
+		"GivenNoHibernation_WhenMigrationInProgress_ThenExpectNil": {
+			givenMigration: &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseRestoring, StorageClassName: "fast"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			oldInstance := newPlanInstance("", "", "10Gi")
+			oldInstance.Status.StorageMigration = tc.givenMigration
+			newInstance := oldInstance.DeepCopy()
+			newInstance.Spec.Parameters.Hibernated = tc.givenHibernate
+
+			err := validateHibernation(oldInstance, newInstance)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
+
+func TestValidateRolloutChartVersion(t *testing.T) {
+	tests := map[string]struct {
+		givenOldVersion string
+		givenNewVersion string
+		givenUser       authenticationv1.UserInfo
+		expectedError   string
+	}{
+		"GivenUnchangedVersion_WhenUserIsTenant_ThenExpectNil": {
+			givenOldVersion: "1.0.0",
+			givenNewVersion: "1.0.0",
+			givenUser:       authenticationv1.UserInfo{Username: "tenant", Groups: []string{"tenant"}},
+		},
+		"GivenNewVersion_WhenUserIsTenant_ThenExpectError": {
+			givenNewVersion: "2.0.0",
+			givenUser:       authenticationv1.UserInfo{Username: "tenant", Groups: []string{"tenant"}},
+			expectedError:   "only the operator and platform admins are allowed to change the annotation postgresql.appcat.vshn.io/rollout-chart-version",
+		},
+		"GivenRemovedVersion_WhenUserIsTenant_ThenExpectError": {
+			givenOldVersion: "2.0.0",
+			givenUser:       authenticationv1.UserInfo{Username: "tenant", Groups: []string{"tenant"}},
+			expectedError:   "only the operator and platform admins are allowed to change the annotation postgresql.appcat.vshn.io/rollout-chart-version",
+		},
+		"GivenNewVersion_WhenUserIsOperator_ThenExpectNil": {
+			givenNewVersion: "2.0.0",
+			givenUser:       authenticationv1.UserInfo{Username: "system:serviceaccount:postgresql-system:operator", Groups: []string{"system:serviceaccounts:postgresql-system"}},
+		},
+		"GivenNewVersion_WhenUserIsAdmin_ThenExpectNil": {
+			givenNewVersion: "2.0.0",
+			givenUser:       authenticationv1.UserInfo{Username: "admin", Groups: []string{"platform-admins"}},
+		},
+	}
+	AdminGroups = []string{"platform-admins"}
+	OperatorNamespace, OperatorServiceAccount = "postgresql-system", "operator"
+	defer func() {
+		AdminGroups = []string{"system:masters"}
+		OperatorNamespace, OperatorServiceAccount = "", ""
+	}()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			ctx := context.WithValue(context.Background(), admissionRequestKey{}, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: tc.givenUser,
+			}})
+			oldInstance := newPinnedInstance("")
+			newInstance := newPinnedInstance("")
+			if tc.givenOldVersion != "" {
+				oldInstance.Annotations = map[string]string{steps.RolloutChartVersionAnnotationKey: tc.givenOldVersion}
+			}
+			if tc.givenNewVersion != "" {
+				newInstance.Annotations = map[string]string{steps.RolloutChartVersionAnnotationKey: tc.givenNewVersion}
+			}
+
+			// Act
+			err := validateRolloutChartVersion(ctx, oldInstance, newInstance)
+
+			// Assert
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "validation error")
+				return
+			}
+			require.NoError(t, err, "validation error")
+		})
+	}
+}
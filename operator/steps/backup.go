@@ -22,6 +22,18 @@ func IsBackupEnabledP() pipeline.Predicate {
 	}
 }
 
+// bitnamiBackupCommand dumps all databases in the Bitnami PostgreSQL image with the superuser of the credentials secret.
+const bitnamiBackupCommand = `sh -c 'PGUSER="postgres" PGPASSWORD="$POSTGRES_POSTGRES_PASSWORD" pg_dumpall --clean'`
+
+// getBackupAnnotations returns the pod annotations that tell K8up to back up the output of the given command.
+// These annotations can stay, even if backups are disabled, since K8up only backs up pods in namespaces with a schedule.
+func getBackupAnnotations(command string) map[string]string {
+	return map[string]string{
+		"k8up.io/backupcommand":  command,
+		"k8up.io/file-extension": ".sql",
+	}
+}
+
 // EnsureK8upScheduleFn creates the K8up schedule object.
 func EnsureK8upScheduleFn(labelSet labels.Set) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
@@ -33,6 +45,7 @@ func EnsureK8upScheduleFn(labelSet labels.Set) func(ctx context.Context) error {
 		schedule := newK8upSchedule(instance)
 
 		_, err := controllerutil.CreateOrUpdate(ctx, kube, schedule, func() error {
+			propagateMetadata(ctx, schedule)
 			schedule.Labels = labels.Merge(schedule.Labels, labelSet)
 			schedule.Spec = k8upv1.ScheduleSpec{
 				Backup: &k8upv1.BackupSchedule{
@@ -76,7 +89,7 @@ func DeleteK8upScheduleFn() func(ctx context.Context) error {
 		instance := GetInstanceFromContext(ctx)
 		kube := GetClientFromContext(ctx)
 
-		if instance.Status.HelmChart == nil || instance.Status.HelmChart.DeploymentNamespace == "" {
+		if instance.Status.GetDeploymentNamespace() == "" {
 			// deployment namespace is unknown, we assume it has not been created
 			return nil
 		}
@@ -90,7 +103,7 @@ func newK8upSchedule(instance *v1alpha1.PostgresqlStandalone) *k8upv1.Schedule {
 	return &k8upv1.Schedule{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "postgresql",
-			Namespace: instance.Status.HelmChart.DeploymentNamespace,
+			Namespace: instance.Status.GetDeploymentNamespace(),
 		},
 	}
 }
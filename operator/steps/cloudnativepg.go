@@ -0,0 +1,240 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// CloudNativePGClusterGVK is the GroupVersionKind of the CloudNativePG Cluster resource.
+// The resource is handled as unstructured object, so that the operator doesn't depend on the CloudNativePG API module.
+var CloudNativePGClusterGVK = schema.GroupVersionKind{Group: "postgresql.cnpg.io", Version: "v1", Kind: "Cluster"}
+
+const (
+	// cloudNativePGHealthyPhase is the phase of a CloudNativePG Cluster in which all instances are running.
+	cloudNativePGHealthyPhase = "Cluster in healthy state"
+	// cloudNativePGDefaultImageRepository is the repository of the PostgreSQL images provided by CloudNativePG.
+	cloudNativePGDefaultImageRepository = "ghcr.io/cloudnative-pg/postgresql"
+)
+
+// CloudNativePGStrategy is the DeploymentStrategy that deploys PostgreSQL with a CloudNativePG Cluster.
+// The CloudNativePG operator has to be installed in the cluster.
+// CloudNativePG manages its own PVC and secrets, the credentials are copied from the credentials secret of the instance into secrets of the format that CloudNativePG requires.
+type CloudNativePGStrategy struct{}
+
+// Ensure implements DeploymentStrategy.
+// The Cluster and its secrets are created or updated in the deployment namespace.
+func (s *CloudNativePGStrategy) Ensure(ctx context.Context, labelSet labels.Set) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	config := GetConfigFromContext(ctx)
+	deploymentNamespace := getFromContextOrPanic(ctx, DeploymentNamespaceKey{}).(*corev1.Namespace)
+	credentialSecret := getFromContextOrPanic(ctx, CredentialSecretKey{}).(*corev1.Secret)
+
+	ns := deploymentNamespace.Name
+	for name, auth := range map[string][2][]byte{
+		getCloudNativePGAppSecretName():       {[]byte(instance.Name), credentialSecret.Data["password"]},
+		getCloudNativePGSuperuserSecretName(): {[]byte("postgres"), credentialSecret.Data["postgres-password"]},
+	} {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+		username, password := auth[0], auth[1]
+		_, err := controllerutil.CreateOrUpdate(ctx, kube, secret, func() error {
+			secret.Labels = labels.Merge(secret.Labels, labelSet)
+			secret.Type = corev1.SecretTypeBasicAuth
+			secret.Data = map[string][]byte{
+				corev1.BasicAuthUsernameKey: username,
+				corev1.BasicAuthPasswordKey: password,
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cluster := newCloudNativePGCluster(ns)
+	_, err := controllerutil.CreateOrUpdate(ctx, kube, cluster, func() error {
+		cluster.SetLabels(labels.Merge(cluster.GetLabels(), labelSet))
+		setCloudNativePGHibernation(cluster, instance)
+		return setCloudNativePGClusterSpec(cluster, instance, config)
+	})
+	pipeline.StoreInContext(ctx, CloudNativePGClusterKey{}, cluster)
+	return err
+}
+
+// Observe implements DeploymentStrategy.
+// See updateDeploymentStatus.
+func (s *CloudNativePGStrategy) Observe(ctx context.Context) error {
+	cluster := getFromContextOrPanic(ctx, CloudNativePGClusterKey{}).(*unstructured.Unstructured)
+	return updateDeploymentStatus(ctx, v1alpha1.StrategyCloudNativePG, cluster.GetNamespace())
+}
+
+// IsReady implements DeploymentStrategy.
+// See isCloudNativePGClusterReady.
+func (s *CloudNativePGStrategy) IsReady(ctx context.Context) bool {
+	cluster := getFromContextOrPanic(ctx, CloudNativePGClusterKey{}).(*unstructured.Unstructured)
+	return isCloudNativePGClusterReady(cluster)
+}
+
+// Delete implements DeploymentStrategy.
+// Ignores "not found" errors and returns nil if deployment namespace is unknown.
+func (s *CloudNativePGStrategy) Delete(ctx context.Context) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+
+	ns := instance.Status.GetDeploymentNamespace()
+	if ns == "" {
+		// Resources might not ever have existed, skip
+		return nil
+	}
+	for _, obj := range []client.Object{
+		newCloudNativePGCluster(ns),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: getCloudNativePGAppSecretName(), Namespace: ns}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: getCloudNativePGSuperuserSecretName(), Namespace: ns}},
+	} {
+		if err := kube.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServiceName implements DeploymentStrategy.
+// CloudNativePG creates a service with the suffix `-rw` that points to the primary.
+func (s *CloudNativePGStrategy) ServiceName() string {
+	return fmt.Sprintf("%s-rw", getDeploymentName())
+}
+
+// isCloudNativePGClusterReady returns true if the Cluster is healthy and all of its instances are ready.
+func isCloudNativePGClusterReady(cluster *unstructured.Unstructured) bool {
+	phase, _, _ := unstructured.NestedString(cluster.Object, "status", "phase")
+	instances, _, _ := unstructured.NestedInt64(cluster.Object, "spec", "instances")
+	readyInstances, _, _ := unstructured.NestedInt64(cluster.Object, "status", "readyInstances")
+	return phase == cloudNativePGHealthyPhase && instances > 0 && readyInstances >= instances
+}
+
+// setCloudNativePGClusterSpec maps the parameters of the instance onto the spec of the Cluster.
+// Fields of the spec that aren't managed by the operator are left untouched.
+func setCloudNativePGClusterSpec(cluster *unstructured.Unstructured, instance *v1alpha1.PostgresqlStandalone, config *v1alpha1.PostgresqlStandaloneOperatorConfig) error {
+	plan, err := getPlan(config, instance)
+	if err != nil {
+		return err
+	}
+	imageName := ""
+	var platformParameters map[string]string
+	if cnpgConfig := config.Spec.CloudNativePG; cnpgConfig != nil {
+		imageName = cnpgConfig.ImageName
+		platformParameters = cnpgConfig.Parameters
+	}
+	parameters := map[string]interface{}{}
+	for key, value := range getPostgresqlSettings(config, instance, platformParameters) {
+		parameters[key] = value
+	}
+	if imageName == "" {
+		imageName = fmt.Sprintf("%s:%s", cloudNativePGDefaultImageRepository, strings.TrimPrefix(instance.Spec.Parameters.MajorVersion.String(), "v"))
+	}
+	storage := map[string]interface{}{
+		"size": instance.Spec.Parameters.Resources.StorageCapacity.String(),
+	}
+	if storageClass := getStorageClassName(config, instance); storageClass != nil {
+		storage["storageClass"] = *storageClass
+	}
+
+	annotations := map[string]interface{}{"postgresql.appcat.vshn.io/storage-capacity": instance.Spec.Parameters.Resources.StorageCapacity.String()}
+	for key, value := range getBackupAnnotations("sh -c 'pg_dumpall --clean'") {
+		annotations[key] = value
+	}
+	fields := map[string]interface{}{
+		"instances":             int64(1),
+		"imageName":             imageName,
+		"enableSuperuserAccess": true, // See https://github.com/vshn/appcat-service-postgresql/issues/83 why we always create a superuser
+		"superuserSecret":       map[string]interface{}{"name": getCloudNativePGSuperuserSecretName()},
+		"bootstrap": map[string]interface{}{
+			"initdb": map[string]interface{}{
+				"database": instance.Name,
+				"owner":    instance.Name,
+				"secret":   map[string]interface{}{"name": getCloudNativePGAppSecretName()},
+			},
+		},
+		"storage":   storage,
+		"resources": getResourceValues(getComputeResources(config, instance)),
+		"postgresql": map[string]interface{}{
+			"parameters": parameters,
+		},
+		"inheritedMetadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	}
+	for key, value := range fields {
+		if err := unstructured.SetNestedField(cluster.Object, value, "spec", key); err != nil {
+			return err
+		}
+	}
+	return setCloudNativePGAffinity(cluster, getScheduling(config, plan))
+}
+
+// cloudNativePGAffinity contains the fields of the affinity configuration of a CloudNativePG Cluster that are derived from a v1alpha1.SchedulingSpec.
+type cloudNativePGAffinity struct {
+	NodeSelector              map[string]string       `json:"nodeSelector,omitempty"`
+	Tolerations               []corev1.Toleration     `json:"tolerations,omitempty"`
+	NodeAffinity              *corev1.NodeAffinity    `json:"nodeAffinity,omitempty"`
+	AdditionalPodAffinity     *corev1.PodAffinity     `json:"additionalPodAffinity,omitempty"`
+	AdditionalPodAntiAffinity *corev1.PodAntiAffinity `json:"additionalPodAntiAffinity,omitempty"`
+}
+
+// setCloudNativePGAffinity maps the given scheduling constraints onto `spec.affinity` and `spec.priorityClassName` of the Cluster.
+// The pod (anti-)affinities are added to the ones that CloudNativePG derives from the other fields of `spec.affinity`, which are left untouched.
+// The Cluster has no topology spread constraints, so they only apply to the other deployment strategies.
+func setCloudNativePGAffinity(cluster *unstructured.Unstructured, scheduling v1alpha1.SchedulingSpec) error {
+	affinity := cloudNativePGAffinity{NodeSelector: scheduling.NodeSelector, Tolerations: scheduling.Tolerations}
+	if scheduling.Affinity != nil {
+		affinity.NodeAffinity = scheduling.Affinity.NodeAffinity
+		affinity.AdditionalPodAffinity = scheduling.Affinity.PodAffinity
+		affinity.AdditionalPodAntiAffinity = scheduling.Affinity.PodAntiAffinity
+	}
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&affinity)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{"nodeSelector", "tolerations", "nodeAffinity", "additionalPodAffinity", "additionalPodAntiAffinity"} {
+		if value, exists := fields[key]; exists {
+			if err := unstructured.SetNestedField(cluster.Object, value, "spec", "affinity", key); err != nil {
+				return err
+			}
+			continue
+		}
+		unstructured.RemoveNestedField(cluster.Object, "spec", "affinity", key)
+	}
+	if scheduling.PriorityClassName == "" {
+		unstructured.RemoveNestedField(cluster.Object, "spec", "priorityClassName")
+		return nil
+	}
+	return unstructured.SetNestedField(cluster.Object, scheduling.PriorityClassName, "spec", "priorityClassName")
+}
+
+func newCloudNativePGCluster(namespace string) *unstructured.Unstructured {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(CloudNativePGClusterGVK)
+	cluster.SetName(getDeploymentName())
+	cluster.SetNamespace(namespace)
+	return cluster
+}
+
+func getCloudNativePGAppSecretName() string {
+	return fmt.Sprintf("%s-app", getDeploymentName())
+}
+
+func getCloudNativePGSuperuserSecretName() string {
+	return fmt.Sprintf("%s-superuser", getDeploymentName())
+}
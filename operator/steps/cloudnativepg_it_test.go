@@ -0,0 +1,133 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type CloudNativePGSuite struct {
+	operatortest.Suite
+}
+
+func TestCloudNativePGSuite(t *testing.T) {
+	suite.Run(t, new(CloudNativePGSuite))
+}
+
+func (ts *CloudNativePGSuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+}
+
+func (ts *CloudNativePGSuite) Test_Ensure() {
+	// Arrange
+	deploymentNamespace := "cnpg-ensure"
+	instance := newInstance("instance", "cnpg-instance")
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	credentialSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: getCredentialSecretName(), Namespace: deploymentNamespace},
+		Data: map[string][]byte{
+			"password":          []byte("test"),
+			"postgres-password": []byte("superuser"),
+		},
+	}
+	ts.EnsureNS(deploymentNamespace)
+	ts.EnsureNS(instance.Namespace)
+	ts.EnsureResources(instance)
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: deploymentNamespace}})
+	pipeline.StoreInContext(ts.Context, CredentialSecretKey{}, credentialSecret)
+	pipeline.StoreInContext(ts.Context, DeploymentStrategyKey{}, &CloudNativePGStrategy{})
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	strategy := &CloudNativePGStrategy{}
+
+	// Act
+	err := strategy.Ensure(ts.Context, labels.Set{"test": "label"})
+	ts.Require().NoError(err)
+
+	// Assert
+	cluster := newCloudNativePGCluster(deploymentNamespace)
+	ts.FetchResource(types.NamespacedName{Name: "postgresql", Namespace: deploymentNamespace}, cluster)
+	ts.Assert().Equal("label", cluster.GetLabels()["test"])
+	imageName, _, _ := unstructured.NestedString(cluster.Object, "spec", "imageName")
+	ts.Assert().Equal("ghcr.io/cloudnative-pg/postgresql:14", imageName)
+	ts.Assert().False(strategy.IsReady(ts.Context), "cluster ready")
+
+	appSecret := &corev1.Secret{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql-app", Namespace: deploymentNamespace}, appSecret)
+	ts.Assert().Equal(corev1.SecretTypeBasicAuth, appSecret.Type)
+	ts.Assert().Equal("instance", string(appSecret.Data[corev1.BasicAuthUsernameKey]))
+	ts.Assert().Equal("test", string(appSecret.Data[corev1.BasicAuthPasswordKey]))
+	superuserSecret := &corev1.Secret{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql-superuser", Namespace: deploymentNamespace}, superuserSecret)
+	ts.Assert().Equal("postgres", string(superuserSecret.Data[corev1.BasicAuthUsernameKey]))
+	ts.Assert().Equal("superuser", string(superuserSecret.Data[corev1.BasicAuthPasswordKey]))
+
+	ts.Run("GivenHealthyCluster_ThenExpectReady", func() {
+		// Arrange: there's no CloudNativePG operator in envtest that writes the status
+		ts.Require().NoError(unstructured.SetNestedField(cluster.Object, cloudNativePGHealthyPhase, "status", "phase"))
+		ts.Require().NoError(unstructured.SetNestedField(cluster.Object, int64(1), "status", "readyInstances"))
+		ts.Require().NoError(ts.Client.Status().Update(ts.Context, cluster))
+
+		// Act
+		err := strategy.Ensure(ts.Context, labels.Set{"test": "label"})
+		ts.Require().NoError(err)
+
+		// Assert
+		ts.Assert().True(strategy.IsReady(ts.Context), "cluster ready")
+	})
+
+	ts.Run("GivenServiceOfCluster_ThenExpectConnectionSecret", func() {
+		// Arrange: the service is created by the CloudNativePG operator
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "postgresql-rw", Namespace: deploymentNamespace},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 5432}}},
+		}
+		ts.EnsureResources(service)
+		ts.Require().NoError(strategy.Observe(ts.Context))
+
+		// Act
+		err := FetchServiceFn()(ts.Context)
+		ts.Require().NoError(err)
+		err = EnsureConnectionSecretFn(labels.Set{})(ts.Context)
+		ts.Require().NoError(err)
+
+		// Assert
+		result := &corev1.Secret{}
+		ts.FetchResource(types.NamespacedName{Name: instance.GetConnectionSecretName(), Namespace: instance.Namespace}, result)
+		ts.Assert().Equal("postgresql-rw.cnpg-ensure.svc.cluster.local", string(result.Data["POSTGRESQL_SERVICE_NAME"]), "service name")
+		ts.Assert().Equal("postgresql://postgresql-rw.cnpg-ensure.svc.cluster.local:5432", string(result.Data["POSTGRESQL_SERVICE_URL"]), "service url")
+		ts.Assert().Equal("test", string(result.Data["POSTGRESQL_PASSWORD"]), "password")
+	})
+}
+
+func (ts *CloudNativePGSuite) Test_Delete() {
+	// Arrange
+	deploymentNamespace := "cnpg-delete"
+	instance := newInstance("instance", "my-app")
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	SetInstanceInContext(ts.Context, instance)
+	ts.EnsureNS(deploymentNamespace)
+	cluster := newCloudNativePGCluster(deploymentNamespace)
+	cluster.Object["spec"] = map[string]interface{}{"instances": int64(1), "storage": map[string]interface{}{"size": "1Gi"}}
+	ts.EnsureResources(cluster)
+
+	// Act
+	err := (&CloudNativePGStrategy{}).Delete(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	err = ts.Client.Get(ts.Context, types.NamespacedName{Name: "postgresql", Namespace: deploymentNamespace}, newCloudNativePGCluster(deploymentNamespace))
+	ts.Assert().True(apierrors.IsNotFound(err), "not found error expected")
+}
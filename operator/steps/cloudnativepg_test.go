@@ -0,0 +1,168 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+)
+
+func TestIsCloudNativePGClusterReady(t *testing.T) {
+	tests := map[string]struct {
+		givenStatus   map[string]interface{}
+		expectedReady bool
+	}{
+		"GivenNewCluster_WhenNoStatus_ThenExpectNotReady": {
+			expectedReady: false,
+		},
+		"GivenCluster_WhenSettingUp_ThenExpectNotReady": {
+			givenStatus:   map[string]interface{}{"phase": "Setting up primary", "readyInstances": int64(0)},
+			expectedReady: false,
+		},
+		"GivenCluster_WhenHealthy_ThenExpectReady": {
+			givenStatus:   map[string]interface{}{"phase": cloudNativePGHealthyPhase, "readyInstances": int64(1)},
+			expectedReady: true,
+		},
+		"GivenCluster_WhenHealthyButInstanceNotReady_ThenExpectNotReady": {
+			givenStatus:   map[string]interface{}{"phase": cloudNativePGHealthyPhase, "readyInstances": int64(0)},
+			expectedReady: false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cluster := newCloudNativePGCluster("namespace")
+			cluster.Object["spec"] = map[string]interface{}{"instances": int64(1)}
+			if tc.givenStatus != nil {
+				cluster.Object["status"] = tc.givenStatus
+			}
+			assert.Equal(t, tc.expectedReady, isCloudNativePGClusterReady(cluster))
+		})
+	}
+}
+
+func TestSetCloudNativePGClusterSpec(t *testing.T) {
+	tests := map[string]struct {
+		givenConfig        *v1alpha1.CloudNativePGConfig
+		expectedImageName  string
+		expectedParameters map[string]interface{}
+	}{
+		"GivenNoConfig_ThenExpectDefaultImageOfMajorVersionAndDerivedParameters": {
+			expectedImageName: "ghcr.io/cloudnative-pg/postgresql:14",
+			expectedParameters: map[string]interface{}{
+				"effective_cache_size": "1572864kB",
+				"maintenance_work_mem": "104857kB",
+				"max_connections":      "200",
+				"shared_buffers":       "524288kB",
+				"work_mem":             "1966kB",
+			},
+		},
+		"GivenConfig_ThenExpectImageAndParametersFromConfig": {
+			givenConfig: &v1alpha1.CloudNativePGConfig{
+				ImageName:  "registry.example.com/postgresql:14.4",
+				Parameters: map[string]string{"max_connections": "100"},
+			},
+			expectedImageName: "registry.example.com/postgresql:14.4",
+			expectedParameters: map[string]interface{}{
+				"effective_cache_size": "1572864kB",
+				"maintenance_work_mem": "104857kB",
+				"max_connections":      "100",
+				"shared_buffers":       "524288kB",
+				"work_mem":             "1966kB",
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.CloudNativePG = tc.givenConfig
+			config.Spec.Persistence.StorageClassName = pointer.String("ssd")
+			cluster := newCloudNativePGCluster("namespace")
+			cluster.Object["spec"] = map[string]interface{}{"unmanaged": "field"}
+
+			err := setCloudNativePGClusterSpec(cluster, instance, config)
+			require.NoError(t, err)
+
+			spec := cluster.Object["spec"].(map[string]interface{})
+			assert.Equal(t, "field", spec["unmanaged"], "unmanaged field")
+			assert.Equal(t, tc.expectedImageName, spec["imageName"], "image name")
+			assert.Equal(t, int64(1), spec["instances"], "instances")
+			assertNestedField(t, cluster, "2Gi", "spec", "resources", "limits", "memory")
+			assertNestedField(t, cluster, "1Gi", "spec", "storage", "size")
+			assertNestedField(t, cluster, "ssd", "spec", "storage", "storageClass")
+			assertNestedField(t, cluster, "instance", "spec", "bootstrap", "initdb", "database")
+			assertNestedField(t, cluster, "instance", "spec", "bootstrap", "initdb", "owner")
+			assertNestedField(t, cluster, "postgresql-app", "spec", "bootstrap", "initdb", "secret", "name")
+			assertNestedField(t, cluster, "postgresql-superuser", "spec", "superuserSecret", "name")
+			assertNestedField(t, cluster, tc.expectedParameters, "spec", "postgresql", "parameters")
+		})
+	}
+}
+
+func assertNestedField(t *testing.T, obj *unstructured.Unstructured, expected interface{}, fields ...string) {
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+	require.NoError(t, err)
+	assert.True(t, found, "field %v not found", fields)
+	assert.Equal(t, expected, value, "field %v", fields)
+}
+
+func TestSetCloudNativePGClusterSpec_GivenScheduling_ThenExpectAffinity(t *testing.T) {
+	// Arrange
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Plan = "dedicated"
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+	config.Spec.Scheduling = v1alpha1.SchedulingSpec{
+		NodeSelector: map[string]string{"appuio.io/node-class": "db"},
+		Affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+			Weight:          100,
+			PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"},
+		}}}},
+	}
+	config.Spec.Plans = []v1alpha1.Plan{{
+		Name: "dedicated",
+		Scheduling: v1alpha1.SchedulingSpec{
+			Tolerations:       []corev1.Toleration{{Key: "db", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+			PriorityClassName: "database",
+		},
+	}}
+	cluster := newCloudNativePGCluster("namespace")
+	cluster.Object["spec"] = map[string]interface{}{"affinity": map[string]interface{}{
+		"enablePodAntiAffinity": true,
+		"nodeAffinity":          map[string]interface{}{"stale": "affinity"},
+	}}
+
+	// Act
+	err := setCloudNativePGClusterSpec(cluster, instance, config)
+
+	// Assert
+	require.NoError(t, err)
+	assertNestedField(t, cluster, true, "spec", "affinity", "enablePodAntiAffinity")
+	assertNestedField(t, cluster, map[string]interface{}{"appuio.io/node-class": "db"}, "spec", "affinity", "nodeSelector")
+	assertNestedField(t, cluster, []interface{}{
+		map[string]interface{}{"key": "db", "operator": "Exists", "effect": "NoSchedule"},
+	}, "spec", "affinity", "tolerations")
+	assertNestedField(t, cluster, []interface{}{
+		map[string]interface{}{"weight": int64(100), "podAffinityTerm": map[string]interface{}{"topologyKey": "kubernetes.io/hostname"}},
+	}, "spec", "affinity", "additionalPodAntiAffinity", "preferredDuringSchedulingIgnoredDuringExecution")
+	assertNestedField(t, cluster, "database", "spec", "priorityClassName")
+	_, found, _ := unstructured.NestedFieldNoCopy(cluster.Object, "spec", "affinity", "nodeAffinity")
+	assert.False(t, found, "stale node affinity removed")
+}
+
+func TestSetCloudNativePGClusterSpec_GivenUnknownPlan_ThenExpectError(t *testing.T) {
+	// Arrange
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Plan = "unknown"
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{ObjectMeta: metav1.ObjectMeta{Name: "config"}}
+
+	// Act
+	err := setCloudNativePGClusterSpec(newCloudNativePGCluster("namespace"), instance, config)
+
+	// Assert
+	assert.EqualError(t, err, `plan "unknown" is not defined in PostgresqlStandaloneOperatorConfig config`)
+}
@@ -40,6 +40,27 @@ type CredentialSecretKey struct{}
 // InstanceNamespaceKey identifies the namespace resource of the instance in the context.
 type InstanceNamespaceKey struct{}
 
+// DeploymentStrategyKey identifies the DeploymentStrategy of the instance in the context.
+type DeploymentStrategyKey struct{}
+
+// StatefulSetKey identifies the StatefulSet of the instance in the context.
+type StatefulSetKey struct{}
+
+// CloudNativePGClusterKey identifies the CloudNativePG Cluster of the instance in the context.
+type CloudNativePGClusterKey struct{}
+
+// HelmSDKReleaseKey identifies the Helm release of a HelmSDKStrategy in the context.
+type HelmSDKReleaseKey struct{}
+
+// PersistentVolumeClaimKey identifies the PVC that contains the data of the instance in the context.
+type PersistentVolumeClaimKey struct{}
+
+// VolumeUsageReaderKey identifies the VolumeUsageReader in the context.
+type VolumeUsageReaderKey struct{}
+
+// EventRecorderKey identifies the record.EventRecorder for events about the instance in the context.
+type EventRecorderKey struct{}
+
 // SetClientInContext sets the given client in the context.
 func SetClientInContext(ctx context.Context, c client.Client) {
 	pipeline.StoreInContext(ctx, ClientKey{}, c)
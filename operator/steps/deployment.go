@@ -0,0 +1,126 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DeploymentStrategy deploys PostgreSQL for an instance with a specific backend.
+// When the methods are invoked, the instance, the operator config and the deployment namespace are available in the context.
+// The exception is Delete, which only has the instance available.
+type DeploymentStrategy interface {
+	// Ensure creates or updates the resources that deploy PostgreSQL.
+	Ensure(ctx context.Context, labelSet labels.Set) error
+	// Observe updates the status of the instance with the observed state of the deployment and persists the status.
+	Observe(ctx context.Context) error
+	// IsReady returns true if the deployment has become ready after the last change.
+	IsReady(ctx context.Context) bool
+	// Delete removes the resources that deploy PostgreSQL.
+	// It returns nil if the resources don't exist (anymore).
+	Delete(ctx context.Context) error
+	// ServiceName returns the name of the service in the deployment namespace that points to the PostgreSQL primary.
+	ServiceName() string
+}
+
+// DeploymentStrategies contains the available DeploymentStrategy implementations.
+// Strategies that depend on the runtime environment of the operator, like v1alpha1.StrategyHelmSDK, are added during setup of the controller.
+var DeploymentStrategies = map[v1alpha1.DeploymentStrategy]DeploymentStrategy{
+	v1alpha1.StrategyHelmChart:     &HelmChartStrategy{},
+	v1alpha1.StrategyStatefulSet:   &StatefulSetStrategy{},
+	v1alpha1.StrategyCloudNativePG: &CloudNativePGStrategy{},
+}
+
+// SelectDeploymentStrategyFn selects the DeploymentStrategy for the instance in the context and stores it in the context.
+// Existing instances keep the strategy they have been deployed with, new instances get the default strategy of the config.
+func SelectDeploymentStrategyFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+		config := GetConfigFromContext(ctx)
+
+		name := instance.Status.DeploymentStrategy
+		if name == "" {
+			name = config.Spec.DeploymentStrategy
+		}
+		if name == "" {
+			name = v1alpha1.StrategyHelmChart
+		}
+		strategy, err := getDeploymentStrategy(name)
+		if err != nil {
+			return err
+		}
+		instance.Status.DeploymentStrategy = name
+		pipeline.StoreInContext(ctx, DeploymentStrategyKey{}, strategy)
+		return nil
+	}
+}
+
+// EnsureDeploymentFn returns a func that invokes DeploymentStrategy.Ensure of the strategy in the context.
+// The PostgreSQL settings that the strategy derives from the resources of the instance are set in the status of the instance, which the strategy persists in DeploymentStrategy.Observe.
+func EnsureDeploymentFn(labelSet labels.Set) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+		config := GetConfigFromContext(ctx)
+
+		instance.Status.DerivedSettings = getDerivedSettings(config, instance)
+		return getDeploymentStrategyFromContext(ctx).Ensure(ctx, labelSet)
+	}
+}
+
+// ObserveDeploymentFn returns a func that invokes DeploymentStrategy.Observe of the strategy in the context.
+func ObserveDeploymentFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return getDeploymentStrategyFromContext(ctx).Observe(ctx)
+	}
+}
+
+// IsDeploymentReadyP returns a predicate that invokes DeploymentStrategy.IsReady of the strategy in the context.
+func IsDeploymentReadyP() func(ctx context.Context) bool {
+	return func(ctx context.Context) bool {
+		return getDeploymentStrategyFromContext(ctx).IsReady(ctx)
+	}
+}
+
+// DeleteDeploymentFn returns a func that invokes DeploymentStrategy.Delete of the strategy that the instance in the context has been deployed with.
+func DeleteDeploymentFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+
+		strategy, err := getDeploymentStrategy(instance.Status.DeploymentStrategy)
+		if err != nil {
+			return err
+		}
+		return strategy.Delete(ctx)
+	}
+}
+
+// updateDeploymentStatus sets the given strategy and deployment namespace and the observed generation in the status of the instance in the context and persists the status.
+func updateDeploymentStatus(ctx context.Context, strategy v1alpha1.DeploymentStrategy, deploymentNamespace string) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	instance.Status.DeploymentStrategy = strategy
+	instance.Status.SetObservedGeneration(instance)
+	return kube.Status().Update(ctx, instance)
+}
+
+// getDeploymentStrategy returns the DeploymentStrategy with the given name.
+// If the name is empty, the v1alpha1.StrategyHelmChart is returned, since that was the only strategy before strategies were selectable.
+func getDeploymentStrategy(name v1alpha1.DeploymentStrategy) (DeploymentStrategy, error) {
+	if name == "" {
+		name = v1alpha1.StrategyHelmChart
+	}
+	strategy, exists := DeploymentStrategies[name]
+	if !exists {
+		return nil, fmt.Errorf("deployment strategy %q is not supported", name)
+	}
+	return strategy, nil
+}
+
+func getDeploymentStrategyFromContext(ctx context.Context) DeploymentStrategy {
+	return getFromContextOrPanic(ctx, DeploymentStrategyKey{}).(DeploymentStrategy)
+}
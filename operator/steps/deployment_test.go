@@ -0,0 +1,57 @@
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+)
+
+func TestSelectDeploymentStrategyFn(t *testing.T) {
+	tests := map[string]struct {
+		givenStatusStrategy v1alpha1.DeploymentStrategy
+		givenConfigStrategy v1alpha1.DeploymentStrategy
+		expectedStrategy    v1alpha1.DeploymentStrategy
+		expectedError       string
+	}{
+		"GivenNewInstance_WhenConfigHasNoDefault_ThenSelectHelmChart": {
+			expectedStrategy: v1alpha1.StrategyHelmChart,
+		},
+		"GivenNewInstance_WhenConfigHasDefault_ThenSelectDefault": {
+			givenConfigStrategy: v1alpha1.StrategyHelmChart,
+			expectedStrategy:    v1alpha1.StrategyHelmChart,
+		},
+		"GivenExistingInstance_WhenConfigHasOtherDefault_ThenKeepStrategyOfInstance": {
+			givenStatusStrategy: v1alpha1.StrategyHelmChart,
+			givenConfigStrategy: "Unknown",
+			expectedStrategy:    v1alpha1.StrategyHelmChart,
+		},
+		"GivenNewInstance_WhenConfigHasUnknownDefault_ThenReturnError": {
+			givenConfigStrategy: "Unknown",
+			expectedError:       `deployment strategy "Unknown" is not supported`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := pipeline.MutableContext(context.Background())
+			instance := newInstance("instance", "my-app")
+			instance.Status.DeploymentStrategy = tc.givenStatusStrategy
+			SetInstanceInContext(ctx, instance)
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.DeploymentStrategy = tc.givenConfigStrategy
+			pipeline.StoreInContext(ctx, ConfigKey{}, config)
+
+			err := SelectDeploymentStrategyFn()(ctx)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStrategy, instance.Status.DeploymentStrategy)
+			assert.Equal(t, DeploymentStrategies[tc.expectedStrategy], getDeploymentStrategyFromContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+
+	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DeploymentDiscoveredReason is the reason of the event when the deployment of an instance has been discovered from its labelled resources.
+const DeploymentDiscoveredReason = "DeploymentDiscovered"
+
+// DiscoverDeploymentFn returns a func that rebuilds the status of an instance that doesn't know its deployment namespace,
+// for example because the status got lost when the instance has been restored from a backup.
+// The deployment namespace is looked up by the given labels, which identify the instance on all resources deployed for it.
+// If several namespaces match, the one that has the UID of the instance in the label with the given key is preferred.
+// Namespaces that are being deleted are ignored.
+// The deployment strategy and the PVC are then derived from the resources in the namespace, see discoverDeploymentStrategy.
+//
+// Instances that know their deployment namespace are left unchanged, as are new instances for which no namespace is found.
+func DiscoverDeploymentFn(selector labels.Set, uidLabelKey string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		kube := GetClientFromContext(ctx)
+		instance := GetInstanceFromContext(ctx)
+
+		if instance.Status.GetDeploymentNamespace() != "" {
+			return nil
+		}
+		list := &corev1.NamespaceList{}
+		if err := kube.List(ctx, list, client.MatchingLabels(selector)); err != nil {
+			return err
+		}
+		var ns *corev1.Namespace
+		for i, item := range list.Items {
+			if !item.DeletionTimestamp.IsZero() {
+				continue
+			}
+			if ns == nil || item.Labels[uidLabelKey] == string(instance.UID) {
+				ns = &list.Items[i]
+			}
+		}
+		if ns == nil {
+			return nil
+		}
+
+		strategy, err := discoverDeploymentStrategy(ctx, ns.Name)
+		if err != nil {
+			return err
+		}
+		instance.Status.DeploymentNamespace = ns.Name
+		instance.Status.DeploymentStrategy = strategy
+		claimName, err := discoverPVCName(ctx, ns.Name, strategy)
+		if err != nil {
+			return err
+		}
+		instance.Status.PersistentVolumeClaimName = claimName
+
+		log := controllerruntime.LoggerFrom(ctx)
+		log.Info("Discovered existing deployment", "namespace", ns.Name, "strategy", strategy, "claim", claimName)
+		recordEvent(ctx, instance, corev1.EventTypeNormal, DeploymentDiscoveredReason,
+			"Discovered existing deployment in namespace %s with deployment strategy %s", ns.Name, strategy)
+		return kube.Status().Update(ctx, instance)
+	}
+}
+
+// discoverDeploymentStrategy returns the strategy that deployed PostgreSQL in the given namespace, judging from the resources that the strategies create.
+// It returns an empty strategy if none of the resources exist, in which case the strategy is selected as for new instances.
+func discoverDeploymentStrategy(ctx context.Context, ns string) (v1alpha1.DeploymentStrategy, error) {
+	kube := GetClientFromContext(ctx)
+
+	err := kube.Get(ctx, client.ObjectKey{Name: ns}, &helmv1beta1.Release{})
+	if exists, err := existsIgnoringMissingKind(err); exists || err != nil {
+		return v1alpha1.StrategyHelmChart, err
+	}
+	cluster := newCloudNativePGCluster(ns)
+	err = kube.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)
+	if exists, err := existsIgnoringMissingKind(err); exists || err != nil {
+		return v1alpha1.StrategyCloudNativePG, err
+	}
+	// The HelmSDK stores releases in secrets with the name of the release, which is the name of the namespace.
+	secrets := &corev1.SecretList{}
+	err = kube.List(ctx, secrets, client.InNamespace(ns), client.MatchingLabels{"owner": "helm", "name": ns})
+	if err != nil {
+		return "", err
+	}
+	if len(secrets.Items) > 0 {
+		return v1alpha1.StrategyHelmSDK, nil
+	}
+	err = kube.Get(ctx, client.ObjectKey{Name: getDeploymentName(), Namespace: ns}, &appsv1.StatefulSet{})
+	if exists, err := existsIgnoringMissingKind(err); exists || err != nil {
+		return v1alpha1.StrategyStatefulSet, err
+	}
+	return "", nil
+}
+
+// discoverPVCName returns the name of the PVC that the StatefulSet in the given namespace mounts as data volume.
+// It returns an empty name, which stands for the PVC with the name of getPVCName, if the StatefulSet doesn't exist or if CloudNativePG manages the volumes.
+func discoverPVCName(ctx context.Context, ns string, strategy v1alpha1.DeploymentStrategy) (string, error) {
+	kube := GetClientFromContext(ctx)
+	if strategy == v1alpha1.StrategyCloudNativePG {
+		return "", nil
+	}
+	statefulSet := &appsv1.StatefulSet{}
+	err := kube.Get(ctx, client.ObjectKey{Name: getDeploymentName(), Namespace: ns}, statefulSet)
+	if err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	for _, volume := range statefulSet.Spec.Template.Spec.Volumes {
+		if volume.Name == "data" && volume.PersistentVolumeClaim != nil {
+			return volume.PersistentVolumeClaim.ClaimName, nil
+		}
+	}
+	return "", nil
+}
+
+// existsIgnoringMissingKind returns true if the given error of a Get is nil.
+// Errors because the object or its kind doesn't exist are ignored.
+func existsIgnoringMissingKind(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot discover deployment: %w", err)
+}
@@ -0,0 +1,89 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type DiscoverySuite struct {
+	operatortest.Suite
+}
+
+func TestDiscoverySuite(t *testing.T) {
+	suite.Run(t, new(DiscoverySuite))
+}
+
+func (ts *DiscoverySuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+}
+
+func (ts *DiscoverySuite) Test_DiscoverDeployment() {
+	// Arrange
+	selector := labels.Set{"app.kubernetes.io/instance": "lost-status", "app.kubernetes.io/instance-namespace": "my-app"}
+	ts.EnsureNS("my-app")
+	instance := newInstance("lost-status", "my-app")
+	instance.Status = v1alpha1.PostgresqlStandaloneStatus{}
+	ts.EnsureResources(instance)
+	for name, uid := range map[string]string{"sv-postgresql-s-other-uid": "other", "sv-postgresql-s-same-uid": string(instance.UID)} {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels.Merge(selector, labels.Set{"uid": uid})}}
+		ts.EnsureResources(ns)
+	}
+	podLabels := map[string]string{"app": "postgresql"}
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: "sv-postgresql-s-same-uid"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "postgresql", Image: "postgres"}},
+					Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "postgresql-data-fast"},
+					}}},
+				},
+			},
+		},
+	}
+	ts.EnsureResources(statefulSet)
+	SetInstanceInContext(ts.Context, instance)
+
+	// Act
+	err := DiscoverDeploymentFn(selector, "uid")(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	result := &v1alpha1.PostgresqlStandalone{}
+	ts.FetchResource(types.NamespacedName{Name: "lost-status", Namespace: "my-app"}, result)
+	ts.Assert().Equal("sv-postgresql-s-same-uid", result.Status.DeploymentNamespace, "namespace with same UID")
+	ts.Assert().Equal(v1alpha1.StrategyStatefulSet, result.Status.DeploymentStrategy)
+	ts.Assert().Equal("postgresql-data-fast", result.Status.PersistentVolumeClaimName)
+}
+
+func (ts *DiscoverySuite) Test_DiscoverDeployment_GivenNewInstance_ThenExpectNoDeployment() {
+	// Arrange
+	ts.EnsureNS("my-app")
+	instance := newInstance("new-instance", "my-app")
+	instance.Status = v1alpha1.PostgresqlStandaloneStatus{}
+	SetInstanceInContext(ts.Context, instance)
+
+	// Act
+	err := DiscoverDeploymentFn(labels.Set{"app.kubernetes.io/instance": "new-instance", "app.kubernetes.io/instance-namespace": "my-app"}, "uid")(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	ts.Assert().Empty(instance.Status.GetDeploymentNamespace())
+	ts.Assert().Empty(instance.Status.DeploymentStrategy)
+}
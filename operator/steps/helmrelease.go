@@ -3,22 +3,62 @@ package steps
 import (
 	"context"
 	"fmt"
+	"github.com/Masterminds/semver/v3"
 	pipeline "github.com/ccremer/go-command-pipeline"
 	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
 	crossplanev1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// HelmChartStrategy is the DeploymentStrategy that deploys PostgreSQL with a Helm chart through a provider-helm Release.
+type HelmChartStrategy struct{}
+
+// Ensure implements DeploymentStrategy.
+// See EnsureHelmReleaseFn.
+func (s *HelmChartStrategy) Ensure(ctx context.Context, labelSet labels.Set) error {
+	return EnsureHelmReleaseFn(labelSet)(ctx)
+}
+
+// Observe implements DeploymentStrategy.
+// See EnrichStatusWithHelmChartMetaFn.
+func (s *HelmChartStrategy) Observe(ctx context.Context) error {
+	return EnrichStatusWithHelmChartMetaFn()(ctx)
+}
+
+// IsReady implements DeploymentStrategy.
+// See IsHelmReleaseReadyP.
+func (s *HelmChartStrategy) IsReady(ctx context.Context) bool {
+	return IsHelmReleaseReadyP()(ctx)
+}
+
+// Delete implements DeploymentStrategy.
+// See DeleteHelmReleaseFn.
+func (s *HelmChartStrategy) Delete(ctx context.Context) error {
+	return DeleteHelmReleaseFn()(ctx)
+}
+
+// ServiceName implements DeploymentStrategy.
+// The service is created by the Helm chart.
+func (s *HelmChartStrategy) ServiceName() string {
+	return getDeploymentName()
+}
+
 // EnsureHelmReleaseFn creates or updates the Helm release object.
 // For first time installations, the Helm values are compiled based on the v1alpha1.PostgresqlStandaloneOperatorConfig HelmReleaseTemplate.
 // For updates, the existing Helm values are merged with values that are specific to the instance.
 // A release is considered "new" if the v1alpha1.PostgresqlStandalone's Status.HelmChart is nil.
+// Existing releases are upgraded to the chart version of the template if a rollout has selected the instance, see ReconcileRolloutFn.
+// Instances that are pinned to a chart version are changed to the pinned version instead, regardless of rollouts.
+// Drift of the existing Helm values is reported in the instance's conditions and handled according to the HelmValuesDriftPolicy.
+// Existing releases of hibernated instances aren't changed, see isReleaseUpdateSkipped.
 func EnsureHelmReleaseFn(labelSet labels.Set) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
@@ -28,38 +68,72 @@ func EnsureHelmReleaseFn(labelSet labels.Set) func(ctx context.Context) error {
 
 		helmRelease := &helmv1beta1.Release{ObjectMeta: metav1.ObjectMeta{Name: deploymentNamespace.Name}}
 		_, err := controllerutil.CreateOrUpdate(ctx, kube, helmRelease, func() error {
+			if helmRelease.ResourceVersion != "" && isReleaseUpdateSkipped(instance) {
+				return nil
+			}
 			chart := helmRelease.Spec.ForProvider.Chart
-			values := helmvalues.V{}
-			if helmRelease.ResourceVersion == "" {
-				// new instance.
+			if instance.Status.HelmChart == nil {
+				instance.Status.HelmChart = &v1alpha1.ChartMetaStatus{}
+			}
+			var values, appliedValues helmvalues.V
+			if helmRelease.ResourceVersion != "" {
+				instance.Status.HelmChart.SetHashSumOfExistingValues(helmvalues.MustHashSum(helmRelease.Spec.ForProvider.Values))
+			}
+			isUpgrade := helmRelease.ResourceVersion != "" && needsChartVersionChange(instance, config, chart)
+			if helmRelease.ResourceVersion == "" || isUpgrade {
+				// new instance, or changing the chart version due to a pin or a rollout.
 				compiledValues, chartSpec, err := compileHelmValues(config, instance)
 				if err != nil {
 					return err
 				}
 				values = compiledValues
+				appliedValues = compiledValues
 				chart.Repository = chartSpec.Repository
 				chart.Name = chartSpec.Name
 				chart.Version = chartSpec.Version
+				meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(conditions.NoDrift()).WithGeneration(instance).Build())
+				if isUpgrade {
+					// The rollout considers the instance upgraded once the release becomes ready again.
+					message := fmt.Sprintf("Deploying chart version %s", chart.Version)
+					meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(conditions.ResourceNotReady(conditions.TypeReleaseReady, message)).WithGeneration(instance).Build())
+				}
 			} else {
 				// existing release.
 				// Due to the delayable maintenance feature coming up, we can't compile the Helm values from template,
 				//  as that would potentially change values like image tags and thus do an unscheduled update of instance even in cases where the user just wanted more memory.
-				// But that means that we assume that no human is playing around with Helm values in the Release spec, since we rely on the existing Helm values to be valid.
 				// So we use the existing values and merge with the values directly set by the instance.
+				// Changes to the existing values that haven't been made by the operator are handled according to the drift policy of the config.
 				existingValues := helmvalues.V{}
 				ext := helmRelease.Spec.ForProvider.Values
-				instance.Status.HelmChart.SetHashSumOfExistingValues(helmvalues.MustHashSum(helmRelease.Spec.ForProvider.Values))
 				err := helmvalues.Unmarshal(ext, &existingValues)
 				if err != nil {
 					return err
 				}
-				values = applyValuesFromInstance(instance, existingValues)
+				lastAppliedValues, err := getLastAppliedValues(helmRelease)
+				if err != nil {
+					return err
+				}
+				configValues, err := getConfigValues(config, instance)
+				if err != nil {
+					return err
+				}
+				resolvedValues, resolvedAppliedValues, driftCondition, err := resolveValuesDrift(instance, configValues, config.Spec.HelmValuesDriftPolicy, getAppliedValuesHash(instance, helmRelease), lastAppliedValues, existingValues)
+				if err != nil {
+					return err
+				}
+				values = resolvedValues
+				appliedValues = resolvedAppliedValues
+				meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(driftCondition).WithGeneration(instance).Build())
+			}
+			if err := setLastAppliedValues(instance, helmRelease, appliedValues); err != nil {
+				return err
 			}
 			rawExt, err := helmvalues.Marshal(values)
 			if err != nil {
 				return err
 			}
 
+			propagateMetadata(ctx, helmRelease)
 			helmRelease.Labels = labels.Merge(helmRelease.Labels, labelSet)
 			helmRelease.Spec = helmv1beta1.ReleaseSpec{
 				ForProvider: helmv1beta1.ReleaseParameters{
@@ -81,6 +155,40 @@ func EnsureHelmReleaseFn(labelSet labels.Set) func(ctx context.Context) error {
 	}
 }
 
+// isReleaseUpdateSkipped returns true if an existing release of the instance must not be updated.
+// That's the case while the instance is hibernated, since the PostgreSQL chart always deploys the primary with one replica
+// and every new release would start PostgreSQL again, see EnsureHibernationFn.
+// The pending changes are released once the instance is resumed.
+func isReleaseUpdateSkipped(instance *v1alpha1.PostgresqlStandalone) bool {
+	return instance.Spec.Parameters.Hibernated
+}
+
+// needsChartVersionChange returns true if the given chart of an existing release has to be changed to the chart version returned by getChartVersion.
+// That's the case if the instance is pinned to another chart version, or if a rollout has selected the instance to be upgraded.
+func needsChartVersionChange(instance *v1alpha1.PostgresqlStandalone, config *v1alpha1.PostgresqlStandaloneOperatorConfig, chart helmv1beta1.ChartSpec) bool {
+	if pinned := instance.GetPinnedChartVersion(); pinned != "" {
+		return pinned != chart.Version
+	}
+	return isRolloutUpgrade(instance, config, chart)
+}
+
+// isRolloutUpgrade returns true if a rollout has selected the instance to be upgraded from the given chart to the chart version of the template.
+func isRolloutUpgrade(instance *v1alpha1.PostgresqlStandalone, config *v1alpha1.PostgresqlStandaloneOperatorConfig, chart helmv1beta1.ChartSpec) bool {
+	if config.Spec.HelmReleaseTemplate == nil {
+		return false
+	}
+	version := config.Spec.HelmReleaseTemplate.Chart.Version
+	return version != "" && version != chart.Version && instance.Annotations[RolloutChartVersionAnnotationKey] == version
+}
+
+// getChartVersion returns the chart version that the instance is pinned to, or the chart version of the template otherwise.
+func getChartVersion(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) string {
+	if pinned := instance.GetPinnedChartVersion(); pinned != "" {
+		return pinned
+	}
+	return config.Spec.HelmReleaseTemplate.Chart.Version
+}
+
 func compileHelmValues(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) (helmvalues.V, *v1alpha1.ChartMeta, error) {
 	helmVals := helmvalues.V{}
 
@@ -88,15 +196,39 @@ func compileHelmValues(config *v1alpha1.PostgresqlStandaloneOperatorConfig, inst
 	if err != nil {
 		return nil, nil, err
 	}
-	helmVals, helmChart, err := overrideTemplateValues(config, helmVals)
+	helmVals, helmChart, err := overrideTemplateValues(config, helmVals, getChartVersion(config, instance))
 	if err != nil {
 		return nil, nil, err
 	}
 
-	helmVals = applyValuesFromInstance(instance, helmVals)
+	configValues, err := getConfigValues(config, instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	helmVals = applyValuesFromInstance(instance, configValues, helmVals)
 	return helmVals, helmChart, nil
 }
 
+// configValues are the Helm values of an instance that depend on the v1alpha1.PostgresqlStandaloneOperatorConfig, see getConfigValues.
+type configValues struct {
+	// values are the values of the instance's plan, overridden by the compute resources of the instance.
+	values helmvalues.V
+	// derivedSettings are the PostgreSQL settings that are derived from the resources of the instance, see deriveSettings.
+	derivedSettings map[string]string
+}
+
+// getConfigValues returns the Helm values of the instance that depend on the v1alpha1.PostgresqlStandaloneOperatorConfig.
+func getConfigValues(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) (*configValues, error) {
+	values, err := getPlanValues(config, instance)
+	if err != nil {
+		return nil, err
+	}
+	if resources := getResourceValues(getComputeResources(config, instance)); len(resources) > 0 {
+		helmvalues.Merge(helmvalues.V{"primary": helmvalues.V{"resources": resources}}, &values)
+	}
+	return &configValues{values: values, derivedSettings: deriveSettings(config, instance)}, nil
+}
+
 func getCredentialSecretName() string {
 	return fmt.Sprintf("%s-credentials", getDeploymentName())
 }
@@ -107,37 +239,89 @@ func getPVCName() string {
 	return "postgresql-data"
 }
 
-// overrideTemplateValues searches for a specific HelmRelease spec that matches the Chart version from the template spec.
+// overrideTemplateValues searches for a specific HelmRelease spec that matches the given chart version, which is usually the Chart version from the template spec.
 // If it does, the template values are replaced or merged.
-func overrideTemplateValues(config *v1alpha1.PostgresqlStandaloneOperatorConfig, helmValues helmvalues.V) (helmvalues.V, *v1alpha1.ChartMeta, error) {
-	helmChart := &config.Spec.HelmReleaseTemplate.Chart
-
-	for _, release := range config.Spec.HelmReleases {
-		// TODO: maybe a better semver comparison later on?
-		if release.Chart.Version == config.Spec.HelmReleaseTemplate.Chart.Version {
-			overrides := helmvalues.V{}
-			err := helmvalues.Unmarshal(release.Values, &overrides)
-			if err != nil {
-				return helmValues, helmChart, err
-			}
-			if release.MergeValuesFromTemplate {
-				helmvalues.Merge(overrides, &helmValues)
-			} else {
-				helmValues = overrides
-			}
-			if release.Chart.Name != "" {
-				helmChart.Name = release.Chart.Name
-			}
-			if release.Chart.Repository != "" {
-				helmChart.Repository = release.Chart.Repository
-			}
-		}
+// See FindHelmReleaseConfig for how the HelmRelease spec is selected.
+func overrideTemplateValues(config *v1alpha1.PostgresqlStandaloneOperatorConfig, helmValues helmvalues.V, version string) (helmvalues.V, *v1alpha1.ChartMeta, error) {
+	chart := config.Spec.HelmReleaseTemplate.Chart
+	helmChart := &chart
+	helmChart.Version = version
+
+	release, _ := FindHelmReleaseConfig(config.Spec.HelmReleases, version)
+	if release == nil {
+		return helmValues, helmChart, nil
+	}
+	overrides := helmvalues.V{}
+	err := helmvalues.Unmarshal(release.Values, &overrides)
+	if err != nil {
+		return helmValues, helmChart, err
+	}
+	if release.MergeValuesFromTemplate {
+		helmvalues.Merge(overrides, &helmValues)
+	} else {
+		helmValues = overrides
+	}
+	if release.Chart.Name != "" {
+		helmChart.Name = release.Chart.Name
+	}
+	if release.Chart.Repository != "" {
+		helmChart.Repository = release.Chart.Repository
 	}
 	return helmValues, helmChart, nil
 }
 
+// FindHelmReleaseConfig returns the release config that matches the given chart version.
+// The chart version of a release config is either an exact version or a semver constraint.
+// A release config with the exact version takes precedence over release configs whose constraint is satisfied by the given version.
+// If multiple release configs match with the same precedence, the first one is returned and the others are returned as conflicting.
+// Release configs whose chart version is neither equal to the given version nor a valid constraint are ignored.
+// It returns nil if no release config matches.
+func FindHelmReleaseConfig(releases []v1alpha1.HelmReleaseConfig, version string) (*v1alpha1.HelmReleaseConfig, []v1alpha1.HelmReleaseConfig) {
+	exactMatches := make([]v1alpha1.HelmReleaseConfig, 0)
+	constraintMatches := make([]v1alpha1.HelmReleaseConfig, 0)
+	chartVersion, versionErr := semver.NewVersion(version)
+	for _, release := range releases {
+		if release.Chart.Version == "" {
+			continue
+		}
+		if release.Chart.Version == version {
+			exactMatches = append(exactMatches, release)
+			continue
+		}
+		if versionErr != nil {
+			continue
+		}
+		constraint, err := semver.NewConstraint(release.Chart.Version)
+		if err == nil && constraint.Check(chartVersion) {
+			constraintMatches = append(constraintMatches, release)
+		}
+	}
+	for _, matches := range [][]v1alpha1.HelmReleaseConfig{exactMatches, constraintMatches} {
+		if len(matches) > 0 {
+			return &matches[0], matches[1:]
+		}
+	}
+	return nil, nil
+}
+
 // applyValuesFromInstance merges the user-defined and -exposed Helm values into the current Helm values map.
-func applyValuesFromInstance(instance *v1alpha1.PostgresqlStandalone, values helmvalues.V) helmvalues.V {
+// The values that depend on the config (see getConfigValues) are merged first, so that they can't override the values derived from the instance only.
+// The PostgreSQL settings are rendered into `primary.extendedConfiguration`, see withManagedSettings.
+func applyValuesFromInstance(instance *v1alpha1.PostgresqlStandalone, config *configValues, values helmvalues.V) helmvalues.V {
+	var derivedSettings map[string]string
+	if config != nil {
+		helmvalues.Merge(deepCopyValues(config.values), &values)
+		derivedSettings = config.derivedSettings
+	}
+	podAnnotations := helmvalues.V{"postgresql.appcat.vshn.io/storage-capacity": instance.Spec.Parameters.Resources.StorageCapacity.String()}
+	for key, value := range getBackupAnnotations(bitnamiBackupCommand) {
+		podAnnotations[key] = value
+	}
+	// Only the migration jobs can connect to PostgreSQL while the storage is migrated.
+	clientNamespaceSelector := helmvalues.V{"kubernetes.io/metadata.name": instance.Namespace}
+	if isStorageMigrationInProgress(instance) {
+		clientNamespaceSelector = helmvalues.V{}
+	}
 	resources := helmvalues.V{
 		"auth": helmvalues.V{
 			"enablePostgresUser": true, // See https://github.com/vshn/appcat-service-postgresql/issues/83 why we always create a superuser
@@ -146,34 +330,31 @@ func applyValuesFromInstance(instance *v1alpha1.PostgresqlStandalone, values hel
 			"username":           instance.Name,
 		},
 		"primary": helmvalues.V{
-			"resources": helmvalues.V{
-				"limits": helmvalues.V{
-					"memory": instance.Spec.Parameters.Resources.MemoryLimit.String(),
-				},
-			},
 			"persistence": helmvalues.V{
-				"existingClaim": getPVCName(),
-			},
-			"podAnnotations": helmvalues.V{ // these annotations can stay, even if backups are disabled.
-				"k8up.io/backupcommand":                      `sh -c 'PGUSER="postgres" PGPASSWORD="$POSTGRES_POSTGRES_PASSWORD" pg_dumpall --clean'`,
-				"k8up.io/file-extension":                     ".sql",
-				"postgresql.appcat.vshn.io/storage-capacity": instance.Spec.Parameters.Resources.StorageCapacity.String(),
+				"existingClaim": getInstancePVCName(instance),
 			},
+			"podAnnotations": podAnnotations,
 		},
 		"fullnameOverride": getDeploymentName(),
 		"networkPolicy": helmvalues.V{
 			"enabled": true,
 			"ingressRules": helmvalues.V{
 				"primaryAccessOnlyFrom": helmvalues.V{
-					"enabled": true,
-					"namespaceSelector": helmvalues.V{
-						"kubernetes.io/metadata.name": instance.Namespace,
+					"enabled":           true,
+					"namespaceSelector": clientNamespaceSelector,
+					"podSelector": helmvalues.V{
+						StorageMigrationLabelKey: "true",
 					},
 				},
 			},
 		},
 	}
 	helmvalues.Merge(resources, &values)
+	primary, _ := values["primary"].(map[string]interface{})
+	configuration, _ := primary["extendedConfiguration"].(string)
+	if updated := withManagedSettings(configuration, derivedSettings, instance.Spec.Parameters.PostgresqlSettings); updated != configuration {
+		primary["extendedConfiguration"] = updated
+	}
 	return values
 }
 
@@ -206,16 +387,19 @@ func EnrichStatusWithHelmChartMetaFn() func(ctx context.Context) error {
 		if instance.Status.HelmChart == nil {
 			instance.Status.HelmChart = &v1alpha1.ChartMetaStatus{}
 		}
+		chartChanged := instance.Status.HelmChart.Version != helmChart.Version
 		instance.Status.HelmChart.ChartMeta = v1alpha1.ChartMeta{
 			Repository: helmChart.Repository,
 			Version:    helmChart.Version,
 			Name:       helmChart.Name,
 		}
 		instance.Status.HelmChart.DeploymentNamespace = helmRelease.Spec.ForProvider.Namespace
+		instance.Status.DeploymentNamespace = helmRelease.Spec.ForProvider.Namespace
+		instance.Status.HelmChart.PinnedVersion = instance.GetPinnedChartVersion()
 		instance.Status.DeploymentStrategy = v1alpha1.StrategyHelmChart
 		instance.Status.SetObservedGeneration(instance)
 		valuesHash := helmvalues.MustHashSum(helmRelease.Spec.ForProvider.Values)
-		if instance.Status.HelmChart.GetHashSumOfExistingValues() != valuesHash {
+		if chartChanged || instance.Status.HelmChart.GetHashSumOfExistingValues() != valuesHash {
 			instance.Status.HelmChart.ModifiedTime = metav1.Now()
 		}
 		err := kube.Status().Update(ctx, instance)
@@ -236,7 +420,7 @@ func DeleteHelmReleaseFn() func(ctx context.Context) error {
 		}
 		helmRelease := &helmv1beta1.Release{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: instance.Status.HelmChart.DeploymentNamespace,
+				Name: instance.Status.GetDeploymentNamespace(),
 			},
 		}
 		err := kube.Delete(ctx, helmRelease)
@@ -7,10 +7,12 @@ import (
 	pipeline "github.com/ccremer/go-command-pipeline"
 	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
 	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
 	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
@@ -37,13 +39,18 @@ func (ts *HelmReleaseSuite) Test_EnsureHelmRelease() {
 		prepare             func(releaseName string)
 		givenReleaseName    string
 		givenTemplateValues helmvalues.V
+		givenAppliedValues  helmvalues.V
+		givenDriftPolicy    v1alpha1.DriftPolicy
+		givenHashInRelease  bool
 		expectedExtraValues helmvalues.V // a basic set of values is merged
+		expectedDriftReason string
 	}{
 		"GivenNewHelmRelease_WhenCreating_ThenExpectValuesFromTemplate": {
 			givenReleaseName:    "create-release",
 			prepare:             func(releaseName string) {},
 			givenTemplateValues: helmvalues.V{"key": "value"},
 			expectedExtraValues: helmvalues.V{"key": "value"},
+			expectedDriftReason: conditions.ReasonNoDrift,
 		},
 		"GivenExistingHelmRelease_WhenUpdating_ThenExpectMergedValuesFromExisting": {
 			givenReleaseName:    "update-release",
@@ -58,6 +65,65 @@ func (ts *HelmReleaseSuite) Test_EnsureHelmRelease() {
 				ts.EnsureResources(release)
 			},
 			expectedExtraValues: helmvalues.V{"key": "existing"},
+			expectedDriftReason: conditions.ReasonNoDrift,
+		},
+		"GivenDriftedHelmRelease_WhenPolicyReport_ThenExpectMergedValuesFromExisting": {
+			givenReleaseName:    "report-drift-release",
+			givenTemplateValues: helmvalues.V{"key": "template"},
+			givenAppliedValues:  helmvalues.V{"key": "applied"},
+			givenDriftPolicy:    v1alpha1.DriftPolicyReport,
+			prepare: func(releaseName string) {
+				release := &helmv1beta1.Release{
+					ObjectMeta: metav1.ObjectMeta{Name: releaseName, Annotations: map[string]string{
+						LastAppliedValuesAnnotationKey: `{"key":"applied"}`,
+					}},
+					Spec: helmv1beta1.ReleaseSpec{
+						ForProvider: helmv1beta1.ReleaseParameters{
+							ValuesSpec: helmv1beta1.ValuesSpec{
+								Values: helmvalues.MustMarshal(helmvalues.V{"key": "existing"})}}}}
+				ts.EnsureResources(release)
+			},
+			expectedExtraValues: helmvalues.V{"key": "existing"},
+			expectedDriftReason: conditions.ReasonDriftDetected,
+		},
+		"GivenDriftedHelmRelease_WhenPolicyRevert_ThenExpectMergedValuesFromLastApplied": {
+			givenReleaseName:    "revert-drift-release",
+			givenTemplateValues: helmvalues.V{"key": "template"},
+			givenAppliedValues:  helmvalues.V{"key": "applied"},
+			givenDriftPolicy:    v1alpha1.DriftPolicyRevert,
+			prepare: func(releaseName string) {
+				release := &helmv1beta1.Release{
+					ObjectMeta: metav1.ObjectMeta{Name: releaseName, Annotations: map[string]string{
+						LastAppliedValuesAnnotationKey: `{"key":"applied"}`,
+					}},
+					Spec: helmv1beta1.ReleaseSpec{
+						ForProvider: helmv1beta1.ReleaseParameters{
+							ValuesSpec: helmv1beta1.ValuesSpec{
+								Values: helmvalues.MustMarshal(helmvalues.V{"key": "existing"})}}}}
+				ts.EnsureResources(release)
+			},
+			expectedExtraValues: helmvalues.V{"key": "applied"},
+			expectedDriftReason: conditions.ReasonDriftReverted,
+		},
+		"GivenDriftedHelmRelease_WhenHashOnlyInRelease_ThenExpectDriftReported": {
+			givenReleaseName:    "release-hash-drift-release",
+			givenTemplateValues: helmvalues.V{"key": "template"},
+			givenAppliedValues:  helmvalues.V{"key": "applied"},
+			givenDriftPolicy:    v1alpha1.DriftPolicyReport,
+			givenHashInRelease:  true,
+			prepare: func(releaseName string) {
+				release := &helmv1beta1.Release{
+					ObjectMeta: metav1.ObjectMeta{Name: releaseName, Annotations: map[string]string{
+						LastAppliedValuesAnnotationKey: `{"key":"applied"}`,
+					}},
+					Spec: helmv1beta1.ReleaseSpec{
+						ForProvider: helmv1beta1.ReleaseParameters{
+							ValuesSpec: helmv1beta1.ValuesSpec{
+								Values: helmvalues.MustMarshal(helmvalues.V{"key": "existing"})}}}}
+				ts.EnsureResources(release)
+			},
+			expectedExtraValues: helmvalues.V{"key": "existing"},
+			expectedDriftReason: conditions.ReasonDriftDetected,
 		},
 	}
 
@@ -70,11 +136,29 @@ func (ts *HelmReleaseSuite) Test_EnsureHelmRelease() {
 			config.Spec.HelmReleaseTemplate = &v1alpha1.HelmReleaseConfig{
 				Values: helmvalues.MustMarshal(tc.givenTemplateValues),
 			}
+			config.Spec.HelmValuesDriftPolicy = tc.givenDriftPolicy
+			appliedHash := ""
+			if tc.givenAppliedValues != nil {
+				instance.Status.HelmChart = &v1alpha1.ChartMetaStatus{}
+				configValues, err := getConfigValues(config, instance)
+				ts.Require().NoError(err)
+				appliedHash, err = helmvalues.CanonicalHashSum(applyValuesFromInstance(instance, configValues, tc.givenAppliedValues))
+				ts.Require().NoError(err)
+				if !tc.givenHashInRelease {
+					instance.Status.HelmChart.AppliedValuesHash = appliedHash
+				}
+			}
 
 			pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: deploymentNamespace}})
 			SetInstanceInContext(ts.Context, instance)
 			pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
 			tc.prepare(tc.givenReleaseName)
+			if tc.givenHashInRelease {
+				release := &helmv1beta1.Release{}
+				ts.FetchResource(types.NamespacedName{Name: tc.givenReleaseName}, release)
+				release.Annotations[AppliedValuesHashAnnotationKey] = appliedHash
+				ts.UpdateResources(release)
+			}
 
 			// Act
 			err := EnsureHelmReleaseFn(labels.Set{
@@ -92,10 +176,46 @@ func (ts *HelmReleaseSuite) Test_EnsureHelmRelease() {
 			ts.Assert().Equal(deploymentNamespace, result.Name, "metadata.name")
 			ts.Assert().Equal("label", result.Labels["test"])
 			ts.Assert().JSONEq(string(helmvalues.MustMarshal(tc.expectedExtraValues).Raw), string(result.Spec.ForProvider.Values.Raw))
+			ts.Assert().NotEmpty(result.Annotations[LastAppliedValuesAnnotationKey], "last applied values")
+			ts.Assert().Equal(instance.Status.HelmChart.AppliedValuesHash, result.Annotations[AppliedValuesHashAnnotationKey], "applied values hash in release")
+			ts.Assert().NotEmpty(instance.Status.HelmChart.AppliedValuesHash, "applied values hash")
+			driftCondition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeDrifted)
+			ts.Require().NotNil(driftCondition, "drift condition")
+			ts.Assert().Equal(tc.expectedDriftReason, driftCondition.Reason, "drift reason")
 		})
 	}
 }
 
+func (ts *HelmReleaseSuite) Test_EnsureHelmRelease_GivenHibernatedInstance_ThenExpectUnchangedRelease() {
+	// Arrange
+	deploymentNamespace := "hibernated-release"
+	instance := NewInstanceBuilder("instance", "my-app").getInstance()
+	instance.Spec.Parameters.Hibernated = true
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	config.Spec.HelmReleaseTemplate = &v1alpha1.HelmReleaseConfig{Values: helmvalues.MustMarshal(helmvalues.V{"key": "template"})}
+	release := &helmv1beta1.Release{
+		ObjectMeta: metav1.ObjectMeta{Name: deploymentNamespace},
+		Spec: helmv1beta1.ReleaseSpec{
+			ForProvider: helmv1beta1.ReleaseParameters{
+				ValuesSpec: helmv1beta1.ValuesSpec{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "existing"})}}}}
+	ts.EnsureResources(release)
+
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: deploymentNamespace}})
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+
+	// Act
+	err := EnsureHelmReleaseFn(labels.Set{"test": "label"})(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	result := &helmv1beta1.Release{}
+	ts.FetchResource(types.NamespacedName{Name: deploymentNamespace}, result)
+	ts.Assert().Equal(release.ResourceVersion, result.ResourceVersion, "release not updated")
+	ts.Assert().JSONEq(`{"key":"existing"}`, string(result.Spec.ForProvider.Values.Raw))
+}
+
 func (ts *HelmReleaseSuite) Test_EnrichStatus() {
 	// Arrange
 	instance := newInstance("enrich-status", "my-app")
@@ -124,6 +244,7 @@ func (ts *HelmReleaseSuite) Test_EnrichStatus() {
 	ts.Assert().Equal(chart.Repository, result.Status.HelmChart.Repository, "helm chart repo")
 	ts.Assert().Equal(chart.Version, result.Status.HelmChart.Version, "helm chart version")
 	ts.Assert().Equal(deploymentNamespace.Name, result.Status.HelmChart.DeploymentNamespace, "deployment namespace")
+	ts.Assert().Equal(deploymentNamespace.Name, result.Status.DeploymentNamespace, "deployment namespace")
 }
 
 func (ts *HelmReleaseSuite) Test_DeleteHelmRelease() {
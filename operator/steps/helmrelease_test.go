@@ -107,12 +107,124 @@ func TestOverrideTemplateValues(t *testing.T) {
 			},
 			expectedChart: v1alpha1.ChartMeta{Repository: "fork", Name: "alternative", Version: "version"},
 		},
+		"GivenNoReleaseMatches_ThenExpectTemplateValues": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "value"}),
+					Chart:  v1alpha1.ChartMeta{Version: "11.1.2", Name: "postgres", Repository: "url"},
+				},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{
+						Chart:  v1alpha1.ChartMeta{Version: ">=12"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "constraint"}),
+					},
+					{
+						Chart:  v1alpha1.ChartMeta{Version: "11.1.1"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "exact"}),
+					},
+				},
+			},
+			expectedValues: helmvalues.V{"key": "value"},
+			expectedChart:  v1alpha1.ChartMeta{Repository: "url", Name: "postgres", Version: "11.1.2"},
+		},
+		"GivenReleaseWithConstraint_WhenVersionSatisfiesConstraint_ThenOverwriteExistingValues": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "value"}),
+					Chart:  v1alpha1.ChartMeta{Version: "11.1.2", Name: "postgres", Repository: "url"},
+				},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{
+						Chart:  v1alpha1.ChartMeta{Version: ">=11.1 <12", Name: "alternative"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "constraint"}),
+					},
+				},
+			},
+			expectedValues: helmvalues.V{"key": "constraint"},
+			expectedChart:  v1alpha1.ChartMeta{Repository: "url", Name: "alternative", Version: "11.1.2"},
+		},
+		"GivenReleaseWithConstraint_WhenVersionIsNotSemver_ThenExpectTemplateValues": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "value"}),
+					Chart:  v1alpha1.ChartMeta{Version: "version", Name: "postgres", Repository: "url"},
+				},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{
+						Chart:  v1alpha1.ChartMeta{Version: ">=11.1 <12"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "constraint"}),
+					},
+				},
+			},
+			expectedValues: helmvalues.V{"key": "value"},
+			expectedChart:  v1alpha1.ChartMeta{Repository: "url", Name: "postgres", Version: "version"},
+		},
+		"GivenReleaseWithInvalidConstraint_ThenIgnoreRelease": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "value"}),
+					Chart:  v1alpha1.ChartMeta{Version: "11.1.2", Name: "postgres", Repository: "url"},
+				},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{
+						Chart:  v1alpha1.ChartMeta{Version: "not a constraint"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "invalid"}),
+					},
+				},
+			},
+			expectedValues: helmvalues.V{"key": "value"},
+			expectedChart:  v1alpha1.ChartMeta{Repository: "url", Name: "postgres", Version: "11.1.2"},
+		},
+		"GivenReleasesWithExactVersionAndConstraint_ThenPreferExactVersion": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "value"}),
+					Chart:  v1alpha1.ChartMeta{Version: "11.1.2", Name: "postgres", Repository: "url"},
+				},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{
+						Chart:  v1alpha1.ChartMeta{Version: "~11.1"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "constraint"}),
+					},
+					{
+						Chart:  v1alpha1.ChartMeta{Version: "11.1.2"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "exact"}),
+					},
+				},
+			},
+			expectedValues: helmvalues.V{"key": "exact"},
+			expectedChart:  v1alpha1.ChartMeta{Repository: "url", Name: "postgres", Version: "11.1.2"},
+		},
+		"GivenMultipleReleasesWithConstraint_ThenPreferFirstRelease": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+					Values: helmvalues.MustMarshal(helmvalues.V{"key": "value"}),
+					Chart:  v1alpha1.ChartMeta{Version: "11.1.2", Name: "postgres", Repository: "url"},
+				},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{
+						Chart:  v1alpha1.ChartMeta{Version: "<11"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "older"}),
+					},
+					{
+						Chart:  v1alpha1.ChartMeta{Version: "^11"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "first"}),
+					},
+					{
+						Chart:  v1alpha1.ChartMeta{Version: ">=11.1 <12"},
+						Values: helmvalues.MustMarshal(helmvalues.V{"key": "second"}),
+					},
+				},
+			},
+			expectedValues: helmvalues.V{"key": "first"},
+			expectedChart:  v1alpha1.ChartMeta{Repository: "url", Name: "postgres", Version: "11.1.2"},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			vals := helmvalues.V{}
 			helmvalues.MustUnmarshal(tc.givenSpec.HelmReleaseTemplate.Values, &vals)
-			resultValues, resultChart, err := overrideTemplateValues(&v1alpha1.PostgresqlStandaloneOperatorConfig{Spec: tc.givenSpec}, vals)
+			resultValues, resultChart, err := overrideTemplateValues(&v1alpha1.PostgresqlStandaloneOperatorConfig{Spec: tc.givenSpec}, vals, tc.givenSpec.HelmReleaseTemplate.Chart.Version)
 			if tc.expectedError != "" {
 				require.EqualError(t, err, tc.expectedError)
 				return
@@ -135,6 +247,14 @@ var testValues = helmvalues.V{
 		"persistence": helmvalues.V{
 			"existingClaim": "postgresql-data",
 		},
+		"extendedConfiguration": `# BEGIN settings derived by postgresql.appcat.vshn.io
+effective_cache_size = '1572864kB'
+maintenance_work_mem = '104857kB'
+max_connections = '200'
+shared_buffers = '524288kB'
+work_mem = '1966kB'
+# END settings derived by postgresql.appcat.vshn.io
+`,
 		"resources": helmvalues.V{
 			"limits": helmvalues.V{
 				"memory": "2Gi",
@@ -155,6 +275,9 @@ var testValues = helmvalues.V{
 				"namespaceSelector": helmvalues.V{
 					"kubernetes.io/metadata.name": "my-app",
 				},
+				"podSelector": helmvalues.V{
+					"postgresql.appcat.vshn.io/storage-migration": "true",
+				},
 			},
 		},
 	},
@@ -162,10 +285,21 @@ var testValues = helmvalues.V{
 
 func TestApplyValuesFromInstance(t *testing.T) {
 	instance := newInstance("instance", "my-app")
-	result := applyValuesFromInstance(instance, helmvalues.V{})
+	configValues, err := getConfigValues(&v1alpha1.PostgresqlStandaloneOperatorConfig{}, instance)
+	require.NoError(t, err)
+	result := applyValuesFromInstance(instance, configValues, helmvalues.V{})
 	assert.Equal(t, testValues, result)
 }
 
+func TestApplyValuesFromInstance_GivenStorageMigration_ThenExpectOnlyMigrationJobsAllowed(t *testing.T) {
+	instance := newInstance("instance", "my-app")
+	instance.Status.StorageMigration = &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseBackingUp}
+	result := applyValuesFromInstance(instance, nil, helmvalues.V{})
+	rule := result["networkPolicy"].(helmvalues.V)["ingressRules"].(helmvalues.V)["primaryAccessOnlyFrom"].(helmvalues.V)
+	assert.Equal(t, helmvalues.V{}, rule["namespaceSelector"])
+	assert.Equal(t, helmvalues.V{StorageMigrationLabelKey: "true"}, rule["podSelector"])
+}
+
 func TestIsHelmReleaseReady(t *testing.T) {
 	// Arrange
 	ctx := pipeline.MutableContext(context.Background())
@@ -234,3 +368,86 @@ func parseResource(value string) *resource.Quantity {
 	parsed := resource.MustParse(value)
 	return &parsed
 }
+
+func TestNeedsChartVersionChange(t *testing.T) {
+	tests := map[string]struct {
+		givenPin        string
+		givenRollout    string
+		givenVersion    string
+		expectedResult  bool
+		expectedVersion string
+	}{
+		"GivenNoPinAndNoRollout_ThenExpectNoChange": {
+			givenVersion:    "1.0.0",
+			expectedVersion: "2.0.0",
+		},
+		"GivenPin_WhenVersionDiffers_ThenExpectChangeToPinnedVersion": {
+			givenPin:        "1.5.0",
+			givenVersion:    "1.0.0",
+			expectedResult:  true,
+			expectedVersion: "1.5.0",
+		},
+		"GivenPin_WhenVersionMatches_ThenExpectNoChange": {
+			givenPin:        "1.0.0",
+			givenVersion:    "1.0.0",
+			expectedVersion: "1.0.0",
+		},
+		"GivenPinAndRollout_ThenExpectPinTakesPrecedence": {
+			givenPin:        "1.0.0",
+			givenRollout:    "2.0.0",
+			givenVersion:    "1.0.0",
+			expectedVersion: "1.0.0",
+		},
+		"GivenRollout_ThenExpectChangeToTemplateVersion": {
+			givenRollout:    "2.0.0",
+			givenVersion:    "1.0.0",
+			expectedResult:  true,
+			expectedVersion: "2.0.0",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Annotations = map[string]string{}
+			if tc.givenPin != "" {
+				instance.Annotations[v1alpha1.PinnedChartVersionAnnotationKey] = tc.givenPin
+			}
+			if tc.givenRollout != "" {
+				instance.Annotations[RolloutChartVersionAnnotationKey] = tc.givenRollout
+			}
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{Chart: v1alpha1.ChartMeta{Version: "2.0.0"}},
+			}}
+			result := needsChartVersionChange(instance, config, helmv1beta1.ChartSpec{Version: tc.givenVersion})
+			assert.Equal(t, tc.expectedResult, result)
+			assert.Equal(t, tc.expectedVersion, getChartVersion(config, instance))
+		})
+	}
+}
+
+func TestCompileHelmValues_GivenPinnedInstance_ThenExpectValuesOfPinnedVersion(t *testing.T) {
+	// Arrange
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+		HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{
+			Values: runtime.RawExtension{Raw: []byte(`{"key":"value"}`)},
+			Chart:  v1alpha1.ChartMeta{Repository: "https://host/path", Name: "postgresql", Version: "2.0.0"},
+		},
+		HelmReleases: []v1alpha1.HelmReleaseConfig{
+			{
+				Chart:  v1alpha1.ChartMeta{Version: "1.0.0"},
+				Values: runtime.RawExtension{Raw: []byte(`{"key":"pinned"}`)},
+			},
+		},
+	}}
+	instance := newInstance("instance", "my-app")
+	instance.Annotations = map[string]string{v1alpha1.PinnedChartVersionAnnotationKey: "1.0.0"}
+
+	// Act
+	values, chart, err := compileHelmValues(config, instance)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, &v1alpha1.ChartMeta{Repository: "https://host/path", Name: "postgresql", Version: "1.0.0"}, chart)
+	assert.Equal(t, "pinned", values["key"])
+	assert.Equal(t, "2.0.0", config.Spec.HelmReleaseTemplate.Chart.Version, "template must not be changed")
+}
@@ -0,0 +1,361 @@
+package steps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// helmSDKMaxHistory is the number of release revisions that are kept in the deployment namespace.
+const helmSDKMaxHistory = 10
+
+// HelmSDKStrategy is the DeploymentStrategy that installs and upgrades the Helm chart with the Helm SDK within the operator.
+// The chart is configured the same way as for the HelmChartStrategy, but the ChartMeta's repository is one of:
+//   - an OCI registry, for example `oci://registry.example.com/charts`
+//   - an HTTP chart repository, for example `https://charts.bitnami.com/bitnami`
+//   - a local chart directory, for example `file:///charts` or `/charts`
+//
+// The release is stored by Helm in the deployment namespace, its status and revision are stored in the status of the instance.
+// Readiness is determined from the resources of the release manifest, so there is no need to compare timestamps with another controller.
+type HelmSDKStrategy struct {
+	// RESTConfig is the config that Helm uses to connect to the cluster.
+	RESTConfig *rest.Config
+	// CacheDir is the directory where downloaded charts and repository indexes are cached.
+	CacheDir string
+}
+
+// helmSDKRelease is the release of a HelmSDKStrategy in the context.
+type helmSDKRelease struct {
+	release *release.Release
+	chart   v1alpha1.ChartMeta
+}
+
+// Ensure implements DeploymentStrategy.
+// New releases are installed with the Helm values compiled from the v1alpha1.PostgresqlStandaloneOperatorConfig.
+// Existing releases keep their values, merged with the values from the instance.
+// They are only upgraded if the values change, or if the instance is pinned or rolled out to another chart version.
+// Existing releases of hibernated instances aren't upgraded, see isReleaseUpdateSkipped.
+// Releases that are stuck after a failed or interrupted operation are recovered first, see recoverHelmSDKRelease.
+func (s *HelmSDKStrategy) Ensure(ctx context.Context, labelSet labels.Set) error {
+	instance := GetInstanceFromContext(ctx)
+	config := GetConfigFromContext(ctx)
+	deploymentNamespace := getFromContextOrPanic(ctx, DeploymentNamespaceKey{}).(*corev1.Namespace)
+
+	releaseName := deploymentNamespace.Name
+	actionConfig, err := s.newActionConfiguration(releaseName)
+	if err != nil {
+		return err
+	}
+	rel, err := actionConfig.Releases.Last(releaseName)
+	if err == nil && !isReleaseUpdateSkipped(instance) {
+		rel, err = recoverHelmSDKRelease(actionConfig, rel)
+	}
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		values, chartMeta, err := compileHelmValues(config, instance)
+		if err != nil {
+			return err
+		}
+		install := action.NewInstall(actionConfig)
+		install.ReleaseName = releaseName
+		install.Namespace = releaseName
+		install.SkipCRDs = true
+		chrt, err := s.loadChart(&install.ChartPathOptions, *chartMeta)
+		if err != nil {
+			return err
+		}
+		rel, err = install.RunWithContext(ctx, chrt, withCommonLabels(values, labelSet))
+		pipeline.StoreInContext(ctx, HelmSDKReleaseKey{}, &helmSDKRelease{release: rel, chart: *chartMeta})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	deployedChart := v1alpha1.ChartMeta{Name: rel.Chart.Metadata.Name, Version: rel.Chart.Metadata.Version}
+	if instance.Status.HelmChart != nil {
+		deployedChart.Repository = instance.Status.HelmChart.Repository
+	}
+	if isReleaseUpdateSkipped(instance) {
+		pipeline.StoreInContext(ctx, HelmSDKReleaseKey{}, &helmSDKRelease{release: rel, chart: deployedChart})
+		return nil
+	}
+	upgrade := action.NewUpgrade(actionConfig)
+	upgrade.Namespace = releaseName
+	upgrade.SkipCRDs = true
+	upgrade.MaxHistory = helmSDKMaxHistory
+
+	if needsChartVersionChange(instance, config, helmv1beta1.ChartSpec{Version: deployedChart.Version}) {
+		values, chartMeta, err := compileHelmValues(config, instance)
+		if err != nil {
+			return err
+		}
+		chrt, err := s.loadChart(&upgrade.ChartPathOptions, *chartMeta)
+		if err != nil {
+			return err
+		}
+		// The rollout considers the instance upgraded once the release becomes ready again.
+		message := fmt.Sprintf("Deploying chart version %s", chartMeta.Version)
+		meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(conditions.ResourceNotReady(conditions.TypeReleaseReady, message)).WithGeneration(instance).Build())
+		rel, err = upgrade.RunWithContext(ctx, releaseName, chrt, withCommonLabels(values, labelSet))
+		pipeline.StoreInContext(ctx, HelmSDKReleaseKey{}, &helmSDKRelease{release: rel, chart: *chartMeta})
+		return err
+	}
+
+	existingValues, err := copyHelmValues(rel.Config)
+	if err != nil {
+		return err
+	}
+	configValues, err := getConfigValues(config, instance)
+	if err != nil {
+		return err
+	}
+	values := withCommonLabels(applyValuesFromInstance(instance, configValues, existingValues), labelSet)
+	changed, err := helmValuesChanged(rel.Config, values)
+	if err != nil {
+		return err
+	}
+	if changed || rel.Info.Status != release.StatusDeployed {
+		rel, err = upgrade.RunWithContext(ctx, releaseName, rel.Chart, values)
+	}
+	pipeline.StoreInContext(ctx, HelmSDKReleaseKey{}, &helmSDKRelease{release: rel, chart: deployedChart})
+	return err
+}
+
+// Observe implements DeploymentStrategy.
+// It updates the chart, the revision and the status of the release in the status of the instance.
+// The modification time is updated if the chart version or the revision has changed.
+func (s *HelmSDKStrategy) Observe(ctx context.Context) error {
+	instance := GetInstanceFromContext(ctx)
+	rel := getFromContextOrPanic(ctx, HelmSDKReleaseKey{}).(*helmSDKRelease)
+
+	if instance.Status.HelmChart == nil {
+		instance.Status.HelmChart = &v1alpha1.ChartMetaStatus{}
+	}
+	status := instance.Status.HelmChart
+	changed := status.Version != rel.chart.Version || status.Revision != rel.release.Version
+	status.ChartMeta = rel.chart
+	status.Revision = rel.release.Version
+	status.ReleaseStatus = rel.release.Info.Status.String()
+	status.DeploymentNamespace = rel.release.Namespace
+	status.PinnedVersion = instance.GetPinnedChartVersion()
+	if changed {
+		status.ModifiedTime = metav1.Now()
+	}
+	return updateDeploymentStatus(ctx, v1alpha1.StrategyHelmSDK, rel.release.Namespace)
+}
+
+// IsReady implements DeploymentStrategy.
+// The release is ready if it has been deployed and all of its resources are ready.
+func (s *HelmSDKStrategy) IsReady(ctx context.Context) bool {
+	rel := getFromContextOrPanic(ctx, HelmSDKReleaseKey{}).(*helmSDKRelease)
+	if rel.release.Info.Status != release.StatusDeployed {
+		return false
+	}
+	ready, err := s.isReleaseReady(ctx, rel.release)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Cannot determine whether Helm release is ready", "release", rel.release.Name)
+	}
+	return ready
+}
+
+// Delete implements DeploymentStrategy.
+// Ignores "not found" error and returns nil if deployment namespace is unknown.
+func (s *HelmSDKStrategy) Delete(ctx context.Context) error {
+	instance := GetInstanceFromContext(ctx)
+
+	releaseName := instance.Status.GetDeploymentNamespace()
+	if releaseName == "" {
+		// Release might not ever have existed, skip
+		return nil
+	}
+	actionConfig, err := s.newActionConfiguration(releaseName)
+	if err != nil {
+		return err
+	}
+	_, err = action.NewUninstall(actionConfig).Run(releaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ServiceName implements DeploymentStrategy.
+// The service is created by the Helm chart.
+func (s *HelmSDKStrategy) ServiceName() string {
+	return getDeploymentName()
+}
+
+// recoverHelmSDKRelease resolves a release that Helm refuses to upgrade after a failed or interrupted operation.
+// A release that has never been deployed, i.e. a pending or failed first install, is uninstalled, so that it's installed again.
+// In that case, driver.ErrReleaseNotFound is returned.
+// A pending upgrade or rollback, e.g. because the operator has been restarted during the operation, is rolled back to the previous revision.
+// Other releases are returned unchanged.
+func recoverHelmSDKRelease(actionConfig *action.Configuration, rel *release.Release) (*release.Release, error) {
+	switch {
+	case rel.Info.Status == release.StatusPendingInstall, rel.Info.Status == release.StatusFailed && rel.Version == 1:
+		if _, err := action.NewUninstall(actionConfig).Run(rel.Name); err != nil {
+			return nil, fmt.Errorf("cannot uninstall release %s that failed to install: %w", rel.Name, err)
+		}
+		return nil, driver.ErrReleaseNotFound
+	case rel.Info.Status.IsPending():
+		rollback := action.NewRollback(actionConfig)
+		rollback.MaxHistory = helmSDKMaxHistory
+		if err := rollback.Run(rel.Name); err != nil {
+			return nil, fmt.Errorf("cannot roll back release %s that is stuck in status %s: %w", rel.Name, rel.Info.Status, err)
+		}
+		return actionConfig.Releases.Last(rel.Name)
+	}
+	return rel, nil
+}
+
+func (s *HelmSDKStrategy) isReleaseReady(ctx context.Context, rel *release.Release) (bool, error) {
+	kubeClient := kube.New(&restClientGetter{config: s.RESTConfig, namespace: rel.Namespace})
+	resources, err := kubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil {
+		return false, err
+	}
+	clientset, err := kubernetes.NewForConfig(s.RESTConfig)
+	if err != nil {
+		return false, err
+	}
+	checker := kube.NewReadyChecker(clientset, func(string, ...interface{}) {}, kube.PausedAsReady(true))
+	for _, resource := range resources {
+		if ready, err := checker.IsReady(ctx, resource); err != nil || !ready {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *HelmSDKStrategy) newActionConfiguration(namespace string) (*action.Configuration, error) {
+	actionConfig := &action.Configuration{}
+	err := actionConfig.Init(&restClientGetter{config: s.RESTConfig, namespace: namespace}, namespace, "secret", func(string, ...interface{}) {})
+	if err != nil {
+		return nil, err
+	}
+	registryClient, err := registry.NewClient(registry.ClientOptCredentialsFile(filepath.Join(s.CacheDir, "registry.json")))
+	if err != nil {
+		return nil, err
+	}
+	actionConfig.RegistryClient = registryClient
+	return actionConfig, nil
+}
+
+// loadChart downloads the given chart to the cache directory, if necessary, and loads it.
+func (s *HelmSDKStrategy) loadChart(options *action.ChartPathOptions, chartMeta v1alpha1.ChartMeta) (*chart.Chart, error) {
+	settings := cli.New()
+	settings.RepositoryCache = filepath.Join(s.CacheDir, "repository")
+	settings.RepositoryConfig = filepath.Join(s.CacheDir, "repositories.yaml")
+	settings.RegistryConfig = filepath.Join(s.CacheDir, "registry.json")
+
+	name, repoURL := getHelmSDKChartReference(chartMeta)
+	options.RepoURL = repoURL
+	options.Version = chartMeta.Version
+	path, err := options.LocateChart(name, settings)
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate chart %s in version %s: %w", chartMeta.Name, chartMeta.Version, err)
+	}
+	return loader.Load(path)
+}
+
+// getHelmSDKChartReference returns the chart name and repository URL in the format that action.ChartPathOptions expects for the given chart.
+func getHelmSDKChartReference(chartMeta v1alpha1.ChartMeta) (name string, repoURL string) {
+	repository := chartMeta.Repository
+	switch {
+	case registry.IsOCI(repository):
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(repository, "/"), chartMeta.Name), ""
+	case strings.HasPrefix(repository, "http://"), strings.HasPrefix(repository, "https://"):
+		return chartMeta.Name, repository
+	}
+	return filepath.Join(strings.TrimPrefix(repository, "file://"), chartMeta.Name), ""
+}
+
+// withCommonLabels sets the given labels as `commonLabels` of the chart, so that the deployed resources can be mapped to the instance.
+func withCommonLabels(values helmvalues.V, labelSet labels.Set) helmvalues.V {
+	commonLabels := helmvalues.V{}
+	for key, value := range labelSet {
+		commonLabels[key] = value
+	}
+	helmvalues.Merge(helmvalues.V{"commonLabels": commonLabels}, &values)
+	return values
+}
+
+func helmValuesChanged(existing, values helmvalues.V) (bool, error) {
+	existingHash, err := helmvalues.CanonicalHashSum(existing)
+	if err != nil {
+		return false, err
+	}
+	hash, err := helmvalues.CanonicalHashSum(values)
+	return existingHash != hash, err
+}
+
+// copyHelmValues returns a deep copy of the given values, so that the config of a release isn't modified.
+func copyHelmValues(values helmvalues.V) (helmvalues.V, error) {
+	copied := helmvalues.V{}
+	rawExt, err := helmvalues.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	err = helmvalues.Unmarshal(rawExt, &copied)
+	return copied, err
+}
+
+// restClientGetter implements genericclioptions.RESTClientGetter for Helm with the REST config of the operator.
+type restClientGetter struct {
+	config    *rest.Config
+	namespace string
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(g.config), nil
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(g.config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(discoveryClient), nil
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	discoveryClient, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient)
+	return restmapper.NewShortcutExpander(mapper, discoveryClient), nil
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(clientcmdapi.Config{}, &clientcmd.ConfigOverrides{Context: clientcmdapi.Context{Namespace: g.namespace}})
+}
@@ -0,0 +1,136 @@
+package steps
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestGetHelmSDKChartReference(t *testing.T) {
+	tests := map[string]struct {
+		givenRepository string
+		expectedName    string
+		expectedRepoURL string
+	}{
+		"GivenOCIRegistry_ThenExpectFullReferenceAsName": {
+			givenRepository: "oci://registry.example.com/charts/",
+			expectedName:    "oci://registry.example.com/charts/postgresql",
+		},
+		"GivenHTTPRepository_ThenExpectRepoURL": {
+			givenRepository: "https://charts.bitnami.com/bitnami",
+			expectedName:    "postgresql",
+			expectedRepoURL: "https://charts.bitnami.com/bitnami",
+		},
+		"GivenFileURL_ThenExpectLocalPath": {
+			givenRepository: "file:///charts",
+			expectedName:    "/charts/postgresql",
+		},
+		"GivenLocalDirectory_ThenExpectLocalPath": {
+			givenRepository: "/charts",
+			expectedName:    "/charts/postgresql",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			name, repoURL := getHelmSDKChartReference(v1alpha1.ChartMeta{Repository: tc.givenRepository, Name: "postgresql", Version: "1.0.0"})
+			assert.Equal(t, tc.expectedName, name)
+			assert.Equal(t, tc.expectedRepoURL, repoURL)
+		})
+	}
+}
+
+func TestHelmValuesChanged(t *testing.T) {
+	existing := helmvalues.V{"auth": helmvalues.V{"database": "instance"}}
+	copied, err := copyHelmValues(existing)
+	require.NoError(t, err)
+
+	changed, err := helmValuesChanged(existing, copied)
+	require.NoError(t, err)
+	assert.False(t, changed, "copied values")
+
+	values := withCommonLabels(copied, labels.Set{"app.kubernetes.io/instance": "instance"})
+	changed, err = helmValuesChanged(existing, values)
+	require.NoError(t, err)
+	assert.True(t, changed, "values with common labels")
+	assert.NotContains(t, existing, "commonLabels", "existing values must not be modified")
+	assert.Equal(t, helmvalues.V{"app.kubernetes.io/instance": "instance"}, values["commonLabels"])
+}
+
+func TestRecoverHelmSDKRelease(t *testing.T) {
+	tests := map[string]struct {
+		givenStatuses    []release.Status
+		expectedNotFound bool
+		expectedStatus   release.Status
+		expectedRevision int
+	}{
+		"GivenDeployedRelease_ThenExpectUnchanged": {
+			givenStatuses:    []release.Status{release.StatusDeployed},
+			expectedStatus:   release.StatusDeployed,
+			expectedRevision: 1,
+		},
+		"GivenFailedUpgrade_ThenExpectUnchanged": {
+			givenStatuses:    []release.Status{release.StatusDeployed, release.StatusFailed},
+			expectedStatus:   release.StatusFailed,
+			expectedRevision: 2,
+		},
+		"GivenFailedInstall_ThenExpectUninstalled": {
+			givenStatuses:    []release.Status{release.StatusFailed},
+			expectedNotFound: true,
+		},
+		"GivenPendingInstall_ThenExpectUninstalled": {
+			givenStatuses:    []release.Status{release.StatusPendingInstall},
+			expectedNotFound: true,
+		},
+		"GivenPendingUpgrade_ThenExpectRolledBack": {
+			givenStatuses:    []release.Status{release.StatusDeployed, release.StatusPendingUpgrade},
+			expectedStatus:   release.StatusDeployed,
+			expectedRevision: 3,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			actionConfig := &action.Configuration{
+				Releases:     storage.Init(driver.NewMemory()),
+				KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          func(string, ...interface{}) {},
+			}
+			var last *release.Release
+			for i, status := range tc.givenStatuses {
+				last = &release.Release{
+					Name: "sv-postgresql-s-merry-vigilante-7b16", Namespace: "sv-postgresql-s-merry-vigilante-7b16", Version: i + 1,
+					Info:  &release.Info{Status: status},
+					Chart: &chart.Chart{Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "postgresql", Version: "1.0.0"}},
+				}
+				require.NoError(t, actionConfig.Releases.Create(last))
+			}
+
+			// Act
+			rel, err := recoverHelmSDKRelease(actionConfig, last)
+
+			// Assert
+			if tc.expectedNotFound {
+				assert.ErrorIs(t, err, driver.ErrReleaseNotFound)
+				_, err = actionConfig.Releases.Last(last.Name)
+				assert.ErrorIs(t, err, driver.ErrReleaseNotFound, "release in storage")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, rel.Info.Status, "status")
+			assert.Equal(t, tc.expectedRevision, rel.Version, "revision")
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package steps
+
+import (
+	"fmt"
+	"strings"
+
+	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// LastAppliedValuesAnnotationKey is the annotation key of the Helm release that contains the Helm values that the operator applied last.
+var LastAppliedValuesAnnotationKey = fmt.Sprintf("%s/last-applied-values", v1alpha1.Group)
+
+// AppliedValuesHashAnnotationKey is the annotation key of the Helm release that contains the canonical hash sum of the Helm values that the operator applied last.
+// It's stored on the release, so that it's always in sync with the values of the release, even if the status of the instance can't be updated.
+var AppliedValuesHashAnnotationKey = fmt.Sprintf("%s/applied-values-hash", v1alpha1.Group)
+
+// maxDriftedPathsInMessage limits the amount of drifted values that are listed in a condition message.
+const maxDriftedPathsInMessage = 10
+
+// getLastAppliedValues returns the Helm values that the operator applied last to the given release.
+// If the release doesn't have them, e.g. because it has been deployed by an older version of the operator, the existing values are returned.
+func getLastAppliedValues(release *helmv1beta1.Release) (helmvalues.V, error) {
+	lastApplied := helmvalues.V{}
+	raw, exists := release.Annotations[LastAppliedValuesAnnotationKey]
+	if !exists {
+		raw = string(release.Spec.ForProvider.Values.Raw)
+	}
+	err := helmvalues.Unmarshal(runtime.RawExtension{Raw: []byte(raw)}, &lastApplied)
+	return lastApplied, err
+}
+
+// getAppliedValuesHash returns the hash sum of the Helm values that the operator applied last to the given release.
+// If the release doesn't have it, e.g. because it has been deployed by an older version of the operator, the hash sum in the status of the instance is returned.
+func getAppliedValuesHash(instance *v1alpha1.PostgresqlStandalone, release *helmv1beta1.Release) string {
+	if hash, exists := release.Annotations[AppliedValuesHashAnnotationKey]; exists {
+		return hash
+	}
+	return instance.Status.HelmChart.AppliedValuesHash
+}
+
+// resolveValuesDrift returns the Helm values of an existing release according to the given v1alpha1.DriftPolicy.
+// The existing values are considered drifted if their hash doesn't match the given hash of the values that the operator applied last.
+// Drifted values are replaced by the last applied values with v1alpha1.DriftPolicyRevert, otherwise they are kept.
+// In any case, the values from the instance and its config are merged into the returned values.
+// Next to the values for the release, it returns the values that the operator should consider as applied and a condition that describes the drift.
+func resolveValuesDrift(instance *v1alpha1.PostgresqlStandalone, config *configValues, policy v1alpha1.DriftPolicy, appliedHash string, lastApplied, existing helmvalues.V) (values, applied helmvalues.V, condition metav1.Condition, err error) {
+	existingHash, err := helmvalues.CanonicalHashSum(existing)
+	if err != nil {
+		return nil, nil, metav1.Condition{}, err
+	}
+	if appliedHash == "" || appliedHash == existingHash {
+		return applyValuesFromInstance(instance, config, existing), applyValuesFromInstance(instance, config, lastApplied), conditions.NoDrift(), nil
+	}
+
+	paths := helmvalues.Diff(lastApplied, existing)
+	if len(paths) > maxDriftedPathsInMessage {
+		paths = append(paths[:maxDriftedPathsInMessage], fmt.Sprintf("and %d more", len(paths)-maxDriftedPathsInMessage))
+	}
+	summary := fmt.Sprintf("Helm values have been changed outside of the operator: %s", strings.Join(paths, ", "))
+	applied = applyValuesFromInstance(instance, config, lastApplied)
+	if policy == v1alpha1.DriftPolicyRevert {
+		return applied, applied, conditions.DriftReverted(summary), nil
+	}
+	return applyValuesFromInstance(instance, config, existing), applied, conditions.Drifted(summary), nil
+}
+
+// setLastAppliedValues stores the given values and their hash sum in the annotations of the release.
+// The hash sum is also copied to the status of the instance.
+func setLastAppliedValues(instance *v1alpha1.PostgresqlStandalone, release *helmv1beta1.Release, applied helmvalues.V) error {
+	rawExt, err := helmvalues.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	hash, err := helmvalues.CanonicalHashSum(applied)
+	if err != nil {
+		return err
+	}
+	if release.Annotations == nil {
+		release.Annotations = map[string]string{}
+	}
+	release.Annotations[LastAppliedValuesAnnotationKey] = string(rawExt.Raw)
+	release.Annotations[AppliedValuesHashAnnotationKey] = hash
+	instance.Status.HelmChart.AppliedValuesHash = hash
+	return nil
+}
@@ -0,0 +1,127 @@
+package steps
+
+import (
+	"testing"
+
+	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveValuesDrift(t *testing.T) {
+	lastApplied := helmvalues.V{"image": helmvalues.V{"tag": "14.1"}}
+	drifted := helmvalues.V{"image": helmvalues.V{"tag": "14.2"}}
+	tests := map[string]struct {
+		givenPolicy        v1alpha1.DriftPolicy
+		givenAppliedHash   bool
+		givenExisting      helmvalues.V
+		expectedTag        string
+		expectedReason     string
+		expectedMessage    string
+		expectedAppliedTag string
+	}{
+		"GivenNoAppliedHash_ThenExpectNoDrift": {
+			givenExisting:      drifted,
+			expectedTag:        "14.2",
+			expectedReason:     conditions.ReasonNoDrift,
+			expectedAppliedTag: "14.1",
+		},
+		"GivenUnchangedValues_ThenExpectNoDrift": {
+			givenAppliedHash:   true,
+			givenExisting:      lastApplied,
+			expectedTag:        "14.1",
+			expectedReason:     conditions.ReasonNoDrift,
+			expectedAppliedTag: "14.1",
+		},
+		"GivenChangedValues_WhenPolicyEmpty_ThenExpectDriftReported": {
+			givenAppliedHash:   true,
+			givenExisting:      drifted,
+			expectedTag:        "14.2",
+			expectedReason:     conditions.ReasonDriftDetected,
+			expectedMessage:    "Helm values have been changed outside of the operator: image.tag",
+			expectedAppliedTag: "14.1",
+		},
+		"GivenChangedValues_WhenPolicyReport_ThenExpectDriftReported": {
+			givenPolicy:        v1alpha1.DriftPolicyReport,
+			givenAppliedHash:   true,
+			givenExisting:      drifted,
+			expectedTag:        "14.2",
+			expectedReason:     conditions.ReasonDriftDetected,
+			expectedMessage:    "Helm values have been changed outside of the operator: image.tag",
+			expectedAppliedTag: "14.1",
+		},
+		"GivenChangedValues_WhenPolicyRevert_ThenExpectDriftReverted": {
+			givenPolicy:        v1alpha1.DriftPolicyRevert,
+			givenAppliedHash:   true,
+			givenExisting:      drifted,
+			expectedTag:        "14.1",
+			expectedReason:     conditions.ReasonDriftReverted,
+			expectedMessage:    "Helm values have been changed outside of the operator: image.tag",
+			expectedAppliedTag: "14.1",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			instance := newInstance("instance", "my-app")
+			appliedValues := applyValuesFromInstance(instance, nil, copyValues(t, lastApplied))
+			appliedHash := ""
+			if tc.givenAppliedHash {
+				hash, err := helmvalues.CanonicalHashSum(appliedValues)
+				require.NoError(t, err)
+				appliedHash = hash
+			}
+			existing := applyValuesFromInstance(instance, nil, copyValues(t, tc.givenExisting))
+
+			// Act
+			values, applied, condition, err := resolveValuesDrift(instance, nil, tc.givenPolicy, appliedHash, appliedValues, existing)
+			require.NoError(t, err)
+
+			// Assert
+			assert.Equal(t, tc.expectedTag, values["image"].(map[string]interface{})["tag"], "image tag")
+			assert.Equal(t, tc.expectedAppliedTag, applied["image"].(map[string]interface{})["tag"], "applied image tag")
+			assert.Equal(t, conditions.TypeDrifted, condition.Type)
+			assert.Equal(t, tc.expectedReason, condition.Reason)
+			assert.Equal(t, tc.expectedMessage, condition.Message)
+		})
+	}
+}
+
+func TestGetAppliedValuesHash(t *testing.T) {
+	tests := map[string]struct {
+		givenAnnotations map[string]string
+		givenStatusHash  string
+		expectedHash     string
+	}{
+		"GivenHashInRelease_ThenExpectHashFromRelease": {
+			givenAnnotations: map[string]string{AppliedValuesHashAnnotationKey: "release"},
+			givenStatusHash:  "status",
+			expectedHash:     "release",
+		},
+		"GivenNoHashInRelease_ThenExpectHashFromStatus": {
+			givenStatusHash: "status",
+			expectedHash:    "status",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Status.HelmChart = &v1alpha1.ChartMetaStatus{AppliedValuesHash: tc.givenStatusHash}
+			release := &helmv1beta1.Release{ObjectMeta: metav1.ObjectMeta{Annotations: tc.givenAnnotations}}
+
+			hash := getAppliedValuesHash(instance, release)
+			assert.Equal(t, tc.expectedHash, hash)
+		})
+	}
+}
+
+func copyValues(t *testing.T, v helmvalues.V) helmvalues.V {
+	values := helmvalues.V{}
+	require.NoError(t, helmvalues.Unmarshal(helmvalues.MustMarshal(v), &values))
+	return values
+}
@@ -0,0 +1,137 @@
+package steps
+
+import (
+	"context"
+
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// HibernatedConnectionSecretKey is the key in the connection secret that marks an instance as hibernated.
+const HibernatedConnectionSecretKey = "POSTGRESQL_HIBERNATED"
+
+// cloudNativePGHibernationAnnotationKey is the annotation that hibernates a CloudNativePG Cluster declaratively.
+const cloudNativePGHibernationAnnotationKey = "cnpg.io/hibernation"
+
+// EnsureHibernationFn returns a func that stops PostgreSQL of a hibernated instance and starts it again once the instance is resumed.
+// The StatefulSet of the primary is scaled to zero replicas, the PVC, the secrets and the backup schedule are kept.
+// The StatefulSetStrategy and the CloudNativePGStrategy already take hibernation into account when they deploy PostgreSQL,
+// the StatefulSet of the Helm chart is scaled directly, since the chart doesn't expose the replicas of the primary.
+// The Helm release isn't updated while the instance is hibernated, since that would scale the StatefulSet up again.
+//
+// The Hibernated condition is set on the instance and stays active until PostgreSQL is ready again after resuming.
+// The status is not updated, the condition is persisted by the next step that updates the status.
+func EnsureHibernationFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+
+		var ready bool
+		if instance.Status.DeploymentStrategy == v1alpha1.StrategyCloudNativePG {
+			ready = getDeploymentStrategyFromContext(ctx).IsReady(ctx)
+		} else {
+			scaled, err := scalePrimary(ctx, instance)
+			if err != nil {
+				return err
+			}
+			ready = scaled
+		}
+		setHibernationCondition(instance, ready)
+		return nil
+	}
+}
+
+// IsHibernatedP returns a predicate that returns true if the instance has an active Hibernated condition.
+func IsHibernatedP() func(ctx context.Context) bool {
+	return func(ctx context.Context) bool {
+		instance := GetInstanceFromContext(ctx)
+		return meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeHibernated)
+	}
+}
+
+// MarkInstanceAsHibernatedFn marks an instance as not ready due to hibernation by updating the status conditions.
+func MarkInstanceAsHibernatedFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		kube := GetClientFromContext(ctx)
+		instance := GetInstanceFromContext(ctx)
+
+		meta.SetStatusCondition(
+			&instance.Status.Conditions,
+			conditions.Builder().
+				With(conditions.NotReady()).
+				WithMessage("Instance is hibernated").
+				WithGeneration(instance).
+				Build(),
+		)
+		meta.RemoveStatusCondition(&instance.Status.Conditions, conditions.TypeProgressing)
+		return kube.Status().Update(ctx, instance)
+	}
+}
+
+// scalePrimary scales the StatefulSet of the primary to the replicas returned by getPrimaryReplicas.
+// It returns true if the StatefulSet already has the desired replicas and is ready.
+func scalePrimary(ctx context.Context, instance *v1alpha1.PostgresqlStandalone) (bool, error) {
+	kube := GetClientFromContext(ctx)
+
+	statefulSet := &appsv1.StatefulSet{}
+	err := kube.Get(ctx, client.ObjectKey{Name: getDeploymentName(), Namespace: instance.Status.GetDeploymentNamespace()}, statefulSet)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	replicas := getPrimaryReplicas(instance)
+	if statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == replicas {
+		return isStatefulSetReady(statefulSet), nil
+	}
+	log := controllerruntime.LoggerFrom(ctx)
+	log.Info("Scaling PostgreSQL", "statefulset", statefulSet.Name, "replicas", replicas)
+	statefulSet.Spec.Replicas = &replicas
+	return false, kube.Update(ctx, statefulSet)
+}
+
+// setHibernationCondition sets the Hibernated condition according to the spec of the instance.
+// After resuming, the condition stays active until PostgreSQL is ready.
+func setHibernationCondition(instance *v1alpha1.PostgresqlStandalone, ready bool) {
+	var condition metav1.Condition
+	switch {
+	case instance.Spec.Parameters.Hibernated:
+		condition = conditions.Hibernated()
+	case !meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeHibernated):
+		return
+	case ready:
+		condition = conditions.Resumed()
+	default:
+		condition = conditions.Resuming("Waiting for PostgreSQL to start")
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(condition).WithGeneration(instance).Build())
+}
+
+// getPrimaryReplicas returns the number of replicas of the StatefulSet of the primary, which is zero for hibernated instances.
+func getPrimaryReplicas(instance *v1alpha1.PostgresqlStandalone) int32 {
+	if instance.Spec.Parameters.Hibernated {
+		return 0
+	}
+	return 1
+}
+
+// setCloudNativePGHibernation sets the annotation that hibernates the Cluster if the instance is hibernated and removes it otherwise.
+func setCloudNativePGHibernation(cluster *unstructured.Unstructured, instance *v1alpha1.PostgresqlStandalone) {
+	annotations := cluster.GetAnnotations()
+	if instance.Spec.Parameters.Hibernated {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[cloudNativePGHibernationAnnotationKey] = "on"
+	} else {
+		delete(annotations, cloudNativePGHibernationAnnotationKey)
+	}
+	cluster.SetAnnotations(annotations)
+}
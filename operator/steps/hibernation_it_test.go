@@ -0,0 +1,78 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+type HibernationSuite struct {
+	operatortest.Suite
+}
+
+func TestHibernationSuite(t *testing.T) {
+	suite.Run(t, new(HibernationSuite))
+}
+
+func (ts *HibernationSuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+}
+
+func (ts *HibernationSuite) Test_EnsureHibernation() {
+	// Arrange
+	deploymentNamespace := "hibernation"
+	ts.EnsureNS(deploymentNamespace)
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Hibernated = true
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	instance.Status.DeploymentStrategy = v1alpha1.StrategyHelmChart
+	labels := map[string]string{"app": "postgresql"}
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: deploymentNamespace},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "postgresql", Image: "postgres"}}},
+			},
+		},
+	}
+	ts.EnsureResources(statefulSet)
+	SetInstanceInContext(ts.Context, instance)
+
+	// Act: hibernate
+	err := EnsureHibernationFn()(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	ts.FetchResource(types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace}, statefulSet)
+	ts.Assert().Equal(int32(0), *statefulSet.Spec.Replicas, "replicas")
+	ts.Assert().True(meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeHibernated), "hibernated")
+
+	// Act: resume
+	instance.Spec.Parameters.Hibernated = false
+	err = EnsureHibernationFn()(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	ts.FetchResource(types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace}, statefulSet)
+	ts.Assert().Equal(int32(1), *statefulSet.Spec.Replicas, "replicas")
+	condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeHibernated)
+	ts.Require().NotNil(condition)
+	ts.Assert().Equal(conditions.ReasonResuming, condition.Reason, "still hibernated until PostgreSQL is ready")
+}
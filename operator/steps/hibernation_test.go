@@ -0,0 +1,75 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetHibernationCondition(t *testing.T) {
+	tests := map[string]struct {
+		givenHibernated bool
+		givenCondition  *metav1.Condition
+		givenReady      bool
+		expectedReason  string
+		expectedStatus  metav1.ConditionStatus
+	}{
+		"GivenHibernated_ThenExpectHibernated": {
+			givenHibernated: true,
+			expectedReason:  conditions.ReasonHibernated,
+			expectedStatus:  metav1.ConditionTrue,
+		},
+		"GivenNotHibernated_WhenNeverHibernated_ThenExpectNoCondition": {
+			givenReady: true,
+		},
+		"GivenResumed_WhenNotReady_ThenExpectResuming": {
+			givenCondition: &metav1.Condition{Type: conditions.TypeHibernated, Status: metav1.ConditionTrue, Reason: conditions.ReasonHibernated},
+			expectedReason: conditions.ReasonResuming,
+			expectedStatus: metav1.ConditionTrue,
+		},
+		"GivenResumed_WhenReady_ThenExpectResumed": {
+			givenCondition: &metav1.Condition{Type: conditions.TypeHibernated, Status: metav1.ConditionTrue, Reason: conditions.ReasonResuming},
+			givenReady:     true,
+			expectedReason: conditions.ReasonResumed,
+			expectedStatus: metav1.ConditionFalse,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Spec.Parameters.Hibernated = tc.givenHibernated
+			if tc.givenCondition != nil {
+				meta.SetStatusCondition(&instance.Status.Conditions, *tc.givenCondition)
+			}
+
+			setHibernationCondition(instance, tc.givenReady)
+
+			condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeHibernated)
+			if tc.expectedReason == "" {
+				assert.Nil(t, condition)
+				return
+			}
+			require.NotNil(t, condition)
+			assert.Equal(t, tc.expectedReason, condition.Reason)
+			assert.Equal(t, tc.expectedStatus, condition.Status)
+		})
+	}
+}
+
+func TestSetCloudNativePGHibernation(t *testing.T) {
+	instance := newInstance("instance", "my-app")
+	cluster := newCloudNativePGCluster("sv-postgresql-s-instance")
+	cluster.SetAnnotations(map[string]string{"other": "annotation"})
+
+	instance.Spec.Parameters.Hibernated = true
+	setCloudNativePGHibernation(cluster, instance)
+	assert.Equal(t, map[string]string{"other": "annotation", "cnpg.io/hibernation": "on"}, cluster.GetAnnotations())
+
+	instance.Spec.Parameters.Hibernated = false
+	setCloudNativePGHibernation(cluster, instance)
+	assert.Equal(t, map[string]string{"other": "annotation"}, cluster.GetAnnotations())
+}
@@ -0,0 +1,108 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	// PropagatedLabelsAnnotationKey is the annotation key that records the keys of the labels that have been propagated to an object.
+	PropagatedLabelsAnnotationKey = fmt.Sprintf("%s/propagated-labels", v1alpha1.Group)
+	// PropagatedAnnotationsAnnotationKey is the annotation key that records the keys of the annotations that have been propagated to an object.
+	PropagatedAnnotationsAnnotationKey = fmt.Sprintf("%s/propagated-annotations", v1alpha1.Group)
+)
+
+// propagateMetadata copies the labels and annotations of the instance and its namespace to the given object,
+// as defined in the v1alpha1.MetadataPropagationSpec of the config.
+// The namespace of the instance is only taken into account if it's in the context, and nothing is copied without config in the context.
+// The keys of the propagated labels and annotations are recorded in the PropagatedLabelsAnnotationKey and PropagatedAnnotationsAnnotationKey annotations,
+// so that the labels and annotations that are no longer propagated can be removed again.
+// They're only removed if the namespace of the instance is in the context, since they might have been propagated from the namespace.
+func propagateMetadata(ctx context.Context, obj metav1.Object) {
+	config, exists := pipeline.LoadFromContext(ctx, ConfigKey{})
+	if !exists {
+		return
+	}
+	sources := []metav1.Object{}
+	ns, nsExists := pipeline.LoadFromContext(ctx, InstanceNamespaceKey{})
+	if nsExists {
+		sources = append(sources, ns.(metav1.Object))
+	}
+	sources = append(sources, GetInstanceFromContext(ctx))
+
+	spec := config.(*v1alpha1.PostgresqlStandaloneOperatorConfig).Spec.MetadataPropagation
+	propagatedLabels, propagatedAnnotations := getPropagatedMetadata(spec, sources...)
+	objLabels, objAnnotations := obj.GetLabels(), obj.GetAnnotations()
+	if nsExists {
+		objLabels = removeStaleKeys(objLabels, objAnnotations[PropagatedLabelsAnnotationKey], propagatedLabels)
+		objAnnotations = removeStaleKeys(objAnnotations, objAnnotations[PropagatedAnnotationsAnnotationKey], propagatedAnnotations)
+	}
+	objLabels = labels.Merge(objLabels, propagatedLabels)
+	objAnnotations = labels.Merge(objAnnotations, propagatedAnnotations)
+	for key, propagated := range map[string]map[string]string{PropagatedLabelsAnnotationKey: propagatedLabels, PropagatedAnnotationsAnnotationKey: propagatedAnnotations} {
+		if len(propagated) == 0 {
+			delete(objAnnotations, key)
+			continue
+		}
+		objAnnotations[key] = joinKeys(propagated)
+	}
+	if len(objLabels) > 0 || obj.GetLabels() != nil {
+		obj.SetLabels(objLabels)
+	}
+	if len(objAnnotations) > 0 || obj.GetAnnotations() != nil {
+		obj.SetAnnotations(objAnnotations)
+	}
+}
+
+// removeStaleKeys removes the given comma-separated keys from the given map, unless they're still propagated.
+func removeStaleKeys(m map[string]string, recordedKeys string, propagated map[string]string) map[string]string {
+	if recordedKeys == "" {
+		return m
+	}
+	for _, key := range strings.Split(recordedKeys, ",") {
+		if _, exists := propagated[key]; !exists {
+			delete(m, key)
+		}
+	}
+	return m
+}
+
+// joinKeys returns the sorted keys of the given map, separated by commas.
+func joinKeys(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// getPropagatedMetadata returns the labels and annotations of the given sources that match the given spec.
+// Later sources take precedence over earlier ones.
+func getPropagatedMetadata(spec v1alpha1.MetadataPropagationSpec, sources ...metav1.Object) (propagatedLabels, propagatedAnnotations map[string]string) {
+	propagatedLabels, propagatedAnnotations = map[string]string{}, map[string]string{}
+	for _, source := range sources {
+		copyMatchingKeys(propagatedLabels, source.GetLabels(), spec.Labels)
+		copyMatchingKeys(propagatedAnnotations, source.GetAnnotations(), spec.Annotations)
+	}
+	return propagatedLabels, propagatedAnnotations
+}
+
+// copyMatchingKeys copies the entries of source to target whose key matches one of the given keys or prefixes that end with `*`.
+func copyMatchingKeys(target, source map[string]string, keys []string) {
+	for key, value := range source {
+		for _, pattern := range keys {
+			if key == pattern || strings.HasSuffix(pattern, "*") && strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+				target[key] = value
+				break
+			}
+		}
+	}
+}
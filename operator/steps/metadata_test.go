@@ -0,0 +1,114 @@
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPropagatedMetadata(t *testing.T) {
+	tests := map[string]struct {
+		givenSpec                v1alpha1.MetadataPropagationSpec
+		givenNamespaceLabels     map[string]string
+		givenInstanceLabels      map[string]string
+		givenInstanceAnnotations map[string]string
+		expectedLabels           map[string]string
+		expectedAnnotations      map[string]string
+	}{
+		"GivenNoSpec_ThenExpectNothingPropagated": {
+			givenInstanceLabels: map[string]string{"example.com/team": "db"},
+			expectedLabels:      map[string]string{},
+			expectedAnnotations: map[string]string{},
+		},
+		"GivenKey_ThenExpectOnlyMatchingKey": {
+			givenSpec:            v1alpha1.MetadataPropagationSpec{Labels: []string{"example.com/cost-center"}},
+			givenNamespaceLabels: map[string]string{"example.com/cost-center": "1234", "example.com/cost-center-owner": "finance"},
+			expectedLabels:       map[string]string{"example.com/cost-center": "1234"},
+			expectedAnnotations:  map[string]string{},
+		},
+		"GivenPrefix_ThenExpectAllKeysWithPrefix": {
+			givenSpec:                v1alpha1.MetadataPropagationSpec{Annotations: []string{"billing.example.com/*"}},
+			givenInstanceAnnotations: map[string]string{"billing.example.com/project": "shop", "billing.example.com/tier": "gold", "other": "value"},
+			expectedLabels:           map[string]string{},
+			expectedAnnotations:      map[string]string{"billing.example.com/project": "shop", "billing.example.com/tier": "gold"},
+		},
+		"GivenKeyOnNamespaceAndInstance_ThenExpectValueOfInstance": {
+			givenSpec:            v1alpha1.MetadataPropagationSpec{Labels: []string{"example.com/*"}},
+			givenNamespaceLabels: map[string]string{"example.com/team": "platform", "example.com/cost-center": "1234"},
+			givenInstanceLabels:  map[string]string{"example.com/team": "db"},
+			expectedLabels:       map[string]string{"example.com/team": "db", "example.com/cost-center": "1234"},
+			expectedAnnotations:  map[string]string{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Labels: tc.givenNamespaceLabels}}
+			instance := &v1alpha1.PostgresqlStandalone{ObjectMeta: metav1.ObjectMeta{Labels: tc.givenInstanceLabels, Annotations: tc.givenInstanceAnnotations}}
+
+			resultLabels, resultAnnotations := getPropagatedMetadata(tc.givenSpec, ns, instance)
+			assert.Equal(t, tc.expectedLabels, resultLabels, "labels")
+			assert.Equal(t, tc.expectedAnnotations, resultAnnotations, "annotations")
+		})
+	}
+}
+
+func TestPropagateMetadata(t *testing.T) {
+	// Arrange
+	ctx := pipeline.MutableContext(context.Background())
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+	config.Spec.MetadataPropagation = v1alpha1.MetadataPropagationSpec{Labels: []string{"example.com/team"}, Annotations: []string{"example.com/*"}}
+	pipeline.StoreInContext(ctx, ConfigKey{}, config)
+	pipeline.StoreInContext(ctx, InstanceNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Labels:      map[string]string{"example.com/team": "platform"},
+		Annotations: map[string]string{"example.com/contact": "platform@example.com"},
+	}})
+	SetInstanceInContext(ctx, newInstance("instance", "my-app"))
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"existing": "label"}}}
+
+	// Act
+	propagateMetadata(ctx, secret)
+
+	// Assert
+	assert.Equal(t, map[string]string{"existing": "label", "example.com/team": "platform"}, secret.Labels)
+	assert.Equal(t, map[string]string{
+		"example.com/contact":              "platform@example.com",
+		PropagatedLabelsAnnotationKey:      "example.com/team",
+		PropagatedAnnotationsAnnotationKey: "example.com/contact",
+	}, secret.Annotations)
+}
+
+func TestPropagateMetadata_GivenRemovedMetadata_ThenExpectStaleMetadataRemoved(t *testing.T) {
+	// Arrange
+	ctx := pipeline.MutableContext(context.Background())
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+	config.Spec.MetadataPropagation = v1alpha1.MetadataPropagationSpec{Labels: []string{"example.com/*"}, Annotations: []string{"example.com/*"}}
+	pipeline.StoreInContext(ctx, ConfigKey{}, config)
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Labels:      map[string]string{"example.com/team": "platform", "example.com/cost-center": "42"},
+		Annotations: map[string]string{"example.com/contact": "platform@example.com"},
+	}}
+	pipeline.StoreInContext(ctx, InstanceNamespaceKey{}, ns)
+	SetInstanceInContext(ctx, newInstance("instance", "my-app"))
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Labels:      map[string]string{"existing": "label"},
+		Annotations: map[string]string{"example.com/manual": "annotation"},
+	}}
+	propagateMetadata(ctx, secret)
+
+	// Act
+	delete(ns.Labels, "example.com/cost-center")
+	delete(ns.Annotations, "example.com/contact")
+	propagateMetadata(ctx, secret)
+
+	// Assert
+	assert.Equal(t, map[string]string{"existing": "label", "example.com/team": "platform"}, secret.Labels)
+	assert.Equal(t, map[string]string{
+		"example.com/manual":          "annotation",
+		PropagatedLabelsAnnotationKey: "example.com/team",
+	}, secret.Annotations)
+}
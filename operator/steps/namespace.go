@@ -2,6 +2,8 @@ package steps
 
 import (
 	"context"
+	"strings"
+
 	pipeline "github.com/ccremer/go-command-pipeline"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,10 +16,16 @@ import (
 // AppuioOrganizationLabelKey is the label key required for setting ownership of a namespace
 const AppuioOrganizationLabelKey = "appuio.io/organization"
 
+// PodSecurityLabelPrefix is the prefix of the labels that configure Pod Security Admission for a namespace.
+const PodSecurityLabelPrefix = "pod-security.kubernetes.io/"
+
 // EnsureNamespace creates the namespace with given name and labels.
+// The namespace also gets the propagated labels and annotations, see propagateMetadata,
+// and the Pod Security Admission labels of the config, see setPodSecurityLabels.
 func EnsureNamespace(name string, labelSet labels.Set) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
+		config := GetConfigFromContext(ctx)
 		instanceNamespace := getFromContextOrPanic(ctx, InstanceNamespaceKey{}).(*corev1.Namespace)
 		instanceNsLabels := instanceNamespace.Labels
 		copyLabels := labels.Set{}
@@ -29,7 +37,9 @@ func EnsureNamespace(name string, labelSet labels.Set) func(ctx context.Context)
 			ObjectMeta: metav1.ObjectMeta{Name: name},
 		}
 		_, err := controllerutil.CreateOrUpdate(ctx, kube, deploymentNamespace, func() error {
+			propagateMetadata(ctx, deploymentNamespace)
 			deploymentNamespace.Labels = labels.Merge(deploymentNamespace.Labels, labels.Merge(copyLabels, labelSet))
+			setPodSecurityLabels(deploymentNamespace, config.Spec.DeploymentNamespace.PodSecurityLabels)
 			return nil
 		})
 		pipeline.StoreInContext(ctx, DeploymentNamespaceKey{}, deploymentNamespace)
@@ -37,6 +47,16 @@ func EnsureNamespace(name string, labelSet labels.Set) func(ctx context.Context)
 	}
 }
 
+// setPodSecurityLabels sets the given Pod Security Admission labels on the namespace and removes the ones that aren't given.
+func setPodSecurityLabels(ns *corev1.Namespace, podSecurityLabels map[string]string) {
+	for key := range ns.Labels {
+		if _, exists := podSecurityLabels[key]; strings.HasPrefix(key, PodSecurityLabelPrefix) && !exists {
+			delete(ns.Labels, key)
+		}
+	}
+	ns.Labels = labels.Merge(ns.Labels, podSecurityLabels)
+}
+
 // DeleteNamespaceFn deletes the namespace where the instance is deployed.
 // Ignore "not found" error and returns nil if deployment namespace is unknown.
 func DeleteNamespaceFn() func(ctx context.Context) error {
@@ -4,6 +4,7 @@ import (
 	"context"
 	pipeline "github.com/ccremer/go-command-pipeline"
 	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,8 +30,15 @@ func (ts *NamespaceSuite) Test_EnsureNamespace() {
 	// Arrange
 	instance := newInstance("test-ensure-namespace", "my-app")
 	instanceNs := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: instance.Namespace, Labels: map[string]string{"appuio.io/organization": "organization"}}}
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+	config.Spec.DeploymentNamespace.PodSecurityLabels = map[string]string{"pod-security.kubernetes.io/enforce": "restricted"}
+	ts.EnsureResources(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "sv-postgresql-s-merry-vigilante-7b16",
+		Labels: map[string]string{"pod-security.kubernetes.io/warn": "baseline"},
+	}})
 	SetInstanceInContext(ts.Context, instance)
 	pipeline.StoreInContext(ts.Context, InstanceNamespaceKey{}, instanceNs)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
 
 	// Act
 	err := EnsureNamespace("sv-postgresql-s-merry-vigilante-7b16", labels.Set{
@@ -45,6 +53,8 @@ func (ts *NamespaceSuite) Test_EnsureNamespace() {
 	ts.Assert().Equal(ns.Labels["app.kubernetes.io/instance"], instance.Name)
 	ts.Assert().Equal(ns.Labels["app.kubernetes.io/instance-namespace"], instance.Namespace)
 	ts.Assert().Equal(ns.Labels["appuio.io/organization"], "organization", "label required by APPUiO Cloud")
+	ts.Assert().Equal("restricted", ns.Labels["pod-security.kubernetes.io/enforce"], "configured pod security label")
+	ts.Assert().NotContains(ns.Labels, "pod-security.kubernetes.io/warn", "unconfigured pod security label")
 }
 
 func (ts *NamespaceSuite) Test_DeleteNamespace() {
@@ -0,0 +1,166 @@
+package steps
+
+import (
+	"context"
+
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// defaultContainerResources are the resources of containers that don't specify them in deployment namespaces with a ResourceQuota, see getLimitRangeSpec.
+var defaultContainerResources = corev1.ResourceRequirements{
+	Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+	Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+}
+
+// EnsureNamespacePoliciesFn returns a func that limits the resources in the deployment namespace of the instance
+// with a ResourceQuota and a LimitRange, according to the v1alpha1.DeploymentNamespaceConfig of the config.
+// This way, the deployed resources can't use more than the resources of the instance, even if a chart is misconfigured.
+// The ResourceQuota and the LimitRange are deleted if they're not configured,
+// but a LimitRange with container defaults is always created if the ResourceQuota limits compute resources, see getLimitRangeSpec.
+func EnsureNamespacePoliciesFn(labelSet labels.Set) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		kube := GetClientFromContext(ctx)
+		config := GetConfigFromContext(ctx)
+		instance := GetInstanceFromContext(ctx)
+		ns := getFromContextOrPanic(ctx, DeploymentNamespaceKey{}).(*corev1.Namespace).Name
+		namespaceConfig := config.Spec.DeploymentNamespace
+
+		quota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}}
+		var hard corev1.ResourceList
+		if namespaceConfig.ResourceQuota == nil {
+			if err := kube.Delete(ctx, quota); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		} else {
+			hard = getResourceQuotaHard(config, instance)
+			_, err := controllerutil.CreateOrUpdate(ctx, kube, quota, func() error {
+				quota.Labels = labels.Merge(quota.Labels, labelSet)
+				quota.Spec.Hard = hard
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		limitRange := &corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}}
+		spec := getLimitRangeSpec(namespaceConfig.LimitRange, hard)
+		if spec == nil {
+			return client.IgnoreNotFound(kube.Delete(ctx, limitRange))
+		}
+		_, err := controllerutil.CreateOrUpdate(ctx, kube, limitRange, func() error {
+			limitRange.Labels = labels.Merge(limitRange.Labels, labelSet)
+			limitRange.Spec = *spec
+			return nil
+		})
+		return err
+	}
+}
+
+// getLimitRangeSpec returns the spec of the LimitRange in the deployment namespace of the instance, or nil if no LimitRange is required.
+// If the given ResourceQuota limits compute resources, pods are rejected unless all their containers specify these resources.
+// Therefore, the container defaults of the given template are completed with defaultContainerResources for each compute resource of the quota,
+// so that containers of charts that don't specify their resources still run.
+func getLimitRangeSpec(template *corev1.LimitRangeSpec, hard corev1.ResourceList) *corev1.LimitRangeSpec {
+	spec := &corev1.LimitRangeSpec{}
+	if template != nil {
+		spec = template.DeepCopy()
+	}
+	var item *corev1.LimitRangeItem
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if !isComputeResourceInQuota(hard, name) {
+			continue
+		}
+		if item == nil {
+			item = getContainerLimitRangeItem(spec)
+		}
+		if _, exists := item.Default[name]; !exists {
+			item.Default[name] = defaultContainerResources.Limits[name].DeepCopy()
+		}
+		if _, exists := item.DefaultRequest[name]; !exists {
+			item.DefaultRequest[name] = defaultContainerResources.Requests[name].DeepCopy()
+		}
+	}
+	if template == nil && item == nil {
+		return nil
+	}
+	return spec
+}
+
+// getContainerLimitRangeItem returns the item of the given spec that limits containers, and adds one if there is none.
+func getContainerLimitRangeItem(spec *corev1.LimitRangeSpec) *corev1.LimitRangeItem {
+	index := -1
+	for i := range spec.Limits {
+		if spec.Limits[i].Type == corev1.LimitTypeContainer {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		spec.Limits = append(spec.Limits, corev1.LimitRangeItem{Type: corev1.LimitTypeContainer})
+		index = len(spec.Limits) - 1
+	}
+	item := &spec.Limits[index]
+	if item.Default == nil {
+		item.Default = corev1.ResourceList{}
+	}
+	if item.DefaultRequest == nil {
+		item.DefaultRequest = corev1.ResourceList{}
+	}
+	return item
+}
+
+// isComputeResourceInQuota returns true if the given quota limits the requests or the limits of the given compute resource.
+func isComputeResourceInQuota(hard corev1.ResourceList, name corev1.ResourceName) bool {
+	for _, key := range []string{string(name), "requests." + string(name), "limits." + string(name)} {
+		if _, exists := hard[corev1.ResourceName(key)]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// getResourceQuotaHard returns the limits of the ResourceQuota in the deployment namespace of the instance.
+// The compute resources and the storage capacity of the instance are increased by the headroom of the v1alpha1.ResourceQuotaTemplate,
+// and the storage requests are tripled while the storage is migrated, since the backup and the new PersistentVolumeClaim exist next to the old one.
+// The compute resources of the migration jobs are added while the storage is migrated, so that the jobs can run next to PostgreSQL.
+// Resources that the instance doesn't specify are only limited by the additional limits of the template.
+func getResourceQuotaHard(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) corev1.ResourceList {
+	template := config.Spec.DeploymentNamespace.ResourceQuota
+	numerator := 100 + template.HeadroomPercentage
+	migrating := instance.Status.StorageMigration != nil || isStorageMigrationRequired(instance)
+	hard := corev1.ResourceList{}
+
+	compute := getComputeResources(config, instance)
+	for prefix, list := range map[string]corev1.ResourceList{"requests.": compute.Requests, "limits.": compute.Limits} {
+		for name, quantity := range list {
+			hard[corev1.ResourceName(prefix+string(name))] = *scaleQuantity(name, &quantity, numerator, 100)
+		}
+	}
+	if migrating {
+		for prefix, list := range map[string]corev1.ResourceList{"requests.": migrationJobResources.Requests, "limits.": migrationJobResources.Limits} {
+			for name, quantity := range list {
+				if total, exists := hard[corev1.ResourceName(prefix+string(name))]; exists {
+					total.Add(quantity)
+					hard[corev1.ResourceName(prefix+string(name))] = total
+				}
+			}
+		}
+	}
+	if capacity := instance.Spec.Parameters.Resources.StorageCapacity; capacity != nil {
+		if migrating {
+			numerator *= 3
+		}
+		hard[corev1.ResourceRequestsStorage] = *scaleQuantity(corev1.ResourceStorage, capacity, numerator, 100)
+	}
+	for name, quantity := range template.Hard {
+		hard[name] = quantity.DeepCopy()
+	}
+	return hard
+}
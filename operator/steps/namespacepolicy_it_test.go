@@ -0,0 +1,100 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type NamespacePolicySuite struct {
+	operatortest.Suite
+}
+
+func TestNamespacePolicySuite(t *testing.T) {
+	suite.Run(t, new(NamespacePolicySuite))
+}
+
+func (ts *NamespacePolicySuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+}
+
+func (ts *NamespacePolicySuite) Test_EnsureNamespacePolicies() {
+	// Arrange
+	deploymentNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace-policies"}}
+	ts.EnsureResources(deploymentNamespace)
+	instance := newInstance("instance", "my-app")
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	config.Spec.DeploymentNamespace.ResourceQuota = &v1alpha1.ResourceQuotaTemplate{
+		HeadroomPercentage: 50,
+		Hard:               corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+	}
+	config.Spec.DeploymentNamespace.LimitRange = &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+		Type:    corev1.LimitTypeContainer,
+		Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+	}}}
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, deploymentNamespace)
+	ensure := EnsureNamespacePoliciesFn(labels.Set{"test": "label"})
+
+	// Act
+	ts.Require().NoError(ensure(ts.Context))
+
+	// Assert
+	quota := &corev1.ResourceQuota{}
+	ts.FetchResource(types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace.Name}, quota)
+	ts.Assert().Equal("label", quota.Labels["test"])
+	ts.Assert().Equal("3Gi", quota.Spec.Hard.Name(corev1.ResourceLimitsMemory, resource.BinarySI).String())
+	ts.Assert().Equal("1536Mi", quota.Spec.Hard.Name(corev1.ResourceRequestsStorage, resource.BinarySI).String())
+	ts.Assert().Equal("2", quota.Spec.Hard.Pods().String())
+	limitRange := &corev1.LimitRange{}
+	ts.FetchResource(types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace.Name}, limitRange)
+	ts.Assert().Equal("128Mi", limitRange.Spec.Limits[0].Default.Memory().String())
+
+	// Act: remove templates
+	config.Spec.DeploymentNamespace = v1alpha1.DeploymentNamespaceConfig{}
+	ts.Require().NoError(ensure(ts.Context))
+
+	// Assert
+	err := ts.Client.Get(ts.Context, types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace.Name}, quota)
+	AssertResourceNotExists(ts.T(), quota.DeletionTimestamp, err)
+	err = ts.Client.Get(ts.Context, types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace.Name}, limitRange)
+	AssertResourceNotExists(ts.T(), limitRange.DeletionTimestamp, err)
+}
+
+func (ts *NamespacePolicySuite) Test_EnsureNamespacePolicies_GivenQuotaWithComputeResources_WhenNoLimitRange_ThenExpectDefaults() {
+	// Arrange
+	deploymentNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace-policies-defaults"}}
+	ts.EnsureResources(deploymentNamespace)
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Resources.ComputeResources = v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi")}
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	config.Spec.DeploymentNamespace.ResourceQuota = &v1alpha1.ResourceQuotaTemplate{}
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, deploymentNamespace)
+	ensure := EnsureNamespacePoliciesFn(labels.Set{})
+
+	// Act
+	ts.Require().NoError(ensure(ts.Context))
+
+	// Assert
+	limitRange := &corev1.LimitRange{}
+	ts.FetchResource(types.NamespacedName{Name: getDeploymentName(), Namespace: deploymentNamespace.Name}, limitRange)
+	ts.Require().Len(limitRange.Spec.Limits, 1)
+	ts.Assert().Equal(corev1.LimitTypeContainer, limitRange.Spec.Limits[0].Type)
+	ts.Assert().Equal("256Mi", limitRange.Spec.Limits[0].Default.Memory().String())
+	ts.Assert().Equal("128Mi", limitRange.Spec.Limits[0].DefaultRequest.Memory().String())
+}
@@ -0,0 +1,196 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestGetResourceQuotaHard(t *testing.T) {
+	tests := map[string]struct {
+		givenResources     v1alpha1.Resources
+		givenTemplate      v1alpha1.ResourceQuotaTemplate
+		givenMigration     bool
+		expectedQuantities map[corev1.ResourceName]string
+	}{
+		"GivenNoResources_ThenExpectOnlyAdditionalLimits": {
+			givenTemplate:      v1alpha1.ResourceQuotaTemplate{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3")}},
+			expectedQuantities: map[corev1.ResourceName]string{"pods": "3"},
+		},
+		"GivenResources_WhenNoHeadroom_ThenExpectResourcesOfInstance": {
+			givenResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("500m"), MemoryLimit: parseResource("1Gi")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("10Gi")},
+			},
+			expectedQuantities: map[corev1.ResourceName]string{"requests.cpu": "500m", "limits.memory": "1Gi", "requests.storage": "10Gi"},
+		},
+		"GivenResources_WhenHeadroom_ThenExpectIncreasedResources": {
+			givenResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("500m"), CPULimit: parseResource("1"), MemoryLimit: parseResource("1Gi")},
+				StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("10Gi")},
+			},
+			givenTemplate:      v1alpha1.ResourceQuotaTemplate{HeadroomPercentage: 50},
+			expectedQuantities: map[corev1.ResourceName]string{"requests.cpu": "750m", "limits.cpu": "1500m", "limits.memory": "1536Mi", "requests.storage": "15Gi"},
+		},
+		"GivenStorageMigration_ThenExpectTripledStorage": {
+			givenResources:     v1alpha1.Resources{StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("10Gi")}},
+			givenTemplate:      v1alpha1.ResourceQuotaTemplate{HeadroomPercentage: 10},
+			givenMigration:     true,
+			expectedQuantities: map[corev1.ResourceName]string{"requests.storage": "33Gi"},
+		},
+		"GivenStorageMigration_WhenComputeResources_ThenExpectResourcesOfMigrationJobsAdded": {
+			givenResources: v1alpha1.Resources{
+				ComputeResources: v1alpha1.ComputeResources{CPURequest: parseResource("500m"), MemoryLimit: parseResource("1Gi")},
+			},
+			givenMigration:     true,
+			expectedQuantities: map[corev1.ResourceName]string{"requests.cpu": "600m", "limits.memory": "1280Mi"},
+		},
+		"GivenAdditionalLimit_WhenDerivedFromInstance_ThenExpectAdditionalLimit": {
+			givenResources:     v1alpha1.Resources{StorageResources: v1alpha1.StorageResources{StorageCapacity: parseResource("10Gi")}},
+			givenTemplate:      v1alpha1.ResourceQuotaTemplate{Hard: corev1.ResourceList{corev1.ResourceRequestsStorage: resource.MustParse("100Gi")}},
+			expectedQuantities: map[corev1.ResourceName]string{"requests.storage": "100Gi"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := &v1alpha1.PostgresqlStandalone{}
+			instance.Spec.Parameters.Resources = tc.givenResources
+			if tc.givenMigration {
+				instance.Status.StorageMigration = &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseBackingUp}
+			}
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.DeploymentNamespace.ResourceQuota = &tc.givenTemplate
+
+			result := getResourceQuotaHard(config, instance)
+			quantities := map[corev1.ResourceName]string{}
+			for name, quantity := range result {
+				quantities[name] = quantity.String()
+			}
+			assert.Equal(t, tc.expectedQuantities, quantities)
+		})
+	}
+}
+
+func TestGetResourceQuotaHard_GivenStorageMigration_ThenExpectMigrationJobWithinQuota(t *testing.T) {
+	// Arrange
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Resources.ComputeResources = v1alpha1.ComputeResources{
+		CPURequest: parseResource("1"), CPULimit: parseResource("2"), MemoryRequest: parseResource("1Gi"), MemoryLimit: parseResource("2Gi"),
+	}
+	instance.Status.StorageMigration = &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseRestoring}
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+	config.Spec.DeploymentNamespace.ResourceQuota = &v1alpha1.ResourceQuotaTemplate{}
+	job := &batchv1.Job{}
+	setMigrationJobSpec(job, instance, config, getDeploymentName(), labels.Set{}, migrationRestoreCommand)
+
+	// Act
+	hard := getResourceQuotaHard(config, instance)
+
+	// Assert
+	compute := getComputeResources(config, instance)
+	for prefix, lists := range map[string][]corev1.ResourceList{
+		"requests.": {compute.Requests, job.Spec.Template.Spec.Containers[0].Resources.Requests},
+		"limits.":   {compute.Limits, job.Spec.Template.Spec.Containers[0].Resources.Limits},
+	} {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			used := resource.Quantity{}
+			for _, list := range lists {
+				quantity, exists := list[name]
+				assert.True(t, exists, "%s%s declared", prefix, name)
+				used.Add(quantity)
+			}
+			limit := hard[corev1.ResourceName(prefix+string(name))]
+			assert.True(t, used.Cmp(limit) <= 0, "%s%s of PostgreSQL and the migration job (%s) within quota (%s)", prefix, name, used.String(), limit.String())
+		}
+	}
+}
+
+func TestGetLimitRangeSpec(t *testing.T) {
+	tests := map[string]struct {
+		givenTemplate          *corev1.LimitRangeSpec
+		givenHard              corev1.ResourceList
+		expectedNil            bool
+		expectedDefault        map[corev1.ResourceName]string
+		expectedDefaultRequest map[corev1.ResourceName]string
+	}{
+		"GivenNoTemplate_WhenNoQuota_ThenExpectNil": {
+			expectedNil: true,
+		},
+		"GivenNoTemplate_WhenQuotaWithoutComputeResources_ThenExpectNil": {
+			givenHard:   corev1.ResourceList{corev1.ResourceRequestsStorage: resource.MustParse("10Gi")},
+			expectedNil: true,
+		},
+		"GivenNoTemplate_WhenQuotaWithComputeResources_ThenExpectDefaults": {
+			givenHard:              corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1"), corev1.ResourceLimitsMemory: resource.MustParse("1Gi")},
+			expectedDefault:        map[corev1.ResourceName]string{"cpu": "500m", "memory": "256Mi"},
+			expectedDefaultRequest: map[corev1.ResourceName]string{"cpu": "100m", "memory": "128Mi"},
+		},
+		"GivenNoTemplate_WhenQuotaWithOnlyMemory_ThenExpectMemoryDefaults": {
+			givenHard:              corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			expectedDefault:        map[corev1.ResourceName]string{"memory": "256Mi"},
+			expectedDefaultRequest: map[corev1.ResourceName]string{"memory": "128Mi"},
+		},
+		"GivenTemplate_WhenQuotaWithComputeResources_ThenExpectTemplateCompleted": {
+			givenTemplate: &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+				Type:    corev1.LimitTypeContainer,
+				Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			}}},
+			givenHard:              corev1.ResourceList{corev1.ResourceLimitsCPU: resource.MustParse("2"), corev1.ResourceLimitsMemory: resource.MustParse("2Gi")},
+			expectedDefault:        map[corev1.ResourceName]string{"cpu": "500m", "memory": "512Mi"},
+			expectedDefaultRequest: map[corev1.ResourceName]string{"cpu": "100m", "memory": "128Mi"},
+		},
+		"GivenTemplate_WhenNoQuota_ThenExpectTemplate": {
+			givenTemplate: &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+				Type:    corev1.LimitTypeContainer,
+				Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			}}},
+			expectedDefault: map[corev1.ResourceName]string{"memory": "512Mi"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			result := getLimitRangeSpec(tc.givenTemplate, tc.givenHard)
+
+			// Assert
+			if tc.expectedNil {
+				assert.Nil(t, result)
+				return
+			}
+			require.NotNil(t, result)
+			require.Len(t, result.Limits, 1)
+			assert.Equal(t, corev1.LimitTypeContainer, result.Limits[0].Type)
+			assert.Equal(t, tc.expectedDefault, getQuantityStrings(result.Limits[0].Default), "default")
+			assert.Equal(t, tc.expectedDefaultRequest, getQuantityStrings(result.Limits[0].DefaultRequest), "default request")
+		})
+	}
+}
+
+func TestGetLimitRangeSpec_GivenTemplate_ThenExpectTemplateUnchanged(t *testing.T) {
+	// Arrange
+	template := &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypePod}}}
+
+	// Act
+	result := getLimitRangeSpec(template, corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")})
+
+	// Assert
+	assert.Len(t, result.Limits, 2)
+	assert.Equal(t, []corev1.LimitRangeItem{{Type: corev1.LimitTypePod}}, template.Limits)
+}
+
+func getQuantityStrings(list corev1.ResourceList) map[corev1.ResourceName]string {
+	if len(list) == 0 {
+		return nil
+	}
+	quantities := map[corev1.ResourceName]string{}
+	for name, quantity := range list {
+		quantities[name] = quantity.String()
+	}
+	return quantities
+}
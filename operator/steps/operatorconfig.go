@@ -3,13 +3,36 @@ package steps
 import (
 	"context"
 	"fmt"
+
 	pipeline "github.com/ccremer/go-command-pipeline"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// OperatorConfigMajorVersionIndex is the name of the field index that indexes v1alpha1.PostgresqlStandaloneOperatorConfig by their major version.
+// The major version is taken from the v1alpha1.PostgresqlMajorVersionLabelKey label.
+const OperatorConfigMajorVersionIndex = "metadata.labels.majorVersion"
+
+// IndexOperatorConfigByMajorVersion returns the values for the OperatorConfigMajorVersionIndex field index.
+func IndexOperatorConfigByMajorVersion(obj client.Object) []string {
+	if version, exists := obj.GetLabels()[v1alpha1.PostgresqlMajorVersionLabelKey]; exists {
+		return []string{version}
+	}
+	return nil
+}
+
+// InstanceMajorVersionIndex is the name of the field index that indexes v1alpha1.PostgresqlStandalone by their major version.
+const InstanceMajorVersionIndex = "spec.forInstance.majorVersion"
+
+// IndexInstanceByMajorVersion returns the values for the InstanceMajorVersionIndex field index.
+func IndexInstanceByMajorVersion(obj client.Object) []string {
+	instance := obj.(*v1alpha1.PostgresqlStandalone)
+	return []string{instance.Spec.Parameters.MajorVersion.String()}
+}
+
 // FetchOperatorConfigFn fetches a matching v1alpha1.PostgresqlStandaloneOperatorConfig from the OperatorNamespace.
 // The Major version specified in v1alpha1.PostgresqlStandalone is used to filter the correct config by the v1alpha1.PostgresqlMajorVersionLabelKey label.
+// The lookup requires the OperatorConfigMajorVersionIndex field index in the client's cache.
 // If there is none or multiple found, it returns an error.
 func FetchOperatorConfigFn(operatorNamespace string) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
@@ -17,22 +40,48 @@ func FetchOperatorConfigFn(operatorNamespace string) func(ctx context.Context) e
 		instance := GetInstanceFromContext(ctx)
 
 		list := &v1alpha1.PostgresqlStandaloneOperatorConfigList{}
-		labelMatch := client.MatchingLabels{
-			v1alpha1.PostgresqlMajorVersionLabelKey: instance.Spec.Parameters.MajorVersion.String(),
-		}
-		ns := client.InNamespace(operatorNamespace)
-		err := kube.List(ctx, list, labelMatch, ns)
+		version := instance.Spec.Parameters.MajorVersion.String()
+		err := kube.List(ctx, list, client.MatchingFields{OperatorConfigMajorVersionIndex: version}, client.InNamespace(operatorNamespace))
 		if err != nil {
 			return err
 		}
 		if len(list.Items) == 0 {
-			return fmt.Errorf("no %s found with label '%s' in namespace '%s'", v1alpha1.PostgresqlStandaloneOperatorConfigKind, labelMatch, ns)
+			return fmt.Errorf("no %s found with label '%s=%s' in namespace '%s'", v1alpha1.PostgresqlStandaloneOperatorConfigKind, v1alpha1.PostgresqlMajorVersionLabelKey, version, operatorNamespace)
 		}
 		if len(list.Items) > 1 {
-			return fmt.Errorf("multiple versions of %s found with label '%s' in namespace '%s'", v1alpha1.PostgresqlStandaloneOperatorConfigKind, labelMatch, ns)
+			return fmt.Errorf("multiple versions of %s found with label '%s=%s' in namespace '%s'", v1alpha1.PostgresqlStandaloneOperatorConfigKind, v1alpha1.PostgresqlMajorVersionLabelKey, version, operatorNamespace)
 		}
 
 		pipeline.StoreInContext(ctx, ConfigKey{}, &list.Items[0])
 		return nil
 	}
 }
+
+// UpdateOperatorConfigStatusFn updates the status of the v1alpha1.PostgresqlStandaloneOperatorConfig in the context.
+// It reports the entries of HelmReleases that conflict with each other for the chart version of the HelmReleaseTemplate.
+func UpdateOperatorConfigStatusFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		kube := GetClientFromContext(ctx)
+		config := GetConfigFromContext(ctx)
+
+		config.Status.HelmReleaseConflicts = getHelmReleaseConflicts(config)
+		config.Status.SetObservedGeneration(config)
+		return kube.Status().Update(ctx, config)
+	}
+}
+
+func getHelmReleaseConflicts(config *v1alpha1.PostgresqlStandaloneOperatorConfig) []v1alpha1.HelmReleaseConflict {
+	if config.Spec.HelmReleaseTemplate == nil {
+		return nil
+	}
+	version := config.Spec.HelmReleaseTemplate.Chart.Version
+	selected, conflicting := FindHelmReleaseConfig(config.Spec.HelmReleases, version)
+	if len(conflicting) == 0 {
+		return nil
+	}
+	conflict := v1alpha1.HelmReleaseConflict{Version: version, Selected: selected.Chart.Version}
+	for _, release := range conflicting {
+		conflict.Ignored = append(conflict.Ignored, release.Chart.Version)
+	}
+	return []v1alpha1.HelmReleaseConflict{conflict}
+}
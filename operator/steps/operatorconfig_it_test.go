@@ -9,7 +9,10 @@ import (
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"testing"
+	"time"
 )
 
 type OperatorConfigSuite struct {
@@ -35,7 +38,7 @@ func (ts *OperatorConfigSuite) Test_FetchOperatorConfig() {
 		"GivenNoExistingConfig_WhenFetching_ThenExpectError": {
 			prepare:        func() {},
 			givenNamespace: "nonexisting",
-			expectedError:  "no PostgresqlStandaloneOperatorConfig found with label 'map[postgresql.appcat.vshn.io/major-version:v14]' in namespace 'nonexisting'",
+			expectedError:  "no PostgresqlStandaloneOperatorConfig found with label 'postgresql.appcat.vshn.io/major-version=v14' in namespace 'nonexisting'",
 		},
 		"GivenExistingConfig_WhenLabelsMatch_ThenExpectSingleEntry": {
 			prepare: func() {
@@ -61,15 +64,24 @@ func (ts *OperatorConfigSuite) Test_FetchOperatorConfig() {
 				ts.EnsureResources(cfg1, cfg2)
 			},
 			givenNamespace: "multiple-entries",
-			expectedError:  "multiple versions of PostgresqlStandaloneOperatorConfig found with label 'map[postgresql.appcat.vshn.io/major-version:v14]' in namespace 'multiple-entries'",
+			expectedError:  "multiple versions of PostgresqlStandaloneOperatorConfig found with label 'postgresql.appcat.vshn.io/major-version=v14' in namespace 'multiple-entries'",
 		},
 	}
+	cachedClient := ts.newCachedClient()
 	for name, tc := range tests {
 		ts.Run(name, func() {
-			SetClientInContext(ts.Context, ts.Client)
+			SetClientInContext(ts.Context, cachedClient)
 			SetInstanceInContext(ts.Context, newInstance("instance", "my-app"))
 			tc.prepare()
-			err := FetchOperatorConfigFn(tc.givenNamespace)(ts.Context)
+			var err error
+			// The cache is eventually consistent, the configs may not be visible immediately.
+			ts.Eventually(func() bool {
+				err = FetchOperatorConfigFn(tc.givenNamespace)(ts.Context)
+				if tc.expectedError != "" {
+					return err != nil && err.Error() == tc.expectedError
+				}
+				return err == nil
+			}, 5*time.Second, 100*time.Millisecond)
 			if tc.expectedError != "" {
 				ts.Require().EqualError(err, tc.expectedError)
 				return
@@ -79,6 +91,24 @@ func (ts *OperatorConfigSuite) Test_FetchOperatorConfig() {
 	}
 }
 
+// newCachedClient returns a client that reads from an informer cache that has the OperatorConfigMajorVersionIndex.
+func (ts *OperatorConfigSuite) newCachedClient() client.Client {
+	informers, err := cache.New(ts.Config, cache.Options{Scheme: ts.Scheme})
+	ts.Require().NoError(err)
+	ts.Require().NoError(informers.IndexField(ts.Context, &v1alpha1.PostgresqlStandaloneOperatorConfig{}, OperatorConfigMajorVersionIndex, IndexOperatorConfigByMajorVersion))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ts.T().Cleanup(cancel)
+	go func() {
+		ts.Assert().NoError(informers.Start(ctx))
+	}()
+	ts.Require().True(informers.WaitForCacheSync(ctx), "cache sync")
+
+	cachedClient, err := client.NewDelegatingClient(client.NewDelegatingClientInput{CacheReader: informers, Client: ts.Client})
+	ts.Require().NoError(err)
+	return cachedClient
+}
+
 func newPostgresqlStandaloneOperatorConfig(name string, namespace string) *v1alpha1.PostgresqlStandaloneOperatorConfig {
 	return &v1alpha1.PostgresqlStandaloneOperatorConfig{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,73 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+)
+
+func TestGetHelmReleaseConflicts(t *testing.T) {
+	tests := map[string]struct {
+		givenSpec         v1alpha1.PostgresqlStandaloneOperatorConfigSpec
+		expectedConflicts []v1alpha1.HelmReleaseConflict
+	}{
+		"GivenNoTemplate_ThenExpectNoConflicts": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+					{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+				},
+			},
+		},
+		"GivenSingleMatchingRelease_ThenExpectNoConflicts": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+					{Chart: v1alpha1.ChartMeta{Version: "^12"}},
+				},
+			},
+		},
+		"GivenExactVersionAndConstraint_ThenExpectNoConflicts": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{Chart: v1alpha1.ChartMeta{Version: "^11"}},
+					{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+				},
+			},
+		},
+		"GivenMultipleConstraintsMatch_ThenExpectConflict": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{Chart: v1alpha1.ChartMeta{Version: "11.1.2"}},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{Chart: v1alpha1.ChartMeta{Version: "^11"}},
+					{Chart: v1alpha1.ChartMeta{Version: ">=11.1 <12"}},
+					{Chart: v1alpha1.ChartMeta{Version: "~11.1"}},
+				},
+			},
+			expectedConflicts: []v1alpha1.HelmReleaseConflict{
+				{Version: "11.1.2", Selected: "^11", Ignored: []string{">=11.1 <12", "~11.1"}},
+			},
+		},
+		"GivenDuplicateExactVersions_ThenExpectConflict": {
+			givenSpec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{Chart: v1alpha1.ChartMeta{Version: "version"}},
+				HelmReleases: []v1alpha1.HelmReleaseConfig{
+					{Chart: v1alpha1.ChartMeta{Version: "version"}},
+					{Chart: v1alpha1.ChartMeta{Version: "version"}},
+				},
+			},
+			expectedConflicts: []v1alpha1.HelmReleaseConflict{
+				{Version: "version", Selected: "version", Ignored: []string{"version"}},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := getHelmReleaseConflicts(&v1alpha1.PostgresqlStandaloneOperatorConfig{Spec: tc.givenSpec})
+			assert.Equal(t, tc.expectedConflicts, result)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package steps
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+)
+
+// getPlan returns the v1alpha1.Plan that the instance references, or nil if the instance doesn't reference a plan.
+// It returns an error if the plan isn't defined in the config.
+func getPlan(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) (*v1alpha1.Plan, error) {
+	name := instance.Spec.Parameters.Plan
+	if name == "" {
+		return nil, nil
+	}
+	plan := config.Spec.GetPlan(name)
+	if plan == nil {
+		return nil, fmt.Errorf("plan %q is not defined in %s %s", name, v1alpha1.PostgresqlStandaloneOperatorConfigKind, config.Name)
+	}
+	return plan, nil
+}
+
+// getPlanValues returns the Helm values of the plan that the instance references.
+// The scheduling constraints of the config, overridden by those of the plan, are rendered into the `primary` values.
+// It returns nil if the instance doesn't reference a plan and the config has no scheduling constraints.
+func getPlanValues(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) (helmvalues.V, error) {
+	plan, err := getPlan(config, instance)
+	if err != nil {
+		return nil, err
+	}
+	values := helmvalues.V{}
+	if plan != nil && len(plan.HelmValues.Raw) > 0 {
+		if err := helmvalues.Unmarshal(plan.HelmValues, &values); err != nil {
+			return nil, err
+		}
+	}
+	schedulingValues, err := getSchedulingValues(getScheduling(config, plan))
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil && len(schedulingValues) == 0 {
+		return nil, nil
+	}
+	helmvalues.Merge(helmvalues.V{"primary": schedulingValues}, &values)
+	return values, nil
+}
+
+// getScheduling returns the scheduling constraints of the config, overridden by those of the given plan if it isn't nil.
+func getScheduling(config *v1alpha1.PostgresqlStandaloneOperatorConfig, plan *v1alpha1.Plan) v1alpha1.SchedulingSpec {
+	if plan == nil {
+		return *config.Spec.Scheduling.DeepCopy()
+	}
+	return config.Spec.Scheduling.WithOverrides(plan.Scheduling)
+}
+
+// getSchedulingValues converts the given scheduling constraints to Helm values of the PostgreSQL chart.
+func getSchedulingValues(scheduling v1alpha1.SchedulingSpec) (helmvalues.V, error) {
+	raw, err := json.Marshal(scheduling)
+	if err != nil {
+		return nil, err
+	}
+	values := helmvalues.V{}
+	err = json.Unmarshal(raw, &values)
+	return values, err
+}
+
+// deepCopyValues returns a deep copy of the given values.
+// The values must only contain types that result from unmarshalling JSON.
+func deepCopyValues(values helmvalues.V) helmvalues.V {
+	if values == nil {
+		return nil
+	}
+	copied := make(helmvalues.V, len(values))
+	for key, value := range values {
+		copied[key] = deepCopyValue(value)
+	}
+	return copied
+}
+
+func deepCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return deepCopyValues(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i := range v {
+			copied[i] = deepCopyValue(v[i])
+		}
+		return copied
+	}
+	return value
+}
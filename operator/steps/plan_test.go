@@ -0,0 +1,148 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestGetPlanValues(t *testing.T) {
+	tests := map[string]struct {
+		givenPlan      string
+		expectedValues helmvalues.V
+		expectedError  string
+	}{
+		"GivenNoPlan_ThenExpectNil": {},
+		"GivenUnknownPlan_ThenExpectError": {
+			givenPlan:     "unknown",
+			expectedError: `plan "unknown" is not defined in PostgresqlStandaloneOperatorConfig config`,
+		},
+		"GivenPlan_ThenExpectHelmValuesAndScheduling": {
+			givenPlan: "dedicated",
+			expectedValues: helmvalues.V{
+				"image": helmvalues.V{"debug": true},
+				"primary": helmvalues.V{
+					"extendedConfiguration": "max_connections = 200",
+					"nodeSelector":          map[string]interface{}{"appuio.io/node-class": "db"},
+					"tolerations": []interface{}{
+						map[string]interface{}{"key": "db", "operator": "Exists", "effect": "NoSchedule"},
+					},
+					"priorityClassName": "database",
+				},
+			},
+		},
+		"GivenPlanWithoutHelmValues_ThenExpectOnlyScheduling": {
+			givenPlan: "minimal",
+			expectedValues: helmvalues.V{
+				"primary": helmvalues.V{"priorityClassName": "database"},
+			},
+		},
+	}
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config"},
+		Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+			Plans: []v1alpha1.Plan{{
+				Name: "dedicated",
+				Scheduling: v1alpha1.SchedulingSpec{
+					NodeSelector:      map[string]string{"appuio.io/node-class": "db"},
+					Tolerations:       []corev1.Toleration{{Key: "db", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+					PriorityClassName: "database",
+				},
+				HelmValues: runtime.RawExtension{Raw: []byte(`{"image":{"debug":true},"primary":{"extendedConfiguration":"max_connections = 200"}}`)},
+			}, {
+				Name:       "minimal",
+				Scheduling: v1alpha1.SchedulingSpec{PriorityClassName: "database"},
+			}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Spec.Parameters.Plan = tc.givenPlan
+
+			values, err := getPlanValues(config, instance)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedValues, values)
+		})
+	}
+}
+
+func TestGetPlanValues_WithConfigScheduling(t *testing.T) {
+	tests := map[string]struct {
+		givenPlan      string
+		expectedValues helmvalues.V
+	}{
+		"GivenNoPlan_ThenExpectSchedulingOfConfig": {
+			expectedValues: helmvalues.V{
+				"primary": helmvalues.V{
+					"nodeSelector":      map[string]interface{}{"appuio.io/node-class": "db"},
+					"priorityClassName": "database",
+				},
+			},
+		},
+		"GivenPlan_ThenExpectSchedulingOfConfigOverriddenByPlan": {
+			givenPlan: "zonal",
+			expectedValues: helmvalues.V{
+				"primary": helmvalues.V{
+					"nodeSelector":      map[string]interface{}{"appuio.io/node-class": "db"},
+					"priorityClassName": "critical-database",
+					"topologySpreadConstraints": []interface{}{
+						map[string]interface{}{"maxSkew": float64(1), "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "ScheduleAnyway"},
+					},
+				},
+			},
+		},
+	}
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config"},
+		Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+			Scheduling: v1alpha1.SchedulingSpec{
+				NodeSelector:      map[string]string{"appuio.io/node-class": "db"},
+				PriorityClassName: "database",
+			},
+			Plans: []v1alpha1.Plan{{
+				Name: "zonal",
+				Scheduling: v1alpha1.SchedulingSpec{
+					TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway}},
+					PriorityClassName:         "critical-database",
+				},
+			}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Spec.Parameters.Plan = tc.givenPlan
+
+			values, err := getPlanValues(config, instance)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedValues, values)
+		})
+	}
+}
+
+func TestApplyValuesFromInstance_WithPlanValues(t *testing.T) {
+	instance := newInstance("instance", "my-app")
+	planValues := helmvalues.V{
+		"fullnameOverride": "overridden",
+		"primary": helmvalues.V{
+			"priorityClassName": "database",
+		},
+	}
+
+	result := applyValuesFromInstance(instance, &configValues{values: planValues}, helmvalues.V{})
+
+	assert.Equal(t, "postgresql", result["fullnameOverride"], "values from instance take precedence")
+	assert.Equal(t, "database", result["primary"].(helmvalues.V)["priorityClassName"])
+	assert.Equal(t, helmvalues.V{"priorityClassName": "database"}, planValues["primary"], "plan values must not be modified")
+}
@@ -2,35 +2,114 @@ package steps
 
 import (
 	"context"
+	"fmt"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/pointer"
+	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 // EnsurePvcFn ensures that the PVC is created.
+// New PVCs get the storage class of the instance, see getStorageClassName.
+// The storage class of the PVC is recorded in the status of the instance, which is persisted by the next step that updates the status.
+// Instances deployed with v1alpha1.StrategyCloudNativePG are skipped, since CloudNativePG provisions its own volumes.
 func EnsurePvcFn(labelSet labels.Set) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
 		instance := GetInstanceFromContext(ctx)
 		config := GetConfigFromContext(ctx)
+		if instance.Status.DeploymentStrategy == v1alpha1.StrategyCloudNativePG {
+			return nil
+		}
 		deploymentNamespace := getFromContextOrPanic(ctx, DeploymentNamespaceKey{}).(*corev1.Namespace)
 
 		persistentVolumeClaim := newPVC(deploymentNamespace.Name)
+		persistentVolumeClaim.Name = getInstancePVCName(instance)
 		persistentVolumeClaim.Spec.AccessModes = config.Spec.Persistence.AccessModes
-		persistentVolumeClaim.Spec.StorageClassName = config.Spec.Persistence.StorageClassName
+		persistentVolumeClaim.Spec.StorageClassName = getStorageClassName(config, instance)
 
 		_, err := controllerutil.CreateOrUpdate(ctx, kube, persistentVolumeClaim, func() error {
+			propagateMetadata(ctx, persistentVolumeClaim)
 			persistentVolumeClaim.Labels = labels.Merge(persistentVolumeClaim.Labels, labelSet)
 			persistentVolumeClaim.Spec.Resources.Requests[corev1.ResourceStorage] = *instance.Spec.Parameters.Resources.StorageCapacity
 			return nil
 		})
-		return err
+		if err != nil {
+			return err
+		}
+		pipeline.StoreInContext(ctx, PersistentVolumeClaimKey{}, persistentVolumeClaim)
+		observePVC(instance, persistentVolumeClaim)
+		return nil
+	}
+}
+
+// observePVC sets the observed name, storage class, capacity and resize phase of the given PVC in the status of the instance.
+func observePVC(instance *v1alpha1.PostgresqlStandalone, pvc *corev1.PersistentVolumeClaim) {
+	instance.Status.PersistentVolumeClaimName = pvc.Name
+	if instance.Status.StorageClassName == "" {
+		instance.Status.StorageClassName = pointer.StringDeref(pvc.Spec.StorageClassName, "")
+	}
+	instance.Status.StorageCapacity = nil
+	if capacity, exists := pvc.Status.Capacity[corev1.ResourceStorage]; exists {
+		instance.Status.StorageCapacity = &capacity
+	}
+	instance.Status.StorageResizePhase = ""
+	if condition := getPVCCondition(pvc, corev1.PersistentVolumeClaimFileSystemResizePending); condition != nil {
+		instance.Status.StorageResizePhase = v1alpha1.StorageResizePhaseFileSystemResizePending
+	} else if getPVCCondition(pvc, corev1.PersistentVolumeClaimResizing) != nil {
+		instance.Status.StorageResizePhase = v1alpha1.StorageResizePhaseResizing
 	}
 }
 
+// RestartPrimaryForFileSystemResizeFn returns a func that deletes the primary pod if the PVC waits for the file system to be expanded.
+// Storage providers that only support offline expansion resize the file system when the volume is mounted again.
+// The pod is only deleted if it has been created before the PVC started waiting, so that it's restarted only once.
+// Instances deployed with v1alpha1.StrategyCloudNativePG are skipped, since CloudNativePG manages its own volumes.
+func RestartPrimaryForFileSystemResizeFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		kube := GetClientFromContext(ctx)
+		instance := GetInstanceFromContext(ctx)
+		pvc := getFromContextOrPanic(ctx, PersistentVolumeClaimKey{}).(*corev1.PersistentVolumeClaim)
+
+		condition := getPVCCondition(pvc, corev1.PersistentVolumeClaimFileSystemResizePending)
+		if condition == nil || instance.Status.DeploymentStrategy == v1alpha1.StrategyCloudNativePG {
+			return nil
+		}
+		pod := &corev1.Pod{}
+		err := kube.Get(ctx, client.ObjectKey{Name: getPrimaryPodName(), Namespace: pvc.Namespace}, pod)
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !pod.CreationTimestamp.Before(&condition.LastTransitionTime) || !pod.DeletionTimestamp.IsZero() {
+			return nil
+		}
+		log := controllerruntime.LoggerFrom(ctx)
+		log.Info("Restarting PostgreSQL to expand the file system", "pod", pod.Name)
+		return client.IgnoreNotFound(kube.Delete(ctx, pod))
+	}
+}
+
+func getPVCCondition(pvc *corev1.PersistentVolumeClaim, conditionType corev1.PersistentVolumeClaimConditionType) *corev1.PersistentVolumeClaimCondition {
+	for i, condition := range pvc.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return &pvc.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// getPrimaryPodName returns the name of the pod that runs PostgreSQL, which is the first pod of the StatefulSet of the Helm chart or the StatefulSetStrategy.
+func getPrimaryPodName() string {
+	return fmt.Sprintf("%s-0", getDeploymentName())
+}
+
 // DeletePvcFn deletes the corev1.PersistentVolumeClaim from the deployment namespace.
 // Ignore "not found" error and returns nil if deployment namespace is unknown.
 func DeletePvcFn() func(ctx context.Context) error {
@@ -38,17 +117,35 @@ func DeletePvcFn() func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
 		instance := GetInstanceFromContext(ctx)
 
-		if instance.Status.HelmChart == nil || instance.Status.HelmChart.DeploymentNamespace == "" {
+		if instance.Status.GetDeploymentNamespace() == "" {
 			// instance might have never been properly deployed
 			return nil
 		}
 
-		pvc := newPVC(instance.Status.HelmChart.DeploymentNamespace)
+		pvc := newPVC(instance.Status.GetDeploymentNamespace())
+		pvc.Name = getInstancePVCName(instance)
 		err := kube.Delete(ctx, pvc)
 		return client.IgnoreNotFound(err)
 	}
 }
 
+// getInstancePVCName returns the name of the PVC that contains the data of the instance.
+// Instances whose storage class has never been migrated use the PVC with the name of getPVCName.
+func getInstancePVCName(instance *v1alpha1.PostgresqlStandalone) string {
+	if name := instance.Status.PersistentVolumeClaimName; name != "" {
+		return name
+	}
+	return getPVCName()
+}
+
+// getStorageClassName returns the storage class of the instance, or the default storage class of the config if the instance doesn't specify one.
+func getStorageClassName(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) *string {
+	if name := instance.Spec.Parameters.Resources.StorageClassName; name != "" {
+		return &name
+	}
+	return config.Spec.Persistence.StorageClassName
+}
+
 func newPVC(ns string) *corev1.PersistentVolumeClaim {
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
@@ -6,15 +6,19 @@ import (
 	"context"
 	pipeline "github.com/ccremer/go-command-pipeline"
 	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"testing"
+	"time"
 )
 
 type PvcSuite struct {
@@ -37,6 +41,7 @@ func (ts *PvcSuite) Test_EnsurePvcFn() {
 		givenNamespace         string
 		configuredAccessModes  []corev1.PersistentVolumeAccessMode
 		configuredStorageClass *string
+		givenStorageClass      string
 		givenStorageSize       *resource.Quantity
 		expectedAccessModes    []corev1.PersistentVolumeAccessMode
 		expectedStorageClass   *string
@@ -52,6 +57,17 @@ func (ts *PvcSuite) Test_EnsurePvcFn() {
 			expectedStorageClass:   pointer.String("my-class"),
 			expectedStorageSize:    *parseResource("1Gi"),
 		},
+		"GivenNewPvc_WhenInstanceSpecifiesStorageClass_ThenCreateWithStorageClassOfInstance": {
+			prepare:                func() {},
+			givenNamespace:         "new-pvc-instance-class",
+			configuredAccessModes:  []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			configuredStorageClass: pointer.String("my-class"),
+			givenStorageClass:      "fast-class",
+			givenStorageSize:       parseResource("1Gi"),
+			expectedAccessModes:    []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			expectedStorageClass:   pointer.String("fast-class"),
+			expectedStorageSize:    *parseResource("1Gi"),
+		},
 		"GivenExistingPvc_WhenUpdating_ThenIgnoreStorageClassAndAccessModes": {
 			prepare: func() {
 				existingPvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: getPVCName(), Namespace: "existing-pvc"},
@@ -96,6 +112,7 @@ func (ts *PvcSuite) Test_EnsurePvcFn() {
 
 			instance := NewInstanceBuilder("instance", "pvc-test").setDeploymentNamespace(tc.givenNamespace).getInstance()
 			instance.Spec.Parameters.Resources.StorageCapacity = tc.givenStorageSize
+			instance.Spec.Parameters.Resources.StorageClassName = tc.givenStorageClass
 			SetInstanceInContext(ts.Context, instance)
 			ts.EnsureNS(tc.givenNamespace)
 			tc.prepare()
@@ -112,6 +129,81 @@ func (ts *PvcSuite) Test_EnsurePvcFn() {
 			ts.Assert().Equal(*tc.expectedStorageClass, *result.Spec.StorageClassName, "storage class")
 			ts.Assert().True(result.Spec.Resources.Requests.Storage().Equal(tc.expectedStorageSize), "storage size")
 			ts.Assert().Equal("label", result.Labels["test"], "label")
+			ts.Assert().Equal(getPVCName(), instance.Status.PersistentVolumeClaimName, "observed claim name")
+			ts.Assert().Equal(*tc.expectedStorageClass, instance.Status.StorageClassName, "observed storage class")
+		})
+	}
+}
+
+func (ts *PvcSuite) Test_EnsurePvcFn_GivenCloudNativePG_ThenExpectNoPvc() {
+	// Arrange
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cnpg-pvc"}})
+
+	instance := NewInstanceBuilder("instance", "pvc-test").setDeploymentNamespace("cnpg-pvc").getInstance()
+	instance.Status.DeploymentStrategy = v1alpha1.StrategyCloudNativePG
+	SetInstanceInContext(ts.Context, instance)
+	ts.EnsureNS("cnpg-pvc")
+
+	// Act
+	err := EnsurePvcFn(labels.Set{"test": "label"})(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	err = ts.Client.Get(ts.Context, types.NamespacedName{Name: getPVCName(), Namespace: "cnpg-pvc"}, &corev1.PersistentVolumeClaim{})
+	ts.Assert().True(apierrors.IsNotFound(err), "PVC not found")
+	ts.Assert().Empty(instance.Status.PersistentVolumeClaimName, "observed claim name")
+}
+
+func (ts *PvcSuite) Test_RestartPrimaryForFileSystemResizeFn() {
+	tests := map[string]struct {
+		givenPodAge         time.Duration
+		givenConditionAge   time.Duration
+		expectedPodDeletion bool
+	}{
+		"GivenPodOlderThanResizePending_ThenDeletePod": {
+			givenPodAge:         time.Hour,
+			givenConditionAge:   time.Minute,
+			expectedPodDeletion: true,
+		},
+		"GivenPodNewerThanResizePending_ThenKeepPod": {
+			givenPodAge:       time.Minute,
+			givenConditionAge: time.Hour,
+		},
+	}
+	for name, tc := range tests {
+		ts.Run(name, func() {
+			// Arrange
+			ns := ts.SanitizeNameForNS(name)
+			ts.EnsureNS(ns)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: getPrimaryPodName(), Namespace: ns},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "postgresql", Image: "postgresql"}}},
+			}
+			ts.EnsureResources(pod)
+			// The API server sets the creation timestamp, so the condition is moved relative to it.
+			transitionTime := metav1.NewTime(pod.CreationTimestamp.Add(tc.givenPodAge - tc.givenConditionAge))
+			pvc := newPVC(ns)
+			pvc.Status.Conditions = []corev1.PersistentVolumeClaimCondition{
+				{Type: corev1.PersistentVolumeClaimFileSystemResizePending, Status: corev1.ConditionTrue, LastTransitionTime: transitionTime},
+			}
+			pipeline.StoreInContext(ts.Context, PersistentVolumeClaimKey{}, pvc)
+			SetInstanceInContext(ts.Context, newInstance("instance", "pvc-test"))
+
+			// Act
+			err := RestartPrimaryForFileSystemResizeFn()(ts.Context)
+			ts.Require().NoError(err)
+
+			// Assert
+			result := &corev1.Pod{}
+			err = ts.Client.Get(ts.Context, client.ObjectKeyFromObject(pod), result)
+			if tc.expectedPodDeletion {
+				AssertResourceNotExists(ts.T(), result.DeletionTimestamp, err)
+				return
+			}
+			ts.Require().NoError(err)
+			ts.Assert().True(result.DeletionTimestamp.IsZero(), "deletion timestamp")
 		})
 	}
 }
@@ -0,0 +1,59 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/pointer"
+)
+
+func TestObservePVC(t *testing.T) {
+	tests := map[string]struct {
+		givenStatus           corev1.PersistentVolumeClaimStatus
+		expectedCapacity      *resource.Quantity
+		expectedResizingPhase v1alpha1.StorageResizePhase
+	}{
+		"GivenPendingPVC_ThenExpectNoCapacity": {},
+		"GivenBoundPVC_ThenExpectCapacity": {
+			givenStatus:      corev1.PersistentVolumeClaimStatus{Capacity: corev1.ResourceList{corev1.ResourceStorage: *parseResource("1Gi")}},
+			expectedCapacity: parseResource("1Gi"),
+		},
+		"GivenResizingPVC_ThenExpectResizingPhase": {
+			givenStatus: corev1.PersistentVolumeClaimStatus{
+				Capacity:   corev1.ResourceList{corev1.ResourceStorage: *parseResource("1Gi")},
+				Conditions: []corev1.PersistentVolumeClaimCondition{{Type: corev1.PersistentVolumeClaimResizing, Status: corev1.ConditionTrue}},
+			},
+			expectedCapacity:      parseResource("1Gi"),
+			expectedResizingPhase: v1alpha1.StorageResizePhaseResizing,
+		},
+		"GivenPVC_WhenFileSystemResizePending_ThenExpectFileSystemResizePendingPhase": {
+			givenStatus: corev1.PersistentVolumeClaimStatus{
+				Capacity: corev1.ResourceList{corev1.ResourceStorage: *parseResource("1Gi")},
+				Conditions: []corev1.PersistentVolumeClaimCondition{
+					{Type: corev1.PersistentVolumeClaimResizing, Status: corev1.ConditionFalse},
+					{Type: corev1.PersistentVolumeClaimFileSystemResizePending, Status: corev1.ConditionTrue},
+				},
+			},
+			expectedCapacity:      parseResource("1Gi"),
+			expectedResizingPhase: v1alpha1.StorageResizePhaseFileSystemResizePending,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Status.StorageResizePhase = v1alpha1.StorageResizePhaseResizing
+			pvc := newPVC("namespace")
+			pvc.Spec.StorageClassName = pointer.String("standard")
+			pvc.Status = tc.givenStatus
+
+			observePVC(instance, pvc)
+
+			assert.Equal(t, tc.expectedCapacity, instance.Status.StorageCapacity, "capacity")
+			assert.Equal(t, tc.expectedResizingPhase, instance.Status.StorageResizePhase, "resize phase")
+			assert.Equal(t, "standard", instance.Status.StorageClassName, "storage class")
+		})
+	}
+}
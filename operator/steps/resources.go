@@ -0,0 +1,78 @@
+package steps
+
+import (
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// getComputeResources returns the CPU and memory requirements of the instance.
+// A missing request or limit is derived from the other one with the v1alpha1.ResourceRatio of the config.
+func getComputeResources(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) corev1.ResourceRequirements {
+	resources := instance.Spec.Parameters.Resources
+	ratio := config.Spec.ResourceRatio
+	requirements := corev1.ResourceRequirements{Limits: corev1.ResourceList{}, Requests: corev1.ResourceList{}}
+	setRequestAndLimit(requirements, corev1.ResourceCPU, resources.CPURequest, resources.CPULimit, ratio.CPURequestPercentage)
+	setRequestAndLimit(requirements, corev1.ResourceMemory, resources.MemoryRequest, resources.MemoryLimit, ratio.MemoryRequestPercentage)
+	return requirements
+}
+
+// GetDerivedResources returns the resources of the instance including the CPU and memory requirements that are derived
+// with the v1alpha1.ResourceRatio of the config, see getComputeResources.
+func GetDerivedResources(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) *v1alpha1.Resources {
+	resources := instance.Spec.Parameters.Resources.DeepCopy()
+	requirements := getComputeResources(config, instance)
+	get := func(list corev1.ResourceList, name corev1.ResourceName) *resource.Quantity {
+		if quantity, exists := list[name]; exists {
+			return &quantity
+		}
+		return nil
+	}
+	resources.CPURequest, resources.CPULimit = get(requirements.Requests, corev1.ResourceCPU), get(requirements.Limits, corev1.ResourceCPU)
+	resources.MemoryRequest, resources.MemoryLimit = get(requirements.Requests, corev1.ResourceMemory), get(requirements.Limits, corev1.ResourceMemory)
+	return resources
+}
+
+// setRequestAndLimit sets the given request and limit in the requirements.
+// If only one of them is given, the other one is derived with the given percentage, unless the percentage is 0.
+func setRequestAndLimit(requirements corev1.ResourceRequirements, name corev1.ResourceName, request, limit *resource.Quantity, percentage int64) {
+	switch {
+	case request == nil && limit != nil && percentage > 0:
+		request = scaleQuantity(name, limit, percentage, 100)
+	case limit == nil && request != nil && percentage > 0:
+		limit = scaleQuantity(name, request, 100, percentage)
+	}
+	if request != nil {
+		requirements.Requests[name] = *request
+	}
+	if limit != nil {
+		requirements.Limits[name] = *limit
+	}
+}
+
+// scaleQuantity returns the given quantity multiplied by numerator/denominator.
+// CPU is rounded down to millicores and everything else to whole units.
+func scaleQuantity(name corev1.ResourceName, quantity *resource.Quantity, numerator, denominator int64) *resource.Quantity {
+	if name == corev1.ResourceCPU {
+		return resource.NewMilliQuantity(quantity.MilliValue()*numerator/denominator, quantity.Format)
+	}
+	return resource.NewQuantity(quantity.Value()*numerator/denominator, quantity.Format)
+}
+
+// getResourceValues converts the given requirements to the `resources` Helm values of the PostgreSQL chart.
+// Empty requests or limits are omitted, so that they don't replace the values of the chart.
+func getResourceValues(requirements corev1.ResourceRequirements) helmvalues.V {
+	values := helmvalues.V{}
+	for key, list := range map[string]corev1.ResourceList{"limits": requirements.Limits, "requests": requirements.Requests} {
+		if len(list) == 0 {
+			continue
+		}
+		quantities := helmvalues.V{}
+		for name, quantity := range list {
+			quantities[string(name)] = quantity.String()
+		}
+		values[key] = quantities
+	}
+	return values
+}
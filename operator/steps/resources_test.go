@@ -0,0 +1,68 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/helmvalues"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGetComputeResources(t *testing.T) {
+	tests := map[string]struct {
+		givenResources v1alpha1.ComputeResources
+		givenRatio     v1alpha1.ResourceRatio
+		expectedValues helmvalues.V
+	}{
+		"GivenNoResources_ThenExpectNoValues": {
+			expectedValues: helmvalues.V{},
+		},
+		"GivenOnlyLimits_WhenNoRatio_ThenExpectOnlyLimits": {
+			givenResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi"), CPULimit: parseResource("1")},
+			expectedValues: helmvalues.V{
+				"limits": helmvalues.V{"memory": "1Gi", "cpu": "1"},
+			},
+		},
+		"GivenOnlyLimits_WhenRatio_ThenExpectDerivedRequests": {
+			givenResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi"), CPULimit: parseResource("1")},
+			givenRatio:     v1alpha1.ResourceRatio{CPURequestPercentage: 25, MemoryRequestPercentage: 50},
+			expectedValues: helmvalues.V{
+				"limits":   helmvalues.V{"memory": "1Gi", "cpu": "1"},
+				"requests": helmvalues.V{"memory": "512Mi", "cpu": "250m"},
+			},
+		},
+		"GivenOnlyRequests_WhenRatio_ThenExpectDerivedLimits": {
+			givenResources: v1alpha1.ComputeResources{MemoryRequest: parseResource("512Mi"), CPURequest: parseResource("250m")},
+			givenRatio:     v1alpha1.ResourceRatio{CPURequestPercentage: 25, MemoryRequestPercentage: 50},
+			expectedValues: helmvalues.V{
+				"limits":   helmvalues.V{"memory": "1Gi", "cpu": "1"},
+				"requests": helmvalues.V{"memory": "512Mi", "cpu": "250m"},
+			},
+		},
+		"GivenRequestsAndLimits_WhenRatio_ThenExpectValuesFromInstance": {
+			givenResources: v1alpha1.ComputeResources{MemoryRequest: parseResource("1Gi"), MemoryLimit: parseResource("1Gi"), CPURequest: parseResource("100m"), CPULimit: parseResource("2")},
+			givenRatio:     v1alpha1.ResourceRatio{CPURequestPercentage: 25, MemoryRequestPercentage: 50},
+			expectedValues: helmvalues.V{
+				"limits":   helmvalues.V{"memory": "1Gi", "cpu": "2"},
+				"requests": helmvalues.V{"memory": "1Gi", "cpu": "100m"},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := &v1alpha1.PostgresqlStandalone{}
+			instance.Spec.Parameters.Resources.ComputeResources = tc.givenResources
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.ResourceRatio = tc.givenRatio
+
+			result := getComputeResources(config, instance)
+			assert.Equal(t, tc.expectedValues, getResourceValues(result))
+		})
+	}
+}
+
+func TestScaleQuantity(t *testing.T) {
+	assert.Equal(t, "333m", scaleQuantity(corev1.ResourceCPU, parseResource("1"), 1, 3).String())
+	assert.Equal(t, "357913941", scaleQuantity(corev1.ResourceMemory, parseResource("1Gi"), 1, 3).String())
+}
@@ -0,0 +1,298 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RolloutChartVersionAnnotationKey is the annotation key of an instance that contains the chart version that the instance should be upgraded to.
+// It is set by the rollout of a v1alpha1.PostgresqlStandaloneOperatorConfig.
+var RolloutChartVersionAnnotationKey = fmt.Sprintf("%s/rollout-chart-version", v1alpha1.Group)
+
+// defaultProgressDeadline is used if the v1alpha1.RolloutSpec doesn't specify a ProgressDeadline.
+const defaultProgressDeadline = 10 * time.Minute
+
+// rolloutPollInterval is how often a progressing rollout is observed.
+const rolloutPollInterval = 30 * time.Second
+
+// ReconcileRolloutFn returns a func that upgrades the instances of the v1alpha1.PostgresqlStandaloneOperatorConfig in the context in batches.
+// Instances are upgraded by setting the RolloutChartVersionAnnotationKey annotation, which is honored by EnsureHelmReleaseFn.
+// Only instances that are already deployed, aren't pinned to a chart version, aren't hibernated and have the same major version as the config are part of the rollout.
+// The progress is observed in the status of the config, but the status is not updated.
+func ReconcileRolloutFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		kube := GetClientFromContext(ctx)
+		config := GetConfigFromContext(ctx)
+
+		if config.Spec.Rollout == nil || config.Spec.HelmReleaseTemplate == nil || config.Spec.HelmReleaseTemplate.Chart.Version == "" {
+			config.Status.Rollout = nil
+			return nil
+		}
+		instances, err := listDeployedInstances(ctx, kube, config)
+		if err != nil {
+			return err
+		}
+		version := config.Spec.HelmReleaseTemplate.Chart.Version
+		status, upgrades := planRollout(config.Spec.Rollout, config.Status.Rollout, version, instances, time.Now())
+		config.Status.Rollout = status
+		for _, instance := range upgrades {
+			patch := client.MergeFrom(instance.DeepCopy())
+			metav1.SetMetaDataAnnotation(&instance.ObjectMeta, RolloutChartVersionAnnotationKey, version)
+			if err := kube.Patch(ctx, instance, patch); err != nil {
+				return fmt.Errorf("cannot upgrade instance %s/%s: %w", instance.Namespace, instance.Name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// RolloutRequeueAfter returns the duration after which the rollout of the given config has to be observed again.
+// Changes of instances are observed anyway, but passing the pause between batches and the progress deadline isn't.
+// A progressing rollout is polled with the rolloutPollInterval, the progress deadline is only the cutoff for failed instances.
+// It returns 0 if the rollout doesn't have to be observed again.
+func RolloutRequeueAfter(config *v1alpha1.PostgresqlStandaloneOperatorConfig, now time.Time) time.Duration {
+	spec, status := config.Spec.Rollout, config.Status.Rollout
+	if spec == nil || status == nil {
+		return 0
+	}
+	switch status.Phase {
+	case v1alpha1.RolloutPhasePaused:
+		if status.BatchCompletedAt == nil {
+			return 0
+		}
+		return status.BatchCompletedAt.Add(spec.PauseBetweenBatches.Duration).Sub(now)
+	case v1alpha1.RolloutPhaseProgressing:
+		if deadline := getProgressDeadline(spec); deadline < rolloutPollInterval {
+			return deadline
+		}
+		return rolloutPollInterval
+	}
+	return 0
+}
+
+// listDeployedInstances returns the instances that are part of the rollout of the given config.
+// The lookup requires the InstanceMajorVersionIndex field index in the client's cache.
+func listDeployedInstances(ctx context.Context, kube client.Client, config *v1alpha1.PostgresqlStandaloneOperatorConfig) ([]v1alpha1.PostgresqlStandalone, error) {
+	list := &v1alpha1.PostgresqlStandaloneList{}
+	majorVersion := config.Labels[v1alpha1.PostgresqlMajorVersionLabelKey]
+	if err := kube.List(ctx, list, client.MatchingFields{InstanceMajorVersionIndex: majorVersion}); err != nil {
+		return nil, err
+	}
+	instances := make([]v1alpha1.PostgresqlStandalone, 0, len(list.Items))
+	for _, instance := range list.Items {
+		if !instance.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if instance.Status.HelmChart == nil || instance.Status.HelmChart.Version == "" {
+			// Not deployed yet, new instances are deployed with the chart version of the template anyway.
+			continue
+		}
+		if instance.GetPinnedChartVersion() != "" || isReleaseUpdateSkipped(&instance) {
+			// Hibernated instances can't be upgraded until they are resumed, a later rollout upgrades them.
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// planRollout observes the progress of rolling out the given chart version to the given instances.
+// It returns the new status of the rollout and the instances that need to be upgraded.
+// Batches are advanced until a batch is still in progress, has to wait for the pause between batches, or the rollout is completed.
+// A batch is done once all of its instances are either upgraded or failed.
+// Instances that haven't picked up the new chart version within the progress deadline after the batch started count as failed,
+// and failed instances stay failed until they are upgraded, so that they don't block later batches.
+// The rollout stops once MaxFailures instances have failed to upgrade.
+func planRollout(spec *v1alpha1.RolloutSpec, previous *v1alpha1.RolloutStatus, version string, instances []v1alpha1.PostgresqlStandalone, now time.Time) (*v1alpha1.RolloutStatus, []*v1alpha1.PostgresqlStandalone) {
+	status := &v1alpha1.RolloutStatus{Version: version}
+	if previous != nil && previous.Version == version {
+		status = previous.DeepCopy()
+	}
+	if status.Phase == v1alpha1.RolloutPhaseFailed {
+		return status, nil
+	}
+
+	ordered, canaries := sortInstancesForRollout(spec.CanarySelector, instances)
+	targets := getBatchTargets(canaries, len(ordered), spec.BatchPercentages)
+	status.Total = len(ordered)
+	status.Batches = len(targets)
+	if status.CurrentBatch >= len(targets) {
+		status.CurrentBatch = len(targets) - 1
+	}
+
+	previouslyFailed := sets.NewString(status.FailedInstances...)
+	stateOf := func(instance *v1alpha1.PostgresqlStandalone) rolloutState {
+		state := getRolloutState(spec, instance, version, status.BatchStartedAt, now)
+		if state != rolloutStateUpgraded && previouslyFailed.Has(getRolloutInstanceName(instance)) {
+			return rolloutStateFailed
+		}
+		return state
+	}
+	status.Upgraded = 0
+	status.FailedInstances = nil
+	for i := range ordered {
+		switch stateOf(&ordered[i]) {
+		case rolloutStateUpgraded:
+			status.Upgraded++
+		case rolloutStateFailed:
+			status.FailedInstances = append(status.FailedInstances, getRolloutInstanceName(&ordered[i]))
+		}
+	}
+	maxFailures := spec.MaxFailures
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	if len(status.FailedInstances) >= maxFailures {
+		status.Phase = v1alpha1.RolloutPhaseFailed
+		return status, nil
+	}
+
+	for {
+		upgrades := make([]*v1alpha1.PostgresqlStandalone, 0)
+		batchDone := true
+		for i := 0; i < targets[status.CurrentBatch]; i++ {
+			state := stateOf(&ordered[i])
+			if state == rolloutStatePending || state == rolloutStateUpgrading {
+				batchDone = false
+			}
+			if state == rolloutStatePending {
+				upgrades = append(upgrades, &ordered[i])
+			}
+		}
+		if !batchDone {
+			status.Phase = v1alpha1.RolloutPhaseProgressing
+			status.BatchCompletedAt = nil
+			if status.BatchStartedAt == nil {
+				status.BatchStartedAt = &metav1.Time{Time: now}
+			}
+			return status, upgrades
+		}
+		if status.CurrentBatch == len(targets)-1 {
+			status.Phase = v1alpha1.RolloutPhaseCompleted
+			return status, nil
+		}
+		if status.BatchCompletedAt == nil {
+			status.BatchCompletedAt = &metav1.Time{Time: now}
+		}
+		if now.Before(status.BatchCompletedAt.Add(spec.PauseBetweenBatches.Duration)) {
+			status.Phase = v1alpha1.RolloutPhasePaused
+			return status, nil
+		}
+		status.CurrentBatch++
+		status.BatchStartedAt = nil
+		status.BatchCompletedAt = nil
+	}
+}
+
+// sortInstancesForRollout returns the instances in the order they are upgraded and the number of canary instances.
+// Canary instances come first, otherwise the instances are sorted by namespace and name.
+func sortInstancesForRollout(canarySelector *metav1.LabelSelector, instances []v1alpha1.PostgresqlStandalone) ([]v1alpha1.PostgresqlStandalone, int) {
+	selector := labels.Nothing()
+	if canarySelector != nil {
+		if s, err := metav1.LabelSelectorAsSelector(canarySelector); err == nil {
+			selector = s
+		}
+	}
+	ordered := make([]v1alpha1.PostgresqlStandalone, len(instances))
+	copy(ordered, instances)
+	isCanary := func(i int) bool {
+		return selector.Matches(labels.Set(ordered[i].Labels))
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if isCanary(i) != isCanary(j) {
+			return isCanary(i)
+		}
+		if ordered[i].Namespace != ordered[j].Namespace {
+			return ordered[i].Namespace < ordered[j].Namespace
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+	canaries := 0
+	for i := range ordered {
+		if isCanary(i) {
+			canaries++
+		}
+	}
+	return ordered, canaries
+}
+
+// getBatchTargets returns the cumulative number of instances that are upgraded after each batch.
+// If there are canaries, they are the first batch.
+// The last batch always includes all instances.
+func getBatchTargets(canaries, total int, percentages []int) []int {
+	targets := make([]int, 0, len(percentages)+1)
+	previous := 0
+	if canaries > 0 {
+		targets = append(targets, canaries)
+		previous = canaries
+	}
+	for _, percentage := range percentages {
+		target := int(math.Ceil(float64(percentage) * float64(total) / 100))
+		if target > total {
+			target = total
+		}
+		if target > previous {
+			targets = append(targets, target)
+			previous = target
+		}
+	}
+	if previous < total || len(targets) == 0 {
+		targets = append(targets, total)
+	}
+	return targets
+}
+
+type rolloutState int
+
+const (
+	// rolloutStatePending means that the instance still has to be told to upgrade.
+	rolloutStatePending rolloutState = iota
+	// rolloutStateUpgrading means that the instance is upgrading and its release isn't ready yet.
+	rolloutStateUpgrading
+	// rolloutStateUpgraded means that the release of the instance is ready with the new chart version.
+	rolloutStateUpgraded
+	// rolloutStateFailed means that the instance didn't pick up the new chart version or its release didn't become ready within the progress deadline.
+	rolloutStateFailed
+)
+
+func getRolloutState(spec *v1alpha1.RolloutSpec, instance *v1alpha1.PostgresqlStandalone, version string, batchStartedAt *metav1.Time, now time.Time) rolloutState {
+	if instance.Status.HelmChart.Version != version {
+		if instance.Annotations[RolloutChartVersionAnnotationKey] != version {
+			return rolloutStatePending
+		}
+		if batchStartedAt != nil && now.After(batchStartedAt.Add(getProgressDeadline(spec))) {
+			return rolloutStateFailed
+		}
+		return rolloutStateUpgrading
+	}
+	if meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeReleaseReady) {
+		return rolloutStateUpgraded
+	}
+	if now.After(instance.Status.HelmChart.ModifiedTime.Add(getProgressDeadline(spec))) {
+		return rolloutStateFailed
+	}
+	return rolloutStateUpgrading
+}
+
+// getRolloutInstanceName returns the name of the given instance in the format of v1alpha1.RolloutStatus FailedInstances.
+func getRolloutInstanceName(instance *v1alpha1.PostgresqlStandalone) string {
+	return fmt.Sprintf("%s/%s", instance.Namespace, instance.Name)
+}
+
+func getProgressDeadline(spec *v1alpha1.RolloutSpec) time.Duration {
+	if spec.ProgressDeadline.Duration > 0 {
+		return spec.ProgressDeadline.Duration
+	}
+	return defaultProgressDeadline
+}
@@ -0,0 +1,316 @@
+package steps
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	helmv1beta1 "github.com/crossplane-contrib/provider-helm/apis/release/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetBatchTargets(t *testing.T) {
+	tests := map[string]struct {
+		givenCanaries    int
+		givenTotal       int
+		givenPercentages []int
+		expectedTargets  []int
+	}{
+		"GivenSingleBatch_ThenExpectAllInstances": {
+			givenTotal:       10,
+			givenPercentages: []int{100},
+			expectedTargets:  []int{10},
+		},
+		"GivenPercentages_ThenExpectRoundedUpTargets": {
+			givenTotal:       10,
+			givenPercentages: []int{5, 50, 100},
+			expectedTargets:  []int{1, 5, 10},
+		},
+		"GivenPercentagesBelow100_ThenExpectLastBatchWithAllInstances": {
+			givenTotal:       10,
+			givenPercentages: []int{20, 50},
+			expectedTargets:  []int{2, 5, 10},
+		},
+		"GivenCanaries_ThenExpectCanaryBatchFirst": {
+			givenCanaries:    2,
+			givenTotal:       10,
+			givenPercentages: []int{10, 50, 100},
+			expectedTargets:  []int{2, 5, 10},
+		},
+		"GivenNoInstances_ThenExpectSingleEmptyBatch": {
+			givenPercentages: []int{50, 100},
+			expectedTargets:  []int{0},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := getBatchTargets(tc.givenCanaries, tc.givenTotal, tc.givenPercentages)
+			assert.Equal(t, tc.expectedTargets, result)
+		})
+	}
+}
+
+func TestPlanRollout(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	completedAt := &metav1.Time{Time: now.Add(-1 * time.Minute)}
+	tests := map[string]struct {
+		givenSpec        v1alpha1.RolloutSpec
+		givenStatus      *v1alpha1.RolloutStatus
+		givenInstances   []v1alpha1.PostgresqlStandalone
+		expectedStatus   *v1alpha1.RolloutStatus
+		expectedUpgrades []string
+	}{
+		"GivenNewVersion_ThenExpectFirstBatchUpgraded": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "1.0.0", Phase: v1alpha1.RolloutPhaseCompleted, CurrentBatch: 1},
+			givenInstances: []v1alpha1.PostgresqlStandalone{newRolloutInstance("d", "1.0.0"), newRolloutInstance("c", "1.0.0"), newRolloutInstance("b", "1.0.0"), newRolloutInstance("a", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 0, Batches: 2, Total: 4,
+				BatchStartedAt: &metav1.Time{Time: now},
+			},
+			expectedUpgrades: []string{"a", "b"},
+		},
+		"GivenCanarySelector_ThenExpectCanariesUpgradedFirst": {
+			givenSpec: v1alpha1.RolloutSpec{
+				BatchPercentages: []int{100},
+				CanarySelector:   &metav1.LabelSelector{MatchLabels: map[string]string{"canary": "true"}},
+			},
+			givenInstances: []v1alpha1.PostgresqlStandalone{newRolloutInstance("a", "1.0.0"), withLabels(newRolloutInstance("b", "1.0.0"), map[string]string{"canary": "true"})},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 0, Batches: 2, Total: 2,
+				BatchStartedAt: &metav1.Time{Time: now},
+			},
+			expectedUpgrades: []string{"b"},
+		},
+		"GivenBatchInProgress_ThenExpectNoAdditionalUpgrades": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withUpgrade(newRolloutInstance("a", "1.0.0")), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 0, Batches: 2, Total: 2,
+				BatchStartedAt: &metav1.Time{Time: now},
+			},
+			expectedUpgrades: []string{},
+		},
+		"GivenReleaseNotReadyYet_ThenExpectBatchInProgress": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withReleaseReady(newRolloutInstance("a", "2.0.0"), false, now), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 0, Batches: 2, Total: 2,
+				BatchStartedAt: &metav1.Time{Time: now},
+			},
+			expectedUpgrades: []string{},
+		},
+		"GivenBatchUpgraded_WhenPauseNotPassed_ThenExpectPaused": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, PauseBetweenBatches: metav1.Duration{Duration: time.Hour}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withReleaseReady(newRolloutInstance("a", "2.0.0"), true, now), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhasePaused, CurrentBatch: 0, Batches: 2, Total: 2, Upgraded: 1,
+				BatchCompletedAt: &metav1.Time{Time: now},
+			},
+		},
+		"GivenBatchUpgraded_WhenPausePassed_ThenExpectNextBatchUpgraded": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, PauseBetweenBatches: metav1.Duration{Duration: time.Minute}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhasePaused, BatchCompletedAt: completedAt},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withReleaseReady(newRolloutInstance("a", "2.0.0"), true, now), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 1, Batches: 2, Total: 2, Upgraded: 1,
+				BatchStartedAt: &metav1.Time{Time: now},
+			},
+			expectedUpgrades: []string{"b"},
+		},
+		"GivenAllInstancesUpgraded_ThenExpectCompleted": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 1},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withReleaseReady(newRolloutInstance("a", "2.0.0"), true, now), withReleaseReady(newRolloutInstance("b", "2.0.0"), true, now)},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseCompleted, CurrentBatch: 1, Batches: 2, Total: 2, Upgraded: 2,
+			},
+		},
+		"GivenReleaseNotReadyAfterDeadline_ThenExpectFailed": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, ProgressDeadline: metav1.Duration{Duration: time.Minute}, MaxFailures: 1},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withReleaseReady(newRolloutInstance("a", "2.0.0"), false, now.Add(-2*time.Minute)), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseFailed, CurrentBatch: 0, Batches: 2, Total: 2,
+				FailedInstances: []string{"my-app/a"},
+			},
+		},
+		"GivenFailuresBelowThreshold_ThenExpectNextBatchUpgraded": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, ProgressDeadline: metav1.Duration{Duration: time.Minute}, MaxFailures: 2},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withReleaseReady(newRolloutInstance("a", "2.0.0"), false, now.Add(-2*time.Minute)), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 1, Batches: 2, Total: 2,
+				BatchStartedAt:  &metav1.Time{Time: now},
+				FailedInstances: []string{"my-app/a"},
+			},
+			expectedUpgrades: []string{"b"},
+		},
+		"GivenUpgradeNotPickedUpAfterDeadline_ThenExpectFailed": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, ProgressDeadline: metav1.Duration{Duration: time.Minute}, MaxFailures: 2},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, BatchStartedAt: &metav1.Time{Time: now.Add(-2 * time.Minute)}},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withUpgrade(newRolloutInstance("a", "1.0.0")), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 1, Batches: 2, Total: 2,
+				FailedInstances: []string{"my-app/a"},
+				BatchStartedAt:  &metav1.Time{Time: now},
+			},
+			expectedUpgrades: []string{"b"},
+		},
+		"GivenUpgradeNotPickedUpWithinDeadline_ThenExpectBatchInProgress": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, ProgressDeadline: metav1.Duration{Duration: time.Minute}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, BatchStartedAt: &metav1.Time{Time: now.Add(-30 * time.Second)}},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withUpgrade(newRolloutInstance("a", "1.0.0")), newRolloutInstance("b", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 0, Batches: 2, Total: 2,
+				BatchStartedAt: &metav1.Time{Time: now.Add(-30 * time.Second)},
+			},
+			expectedUpgrades: []string{},
+		},
+		"GivenFailedInstanceOfPreviousBatch_WhenNextBatchStarted_ThenExpectStillFailed": {
+			givenSpec: v1alpha1.RolloutSpec{BatchPercentages: []int{50, 100}, ProgressDeadline: metav1.Duration{Duration: time.Minute}, MaxFailures: 2},
+			givenStatus: &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 1,
+				FailedInstances: []string{"my-app/a"}, BatchStartedAt: &metav1.Time{Time: now.Add(-30 * time.Second)}},
+			givenInstances: []v1alpha1.PostgresqlStandalone{withUpgrade(newRolloutInstance("a", "1.0.0")), withUpgrade(newRolloutInstance("b", "1.0.0"))},
+			expectedStatus: &v1alpha1.RolloutStatus{
+				Version: "2.0.0", Phase: v1alpha1.RolloutPhaseProgressing, CurrentBatch: 1, Batches: 2, Total: 2,
+				FailedInstances: []string{"my-app/a"},
+				BatchStartedAt:  &metav1.Time{Time: now.Add(-30 * time.Second)},
+			},
+			expectedUpgrades: []string{},
+		},
+		"GivenFailedRollout_ThenExpectNoUpgrades": {
+			givenSpec:      v1alpha1.RolloutSpec{BatchPercentages: []int{100}},
+			givenStatus:    &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseFailed},
+			givenInstances: []v1alpha1.PostgresqlStandalone{newRolloutInstance("a", "1.0.0")},
+			expectedStatus: &v1alpha1.RolloutStatus{Version: "2.0.0", Phase: v1alpha1.RolloutPhaseFailed},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			status, upgrades := planRollout(&tc.givenSpec, tc.givenStatus, "2.0.0", tc.givenInstances, now)
+			assert.Equal(t, tc.expectedStatus, status)
+			if tc.expectedUpgrades == nil {
+				assert.Empty(t, upgrades)
+				return
+			}
+			names := make([]string, len(upgrades))
+			for i, instance := range upgrades {
+				names[i] = instance.Name
+			}
+			assert.Equal(t, tc.expectedUpgrades, names)
+		})
+	}
+}
+
+func TestRolloutRequeueAfter(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		givenSpec     *v1alpha1.RolloutSpec
+		givenStatus   *v1alpha1.RolloutStatus
+		expectedAfter time.Duration
+	}{
+		"GivenNoRollout_ThenExpectNoRequeue": {
+			expectedAfter: 0,
+		},
+		"GivenProgressingRollout_ThenExpectPollInterval": {
+			givenSpec:     &v1alpha1.RolloutSpec{ProgressDeadline: metav1.Duration{Duration: time.Hour}},
+			givenStatus:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseProgressing},
+			expectedAfter: rolloutPollInterval,
+		},
+		"GivenProgressingRollout_WhenDeadlineShorterThanPollInterval_ThenExpectDeadline": {
+			givenSpec:     &v1alpha1.RolloutSpec{ProgressDeadline: metav1.Duration{Duration: 10 * time.Second}},
+			givenStatus:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseProgressing},
+			expectedAfter: 10 * time.Second,
+		},
+		"GivenPausedRollout_ThenExpectEndOfPause": {
+			givenSpec:     &v1alpha1.RolloutSpec{PauseBetweenBatches: metav1.Duration{Duration: time.Hour}},
+			givenStatus:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhasePaused, BatchCompletedAt: &metav1.Time{Time: now.Add(-10 * time.Minute)}},
+			expectedAfter: 50 * time.Minute,
+		},
+		"GivenCompletedRollout_ThenExpectNoRequeue": {
+			givenSpec:     &v1alpha1.RolloutSpec{},
+			givenStatus:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseCompleted},
+			expectedAfter: 0,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.Rollout = tc.givenSpec
+			config.Status.Rollout = tc.givenStatus
+			assert.Equal(t, tc.expectedAfter, RolloutRequeueAfter(config, now))
+		})
+	}
+}
+
+func TestIsRolloutUpgrade(t *testing.T) {
+	tests := map[string]struct {
+		givenAnnotation string
+		givenVersion    string
+		expectedResult  bool
+	}{
+		"GivenAnnotationWithTemplateVersion_ThenExpectUpgrade": {
+			givenAnnotation: "2.0.0",
+			givenVersion:    "1.0.0",
+			expectedResult:  true,
+		},
+		"GivenAnnotationWithOtherVersion_ThenExpectNoUpgrade": {
+			givenAnnotation: "1.5.0",
+			givenVersion:    "1.0.0",
+		},
+		"GivenNoAnnotation_ThenExpectNoUpgrade": {
+			givenVersion: "1.0.0",
+		},
+		"GivenAnnotation_WhenAlreadyUpgraded_ThenExpectNoUpgrade": {
+			givenAnnotation: "2.0.0",
+			givenVersion:    "2.0.0",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			if tc.givenAnnotation != "" {
+				instance.Annotations = map[string]string{RolloutChartVersionAnnotationKey: tc.givenAnnotation}
+			}
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{Spec: v1alpha1.PostgresqlStandaloneOperatorConfigSpec{
+				HelmReleaseTemplate: &v1alpha1.HelmReleaseConfig{Chart: v1alpha1.ChartMeta{Version: "2.0.0"}},
+			}}
+			result := isRolloutUpgrade(instance, config, helmv1beta1.ChartSpec{Version: tc.givenVersion})
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
+
+func newRolloutInstance(name string, version string) v1alpha1.PostgresqlStandalone {
+	instance := newInstance(name, "my-app")
+	instance.Status.HelmChart.Version = version
+	instance.Status.HelmChart.DeploymentNamespace = fmt.Sprintf("sv-postgresql-s-%s", name)
+	return *instance
+}
+
+func withLabels(instance v1alpha1.PostgresqlStandalone, labels map[string]string) v1alpha1.PostgresqlStandalone {
+	instance.Labels = labels
+	return instance
+}
+
+func withUpgrade(instance v1alpha1.PostgresqlStandalone) v1alpha1.PostgresqlStandalone {
+	instance.Annotations = map[string]string{RolloutChartVersionAnnotationKey: "2.0.0"}
+	return instance
+}
+
+func withReleaseReady(instance v1alpha1.PostgresqlStandalone, ready bool, modified time.Time) v1alpha1.PostgresqlStandalone {
+	condition := conditions.ResourceReady(conditions.TypeReleaseReady)
+	if !ready {
+		condition = conditions.ResourceNotReady(conditions.TypeReleaseReady, "Upgrading to chart version 2.0.0")
+	}
+	instance.Status.Conditions = []metav1.Condition{condition}
+	instance.Status.HelmChart.ModifiedTime = metav1.Time{Time: modified}
+	return instance
+}
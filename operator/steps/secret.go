@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilrand "k8s.io/apimachinery/pkg/util/rand"
@@ -18,7 +20,7 @@ func EnsureResticRepositorySecretFn(labelSet labels.Set) func(ctx context.Contex
 	return func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
 		instance := GetInstanceFromContext(ctx)
-		deploymentNamespace := instance.Status.HelmChart.DeploymentNamespace
+		deploymentNamespace := instance.Status.GetDeploymentNamespace()
 
 		// NOTE: we should never delete the Restic Repository secret.
 		// There could be cases where the user temporarily disables backups and then re-enables.
@@ -89,6 +91,7 @@ func EnsureCredentialsSecretFn(labelSet labels.Set) func(ctx context.Context) er
 }
 
 // EnsureConnectionSecretFn creates the connection secret in the instance's namespace.
+// The secret contains the HibernatedConnectionSecretKey while the instance is hibernated.
 func EnsureConnectionSecretFn(labelSet labels.Set) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
@@ -98,6 +101,7 @@ func EnsureConnectionSecretFn(labelSet labels.Set) func(ctx context.Context) err
 
 		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: instance.GetConnectionSecretName(), Namespace: instance.Namespace}}
 		_, err := controllerutil.CreateOrUpdate(ctx, kube, secret, func() error {
+			propagateMetadata(ctx, secret)
 			secret.Labels = labels.Merge(secret.Labels, labelSet)
 			if secret.Data == nil {
 				secret.Data = map[string][]byte{}
@@ -116,6 +120,11 @@ func EnsureConnectionSecretFn(labelSet labels.Set) func(ctx context.Context) err
 			secret.Data["POSTGRESQL_PASSWORD"] = credentialSecret.Data["password"]
 			secret.StringData["POSTGRESQL_DATABASE"] = instance.Name
 			secret.StringData["POSTGRESQL_USER"] = instance.Name
+			if meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeHibernated) {
+				secret.StringData[HibernatedConnectionSecretKey] = "true"
+			} else {
+				delete(secret.Data, HibernatedConnectionSecretKey)
+			}
 			return controllerutil.SetOwnerReference(instance, secret, kube.Scheme())
 		})
 		pipeline.StoreInContext(ctx, ConnectionSecretKey{}, secret)
@@ -133,7 +142,7 @@ func FetchS3BucketSecretFn() func(ctx context.Context) error {
 
 		s3BucketSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
 			Name:      config.Spec.BackupConfigSpec.S3BucketSecret.BucketRef.Name,
-			Namespace: instance.Status.HelmChart.DeploymentNamespace,
+			Namespace: instance.Status.GetDeploymentNamespace(),
 		}}
 		err := kube.Get(ctx, client.ObjectKeyFromObject(s3BucketSecret), s3BucketSecret)
 		pipeline.StoreInContext(ctx, BucketSecretKey{}, s3BucketSecret)
@@ -8,13 +8,14 @@ import (
 )
 
 // FetchServiceFn returns a function that gets the service object and puts it into the context.
+// The name of the service is determined by the DeploymentStrategy in the context.
 func FetchServiceFn() func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		kube := GetClientFromContext(ctx)
 		instance := GetInstanceFromContext(ctx)
 
 		service := &corev1.Service{}
-		err := kube.Get(ctx, client.ObjectKey{Name: "postgresql", Namespace: instance.Status.HelmChart.DeploymentNamespace}, service)
+		err := kube.Get(ctx, client.ObjectKey{Name: getDeploymentStrategyFromContext(ctx).ServiceName(), Namespace: instance.Status.GetDeploymentNamespace()}, service)
 		pipeline.StoreInContext(ctx, ServiceKey{}, service)
 		return err
 	}
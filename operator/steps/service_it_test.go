@@ -41,6 +41,7 @@ func (ts *ServiceSuite) Test_FetchService() {
 	ts.EnsureNS(service.Namespace)
 	ts.EnsureResources(service)
 	instance.Status.HelmChart = &v1alpha1.ChartMetaStatus{DeploymentNamespace: service.Namespace}
+	pipeline.StoreInContext(ts.Context, DeploymentStrategyKey{}, &HelmChartStrategy{})
 
 	// Act
 	err := FetchServiceFn()(ts.Context)
@@ -0,0 +1,330 @@
+package steps
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// postgresqlPort is the port of the PostgreSQL server.
+	postgresqlPort = 5432
+	// postgresqlPortName is the name of the PostgreSQL port in the StatefulSet and the services.
+	postgresqlPortName = "tcp-postgresql"
+	// extendedConfigKey is the key in the extended configuration ConfigMap that contains the PostgreSQL parameters.
+	extendedConfigKey = "override.conf"
+	// configChecksumAnnotationKey is the annotation key of the pod template that contains the checksum of the extended configuration.
+	// Changing the configuration thus restarts PostgreSQL.
+	configChecksumAnnotationKey = "checksum/config"
+	// bitnamiUserID is the ID of the user that runs PostgreSQL in the Bitnami image.
+	bitnamiUserID = 1001
+	// bitnamiVolumeDir is the directory in the Bitnami image where the persistent volume is mounted.
+	bitnamiVolumeDir = "/bitnami/postgresql"
+)
+
+// StatefulSetStrategy is the DeploymentStrategy that deploys PostgreSQL with a StatefulSet, services, a NetworkPolicy and a ConfigMap that are rendered by the operator.
+// The resources resemble the primary of the Bitnami PostgreSQL Helm chart, so that the existing PVC, credentials secret and K8up backups work the same way.
+// The image is configured in the StatefulSet section of the v1alpha1.PostgresqlStandaloneOperatorConfig,
+// and the pods are scheduled according to the Scheduling of the config and the plan of the instance.
+type StatefulSetStrategy struct{}
+
+// Ensure implements DeploymentStrategy.
+// The resources are created or updated in the deployment namespace.
+func (s *StatefulSetStrategy) Ensure(ctx context.Context, labelSet labels.Set) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	config := GetConfigFromContext(ctx)
+	deploymentNamespace := getFromContextOrPanic(ctx, DeploymentNamespaceKey{}).(*corev1.Namespace)
+
+	if config.Spec.StatefulSet == nil || config.Spec.StatefulSet.Image == "" {
+		return fmt.Errorf("operator config %s doesn't specify an image for the %s deployment strategy", config.Name, v1alpha1.StrategyStatefulSet)
+	}
+	plan, err := getPlan(config, instance)
+	if err != nil {
+		return err
+	}
+	ns := deploymentNamespace.Name
+	podLabels := labels.Merge(labelSet, getStatefulSetSelectorLabels())
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: getExtendedConfigName(), Namespace: ns}}
+	_, err = controllerutil.CreateOrUpdate(ctx, kube, configMap, func() error {
+		configMap.Labels = labels.Merge(configMap.Labels, labelSet)
+		parameters := getPostgresqlSettings(config, instance, config.Spec.StatefulSet.Parameters)
+		configMap.Data = map[string]string{extendedConfigKey: renderPostgresqlParameters(parameters)}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, service := range []*corev1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}},
+		{ObjectMeta: metav1.ObjectMeta{Name: getHeadlessServiceName(), Namespace: ns}},
+	} {
+		svc := service
+		_, err := controllerutil.CreateOrUpdate(ctx, kube, svc, func() error {
+			svc.Labels = labels.Merge(svc.Labels, labelSet)
+			setServiceSpec(svc)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	networkPolicy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}}
+	_, err = controllerutil.CreateOrUpdate(ctx, kube, networkPolicy, func() error {
+		networkPolicy.Labels = labels.Merge(networkPolicy.Labels, labelSet)
+		setNetworkPolicySpec(networkPolicy, instance)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}}
+	_, err = controllerutil.CreateOrUpdate(ctx, kube, statefulSet, func() error {
+		statefulSet.Labels = labels.Merge(statefulSet.Labels, labelSet)
+		setStatefulSetSpec(statefulSet, instance, config.Spec.StatefulSet, getComputeResources(config, instance), getScheduling(config, plan), podLabels, configMap.Data[extendedConfigKey])
+		return nil
+	})
+	pipeline.StoreInContext(ctx, StatefulSetKey{}, statefulSet)
+	return err
+}
+
+// Observe implements DeploymentStrategy.
+// See updateDeploymentStatus.
+func (s *StatefulSetStrategy) Observe(ctx context.Context) error {
+	statefulSet := getFromContextOrPanic(ctx, StatefulSetKey{}).(*appsv1.StatefulSet)
+	return updateDeploymentStatus(ctx, v1alpha1.StrategyStatefulSet, statefulSet.Namespace)
+}
+
+// IsReady implements DeploymentStrategy.
+// See isStatefulSetReady.
+func (s *StatefulSetStrategy) IsReady(ctx context.Context) bool {
+	statefulSet := getFromContextOrPanic(ctx, StatefulSetKey{}).(*appsv1.StatefulSet)
+	return isStatefulSetReady(statefulSet)
+}
+
+// Delete implements DeploymentStrategy.
+// Ignores "not found" errors and returns nil if deployment namespace is unknown.
+// The PVC and the credentials secret are not deleted, as they don't belong to the strategy.
+func (s *StatefulSetStrategy) Delete(ctx context.Context) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+
+	ns := instance.Status.GetDeploymentNamespace()
+	if ns == "" {
+		// Resources might not ever have existed, skip
+		return nil
+	}
+	for _, obj := range []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: getHeadlessServiceName(), Namespace: ns}},
+		&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: getDeploymentName(), Namespace: ns}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: getExtendedConfigName(), Namespace: ns}},
+	} {
+		if err := kube.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServiceName implements DeploymentStrategy.
+func (s *StatefulSetStrategy) ServiceName() string {
+	return getDeploymentName()
+}
+
+// isStatefulSetReady returns true if the StatefulSet controller has observed the latest spec and all replicas are updated and ready.
+func isStatefulSetReady(statefulSet *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	return status.ObservedGeneration >= statefulSet.Generation &&
+		status.ReadyReplicas == replicas &&
+		status.UpdatedReplicas == replicas &&
+		status.CurrentRevision == status.UpdateRevision
+}
+
+func setStatefulSetSpec(statefulSet *appsv1.StatefulSet, instance *v1alpha1.PostgresqlStandalone, config *v1alpha1.StatefulSetConfig, resources corev1.ResourceRequirements, scheduling v1alpha1.SchedulingSpec, podLabels labels.Set, extendedConfig string) {
+	// The selector is immutable, so it must not contain labels that could change.
+	statefulSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: getStatefulSetSelectorLabels()}
+	statefulSet.Spec.ServiceName = getHeadlessServiceName()
+	statefulSet.Spec.Replicas = pointer.Int32(getPrimaryReplicas(instance))
+	statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+
+	template := &statefulSet.Spec.Template
+	template.Labels = podLabels
+	template.Annotations = labels.Merge(getBackupAnnotations(bitnamiBackupCommand), map[string]string{
+		"postgresql.appcat.vshn.io/storage-capacity": instance.Spec.Parameters.Resources.StorageCapacity.String(),
+		configChecksumAnnotationKey:                  fmt.Sprintf("%x", sha256.Sum256([]byte(extendedConfig))),
+	})
+	template.Spec.SecurityContext = newRestrictedPodSecurityContext()
+	template.Spec.NodeSelector = scheduling.NodeSelector
+	template.Spec.Tolerations = scheduling.Tolerations
+	template.Spec.Affinity = scheduling.Affinity
+	template.Spec.TopologySpreadConstraints = scheduling.TopologySpreadConstraints
+	template.Spec.PriorityClassName = scheduling.PriorityClassName
+	template.Spec.Volumes = []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: getInstancePVCName(instance)}}},
+		{Name: "extended-config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: getExtendedConfigName()}}}},
+		{Name: "dshm", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}},
+	}
+
+	secretEnv := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: getCredentialSecretName()},
+			Key:                  key,
+		}}}
+	}
+	readinessCommand := fmt.Sprintf(`exec pg_isready -U %q -d "dbname=%s" -h 127.0.0.1 -p %d`, instance.Name, instance.Name, postgresqlPort)
+	container := corev1.Container{
+		Name:            "postgresql",
+		Image:           config.Image,
+		ImagePullPolicy: config.ImagePullPolicy,
+		SecurityContext: newRestrictedSecurityContext(),
+		Env: []corev1.EnvVar{
+			{Name: "POSTGRESQL_PORT_NUMBER", Value: fmt.Sprintf("%d", postgresqlPort)},
+			{Name: "POSTGRESQL_VOLUME_DIR", Value: bitnamiVolumeDir},
+			{Name: "PGDATA", Value: bitnamiVolumeDir + "/data"},
+			{Name: "POSTGRES_USER", Value: instance.Name},
+			{Name: "POSTGRES_DB", Value: instance.Name},
+			secretEnv("POSTGRES_PASSWORD", "password"),
+			secretEnv("POSTGRES_POSTGRES_PASSWORD", "postgres-password"),
+		},
+		Ports:          []corev1.ContainerPort{{Name: postgresqlPortName, ContainerPort: postgresqlPort, Protocol: corev1.ProtocolTCP}},
+		Resources:      resources,
+		LivenessProbe:  newExecProbe(fmt.Sprintf(`exec pg_isready -U "postgres" -h 127.0.0.1 -p %d`, postgresqlPort), 30),
+		ReadinessProbe: newExecProbe(readinessCommand, 5),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "data", MountPath: bitnamiVolumeDir},
+			{Name: "extended-config", MountPath: bitnamiVolumeDir + "/conf/conf.d/"},
+			{Name: "dshm", MountPath: "/dev/shm"},
+		},
+	}
+	template.Spec.Containers = []corev1.Container{container}
+}
+
+// newRestrictedPodSecurityContext returns the security context of pods that run the Bitnami image.
+// Together with newRestrictedSecurityContext, it complies with the `restricted` level of the Pod Security Standards,
+// so that the pods are admitted in deployment namespaces that enforce it, see v1alpha1.DeploymentNamespaceConfig.
+func newRestrictedPodSecurityContext() *corev1.PodSecurityContext {
+	return &corev1.PodSecurityContext{
+		FSGroup:        pointer.Int64(bitnamiUserID),
+		RunAsNonRoot:   pointer.Bool(true),
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+}
+
+// newRestrictedSecurityContext returns the security context of containers that run the Bitnami image, see newRestrictedPodSecurityContext.
+func newRestrictedSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		RunAsUser:                pointer.Int64(bitnamiUserID),
+		RunAsNonRoot:             pointer.Bool(true),
+		AllowPrivilegeEscalation: pointer.Bool(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
+
+func newExecProbe(command string, initialDelaySeconds int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler:        corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", command}}},
+		InitialDelaySeconds: initialDelaySeconds,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      5,
+		FailureThreshold:    6,
+	}
+}
+
+func setServiceSpec(service *corev1.Service) {
+	service.Spec.Selector = getStatefulSetSelectorLabels()
+	service.Spec.Ports = []corev1.ServicePort{{
+		Name:       postgresqlPortName,
+		Port:       postgresqlPort,
+		TargetPort: intstr.FromString(postgresqlPortName),
+		Protocol:   corev1.ProtocolTCP,
+	}}
+	if service.Name == getHeadlessServiceName() {
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+		service.Spec.PublishNotReadyAddresses = true
+		return
+	}
+	service.Spec.Type = corev1.ServiceTypeClusterIP
+}
+
+// setNetworkPolicySpec allows connections to PostgreSQL only from the namespace of the instance and from within the deployment namespace.
+// While the storage is migrated, only the pods of the migration jobs can connect.
+func setNetworkPolicySpec(networkPolicy *networkingv1.NetworkPolicy, instance *v1alpha1.PostgresqlStandalone) {
+	port := intstr.FromInt(postgresqlPort)
+	peers := []networkingv1.NetworkPolicyPeer{
+		{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": instance.Namespace}}},
+		{PodSelector: &metav1.LabelSelector{}},
+	}
+	if isStorageMigrationInProgress(instance) {
+		peers = []networkingv1.NetworkPolicyPeer{
+			{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{StorageMigrationLabelKey: "true"}}},
+		}
+	}
+	networkPolicy.Spec = networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: getStatefulSetSelectorLabels()},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			Ports: []networkingv1.NetworkPolicyPort{{Port: &port}},
+			From:  peers,
+		}},
+	}
+}
+
+// PostgresqlSettingNamePattern matches the valid names of PostgreSQL settings, including the settings of extensions like `pg_stat_statements.max`.
+var PostgresqlSettingNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_.]*$`)
+
+// renderPostgresqlParameters renders the given parameters in the format of postgresql.conf, sorted by name.
+// Parameters with invalid names or values with line breaks are skipped, so that they can't add other settings to the configuration.
+func renderPostgresqlParameters(parameters map[string]string) string {
+	names := make([]string, 0, len(parameters))
+	for name, value := range parameters {
+		if PostgresqlSettingNamePattern.MatchString(name) && !strings.ContainsAny(value, "\r\n") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	b := &strings.Builder{}
+	for _, name := range names {
+		_, _ = fmt.Fprintf(b, "%s = '%s'\n", name, strings.ReplaceAll(parameters[name], "'", "''"))
+	}
+	return b.String()
+}
+
+func getStatefulSetSelectorLabels() labels.Set {
+	return labels.Set{
+		"app.kubernetes.io/name":      "postgresql",
+		"app.kubernetes.io/component": "primary",
+	}
+}
+
+func getHeadlessServiceName() string {
+	return fmt.Sprintf("%s-hl", getDeploymentName())
+}
+
+func getExtendedConfigName() string {
+	return fmt.Sprintf("%s-extended-configuration", getDeploymentName())
+}
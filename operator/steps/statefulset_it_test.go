@@ -0,0 +1,115 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type StatefulSetSuite struct {
+	operatortest.Suite
+}
+
+func TestStatefulSetSuite(t *testing.T) {
+	suite.Run(t, new(StatefulSetSuite))
+}
+
+func (ts *StatefulSetSuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+	ts.RegisterScheme(appsv1.AddToScheme)
+	ts.RegisterScheme(networkingv1.AddToScheme)
+}
+
+func (ts *StatefulSetSuite) Test_Ensure() {
+	// Arrange
+	deploymentNamespace := "sts-ensure"
+	instance := newInstance("instance", "my-app")
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	config.Spec.StatefulSet = &v1alpha1.StatefulSetConfig{
+		Image:      "docker.io/bitnami/postgresql:14.4.0",
+		Parameters: map[string]string{"max_connections": "100"},
+	}
+	ts.EnsureNS(deploymentNamespace)
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: deploymentNamespace}})
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	strategy := &StatefulSetStrategy{}
+
+	// Act
+	err := strategy.Ensure(ts.Context, labels.Set{"test": "label"})
+	ts.Require().NoError(err)
+
+	// Assert
+	statefulSet := &appsv1.StatefulSet{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql", Namespace: deploymentNamespace}, statefulSet)
+	ts.Assert().Equal("label", statefulSet.Labels["test"])
+	ts.Assert().Equal("label", statefulSet.Spec.Template.Labels["test"])
+	ts.Assert().Equal("postgresql-hl", statefulSet.Spec.ServiceName)
+	ts.Assert().Equal("docker.io/bitnami/postgresql:14.4.0", statefulSet.Spec.Template.Spec.Containers[0].Image)
+	ts.Assert().Equal("postgresql-data", statefulSet.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	ts.Assert().Contains(statefulSet.Spec.Template.Annotations, "k8up.io/backupcommand")
+	ts.Assert().False(strategy.IsReady(ts.Context), "StatefulSet ready")
+
+	service := &corev1.Service{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql", Namespace: deploymentNamespace}, service)
+	ts.Assert().Equal(int32(5432), service.Spec.Ports[0].Port)
+	headless := &corev1.Service{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql-hl", Namespace: deploymentNamespace}, headless)
+	ts.Assert().Equal(corev1.ClusterIPNone, headless.Spec.ClusterIP)
+
+	networkPolicy := &networkingv1.NetworkPolicy{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql", Namespace: deploymentNamespace}, networkPolicy)
+	ts.Assert().Equal("my-app", networkPolicy.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"])
+
+	configMap := &corev1.ConfigMap{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql-extended-configuration", Namespace: deploymentNamespace}, configMap)
+	ts.Assert().Equal("max_connections = '100'\n", configMap.Data["override.conf"])
+}
+
+func (ts *StatefulSetSuite) Test_Ensure_GivenNoImage_ThenExpectError() {
+	// Arrange
+	instance := newInstance("instance", "my-app")
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	pipeline.StoreInContext(ts.Context, DeploymentNamespaceKey{}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sts-no-image"}})
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+
+	// Act
+	err := (&StatefulSetStrategy{}).Ensure(ts.Context, labels.Set{})
+
+	// Assert
+	ts.Assert().EqualError(err, "operator config config doesn't specify an image for the StatefulSet deployment strategy")
+}
+
+func (ts *StatefulSetSuite) Test_Delete() {
+	// Arrange
+	deploymentNamespace := "sts-delete"
+	instance := newInstance("instance", "my-app")
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	SetInstanceInContext(ts.Context, instance)
+	ts.EnsureNS(deploymentNamespace)
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "postgresql-extended-configuration", Namespace: deploymentNamespace}}
+	ts.EnsureResources(configMap)
+
+	// Act
+	err := (&StatefulSetStrategy{}).Delete(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	err = ts.Client.Get(ts.Context, types.NamespacedName{Name: configMap.Name, Namespace: deploymentNamespace}, &corev1.ConfigMap{})
+	ts.Assert().True(apierrors.IsNotFound(err), "not found error expected")
+}
@@ -0,0 +1,181 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/pointer"
+)
+
+func TestIsStatefulSetReady(t *testing.T) {
+	tests := map[string]struct {
+		givenGeneration int64
+		givenStatus     appsv1.StatefulSetStatus
+		expectedReady   bool
+	}{
+		"GivenNewStatefulSet_WhenNotObservedYet_ThenExpectNotReady": {
+			givenGeneration: 1,
+			expectedReady:   false,
+		},
+		"GivenStatefulSet_WhenReplicaReady_ThenExpectReady": {
+			givenGeneration: 1,
+			givenStatus:     appsv1.StatefulSetStatus{ObservedGeneration: 1, ReadyReplicas: 1, UpdatedReplicas: 1, CurrentRevision: "rev1", UpdateRevision: "rev1"},
+			expectedReady:   true,
+		},
+		"GivenChangedStatefulSet_WhenNotObservedYet_ThenExpectNotReady": {
+			givenGeneration: 2,
+			givenStatus:     appsv1.StatefulSetStatus{ObservedGeneration: 1, ReadyReplicas: 1, UpdatedReplicas: 1, CurrentRevision: "rev1", UpdateRevision: "rev1"},
+			expectedReady:   false,
+		},
+		"GivenChangedStatefulSet_WhenRollingUpdate_ThenExpectNotReady": {
+			givenGeneration: 2,
+			givenStatus:     appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 1, UpdatedReplicas: 0, CurrentRevision: "rev1", UpdateRevision: "rev2"},
+			expectedReady:   false,
+		},
+		"GivenStatefulSet_WhenReplicaNotReady_ThenExpectNotReady": {
+			givenGeneration: 2,
+			givenStatus:     appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 0, UpdatedReplicas: 1, CurrentRevision: "rev2", UpdateRevision: "rev2"},
+			expectedReady:   false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			statefulSet := &appsv1.StatefulSet{}
+			statefulSet.Generation = tc.givenGeneration
+			statefulSet.Spec.Replicas = pointer.Int32(1)
+			statefulSet.Status = tc.givenStatus
+			assert.Equal(t, tc.expectedReady, isStatefulSetReady(statefulSet))
+		})
+	}
+}
+
+func TestSetNetworkPolicySpec(t *testing.T) {
+	tests := map[string]struct {
+		givenMigration *v1alpha1.StorageMigrationStatus
+		expectedPeers  []networkingv1.NetworkPolicyPeer
+	}{
+		"GivenNoMigration_ThenExpectInstanceNamespaceAndDeploymentNamespaceAllowed": {
+			expectedPeers: []networkingv1.NetworkPolicyPeer{
+				{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "my-app"}}},
+				{PodSelector: &metav1.LabelSelector{}},
+			},
+		},
+		"GivenMigrationInProgress_ThenExpectOnlyMigrationJobsAllowed": {
+			givenMigration: &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseRestoring},
+			expectedPeers: []networkingv1.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{StorageMigrationLabelKey: "true"}}},
+			},
+		},
+		"GivenFailedMigration_ThenExpectInstanceNamespaceAndDeploymentNamespaceAllowed": {
+			givenMigration: &v1alpha1.StorageMigrationStatus{Phase: v1alpha1.StorageMigrationPhaseFailed},
+			expectedPeers: []networkingv1.NetworkPolicyPeer{
+				{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "my-app"}}},
+				{PodSelector: &metav1.LabelSelector{}},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := newInstance("instance", "my-app")
+			instance.Status.StorageMigration = tc.givenMigration
+			networkPolicy := &networkingv1.NetworkPolicy{}
+			setNetworkPolicySpec(networkPolicy, instance)
+			assert.Equal(t, tc.expectedPeers, networkPolicy.Spec.Ingress[0].From)
+		})
+	}
+}
+
+func TestRenderPostgresqlParameters(t *testing.T) {
+	result := renderPostgresqlParameters(map[string]string{
+		"shared_buffers":   "128MB",
+		"max_connections":  "100",
+		"search_path":      `"$user", public`,
+		"application_name": "it's",
+	})
+	assert.Equal(t, "application_name = 'it''s'\nmax_connections = '100'\nsearch_path = '\"$user\", public'\nshared_buffers = '128MB'\n", result)
+}
+
+func TestRenderPostgresqlParameters_GivenInvalidSettings_ThenExpectSkipped(t *testing.T) {
+	result := renderPostgresqlParameters(map[string]string{
+		"work_mem":                 "8MB",
+		"fsync = off\nwork_mem":    "4MB",
+		"shared_buffers":           "128MB\narchive_command = 'evil'",
+		"pg_stat_statements.track": "all",
+	})
+	assert.Equal(t, "pg_stat_statements.track = 'all'\nwork_mem = '8MB'\n", result)
+}
+
+func TestSetStatefulSetSpec_ThenExpectRestrictedPodSecurity(t *testing.T) {
+	// Arrange
+	instance := newInstance("instance", "my-app")
+	statefulSet := &appsv1.StatefulSet{}
+	job := &batchv1.Job{}
+
+	// Act
+	setStatefulSetSpec(statefulSet, instance, &v1alpha1.StatefulSetConfig{}, corev1.ResourceRequirements{}, v1alpha1.SchedulingSpec{}, labels.Set{}, "")
+	setMigrationJobSpec(job, instance, &v1alpha1.PostgresqlStandaloneOperatorConfig{}, getDeploymentName(), labels.Set{}, migrationBackupCommand)
+
+	// Assert
+	for name, podSpec := range map[string]corev1.PodSpec{"statefulset": statefulSet.Spec.Template.Spec, "migration job": job.Spec.Template.Spec} {
+		require.NotNil(t, podSpec.SecurityContext, "%s: pod security context", name)
+		assert.True(t, *podSpec.SecurityContext.RunAsNonRoot, "%s: pod runAsNonRoot", name)
+		require.NotNil(t, podSpec.SecurityContext.SeccompProfile, "%s: seccomp profile", name)
+		assert.Equal(t, corev1.SeccompProfileTypeRuntimeDefault, podSpec.SecurityContext.SeccompProfile.Type, "%s: seccomp profile", name)
+		for _, container := range podSpec.Containers {
+			securityContext := container.SecurityContext
+			require.NotNil(t, securityContext, "%s: container security context", name)
+			assert.True(t, *securityContext.RunAsNonRoot, "%s: container runAsNonRoot", name)
+			assert.False(t, *securityContext.AllowPrivilegeEscalation, "%s: allowPrivilegeEscalation", name)
+			require.NotNil(t, securityContext.Capabilities, "%s: capabilities", name)
+			assert.Equal(t, []corev1.Capability{"ALL"}, securityContext.Capabilities.Drop, "%s: dropped capabilities", name)
+			assert.Empty(t, securityContext.Capabilities.Add, "%s: added capabilities", name)
+		}
+	}
+}
+
+func TestSetStatefulSetSpec_GivenScheduling_ThenExpectSchedulingOfPods(t *testing.T) {
+	// Arrange
+	instance := newInstance("instance", "my-app")
+	scheduling := v1alpha1.SchedulingSpec{
+		NodeSelector: map[string]string{"appuio.io/node-class": "db"},
+		Tolerations:  []corev1.Toleration{{Key: "db", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+			}}},
+		}}},
+		TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{MaxSkew: 1, TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: corev1.ScheduleAnyway}},
+		PriorityClassName:         "database",
+	}
+	statefulSet := &appsv1.StatefulSet{}
+
+	// Act
+	setStatefulSetSpec(statefulSet, instance, &v1alpha1.StatefulSetConfig{}, corev1.ResourceRequirements{}, scheduling, labels.Set{}, "")
+
+	// Assert
+	podSpec := statefulSet.Spec.Template.Spec
+	assert.Equal(t, scheduling.NodeSelector, podSpec.NodeSelector, "node selector")
+	assert.Equal(t, scheduling.Tolerations, podSpec.Tolerations, "tolerations")
+	assert.Equal(t, scheduling.Affinity, podSpec.Affinity, "affinity")
+	assert.Equal(t, scheduling.TopologySpreadConstraints, podSpec.TopologySpreadConstraints, "topology spread constraints")
+	assert.Equal(t, "database", podSpec.PriorityClassName, "priority class")
+
+	// Act: remove scheduling
+	setStatefulSetSpec(statefulSet, instance, &v1alpha1.StatefulSetConfig{}, corev1.ResourceRequirements{}, v1alpha1.SchedulingSpec{}, labels.Set{}, "")
+
+	// Assert
+	podSpec = statefulSet.Spec.Template.Spec
+	assert.Empty(t, podSpec.NodeSelector, "node selector")
+	assert.Empty(t, podSpec.Tolerations, "tolerations")
+	assert.Nil(t, podSpec.Affinity, "affinity")
+	assert.Empty(t, podSpec.TopologySpreadConstraints, "topology spread constraints")
+	assert.Empty(t, podSpec.PriorityClassName, "priority class")
+}
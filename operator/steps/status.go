@@ -2,8 +2,12 @@ package steps
 
 import (
 	"context"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
 	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	controllerruntime "sigs.k8s.io/controller-runtime"
 )
 
 // MarkInstanceAsReadyFn marks an instance as ready by updating the status conditions.
@@ -48,3 +52,66 @@ func MarkInstanceAsProgressingFn() func(ctx context.Context) error {
 		return kube.Status().Update(ctx, instance)
 	}
 }
+
+// SetConditionFn returns a func that sets the given condition on the instance.
+// The status is not updated, the condition is persisted by the next step that updates the status.
+func SetConditionFn(condition metav1.Condition) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+
+		meta.SetStatusCondition(
+			&instance.Status.Conditions,
+			conditions.Builder().
+				With(condition).
+				WithGeneration(instance).
+				Build(),
+		)
+		return nil
+	}
+}
+
+// SetConditionFromResultFn returns a pipeline.ResultHandler that sets the given condition on the instance if the step has been successful.
+// Otherwise, it sets an inactive condition of the same type that contains the step's error.
+// The step's error is passed on unchanged.
+func SetConditionFromResultFn(condition metav1.Condition) pipeline.ResultHandler {
+	return func(ctx context.Context, result pipeline.Result) error {
+		if result.IsFailed() {
+			return SetConditionFromErrorFn(condition.Type)(ctx, result.Err())
+		}
+		_ = SetConditionFn(condition)(ctx)
+		return nil
+	}
+}
+
+// SetConditionFromErrorFn returns a func that sets an inactive condition with the given type that contains the given error.
+// It is meant to be used as error handler of a step, the error is passed on unchanged.
+func SetConditionFromErrorFn(conditionType string) func(ctx context.Context, err error) error {
+	return func(ctx context.Context, err error) error {
+		_ = SetConditionFn(conditions.ResourceNotReady(conditionType, err.Error()))(ctx)
+		return err
+	}
+}
+
+// UpdateSyncedConditionFn returns a pipeline.ResultHandler that sets the Synced condition according to the result of a pipeline and updates the status.
+// If the pipeline failed, the condition contains the error message, which includes the name of the failed step.
+// The error of the pipeline takes precedence over an error that happens while updating the status.
+func UpdateSyncedConditionFn() pipeline.ResultHandler {
+	return func(ctx context.Context, result pipeline.Result) error {
+		kube := GetClientFromContext(ctx)
+		instance := GetInstanceFromContext(ctx)
+
+		if result.IsFailed() {
+			_ = SetConditionFn(conditions.ReconcileError(result.Err().Error()))(ctx)
+		} else {
+			_ = SetConditionFn(conditions.Synced())(ctx)
+		}
+		err := kube.Status().Update(ctx, instance)
+		if result.IsFailed() {
+			if err != nil {
+				controllerruntime.LoggerFrom(ctx).Error(err, "Cannot update status with reconcile error", "step", result.Name())
+			}
+			return result.Err()
+		}
+		return err
+	}
+}
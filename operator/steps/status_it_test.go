@@ -4,11 +4,13 @@ package steps
 
 import (
 	"context"
+	"errors"
 	pipeline "github.com/ccremer/go-command-pipeline"
 	"github.com/stretchr/testify/suite"
 	"github.com/vshn/appcat-service-postgresql/apis/conditions"
 	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
 	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"testing"
@@ -148,3 +150,56 @@ func (ts *StatusSuite) Test_MarkInstanceAsProgressing() {
 		})
 	}
 }
+
+func (ts *StatusSuite) Test_UpdateSyncedCondition() {
+	tests := map[string]struct {
+		givenInstanceName string
+		givenError        error
+		expectedStatus    metav1.ConditionStatus
+		expectedReason    string
+		expectedMessage   string
+	}{
+		"GivenFailedPipeline_WhenUpdatingStatus_ThenExpectReconcileErrorWithStepName": {
+			givenInstanceName: "failed-pipeline",
+			givenError:        errors.New("cannot create PVC"),
+			expectedStatus:    metav1.ConditionFalse,
+			expectedReason:    conditions.ReasonReconcileError,
+			expectedMessage:   `step "ensure PVC" failed: cannot create PVC`,
+		},
+		"GivenSuccessfulPipeline_WhenUpdatingStatus_ThenExpectSyncedCondition": {
+			givenInstanceName: "successful-pipeline",
+			expectedStatus:    metav1.ConditionTrue,
+			expectedReason:    conditions.ReasonReconcileSuccess,
+		},
+	}
+	for name, tc := range tests {
+		ts.Run(name, func() {
+			// Arrange
+			instance := newInstance(tc.givenInstanceName, "synced-condition")
+			SetInstanceInContext(ts.Context, instance)
+			ts.EnsureNS(instance.Namespace)
+			ts.EnsureResources(instance)
+
+			// Act
+			err := pipeline.NewPipeline().WithSteps(
+				pipeline.NewStepFromFunc("ensure PVC", func(ctx context.Context) error {
+					return tc.givenError
+				}),
+			).WithFinalizer(UpdateSyncedConditionFn()).RunWithContext(ts.Context).Err()
+			if tc.givenError != nil {
+				ts.Require().EqualError(err, tc.expectedMessage)
+			} else {
+				ts.Require().NoError(err)
+			}
+
+			// Assert
+			result := &v1alpha1.PostgresqlStandalone{}
+			ts.FetchResource(client.ObjectKeyFromObject(instance), result)
+			condition := meta.FindStatusCondition(result.Status.Conditions, conditions.TypeSynced)
+			ts.Require().NotNil(condition, "synced condition")
+			ts.Assert().Equal(tc.expectedStatus, condition.Status, "condition status")
+			ts.Assert().Equal(tc.expectedReason, condition.Reason, "condition reason")
+			ts.Assert().Equal(tc.expectedMessage, condition.Message, "condition message")
+		})
+	}
+}
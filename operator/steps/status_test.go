@@ -0,0 +1,64 @@
+package steps
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetConditionFromResultFn(t *testing.T) {
+	tests := map[string]struct {
+		givenError        error
+		expectedStatus    metav1.ConditionStatus
+		expectedReason    string
+		expectedMessage   string
+		expectedErrString string
+	}{
+		"GivenSuccessfulStep_ThenExpectActiveCondition": {
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: conditions.ReasonReady,
+		},
+		"GivenFailedStep_ThenExpectInactiveConditionWithMessage": {
+			givenError:        errors.New("error"),
+			expectedStatus:    metav1.ConditionFalse,
+			expectedReason:    conditions.ReasonNotReady,
+			expectedMessage:   `step "ensure PVC" failed: error`,
+			expectedErrString: `step "ensure PVC" failed: error`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			ctx := pipeline.MutableContext(context.Background())
+			instance := newInstance("instance", "my-app")
+			SetInstanceInContext(ctx, instance)
+
+			// Act
+			result := pipeline.NewPipeline().WithSteps(
+				pipeline.NewStepFromFunc("ensure PVC", func(ctx context.Context) error {
+					return tc.givenError
+				}),
+			).WithFinalizer(SetConditionFromResultFn(conditions.ResourceReady(conditions.TypeStorageReady))).RunWithContext(ctx)
+
+			// Assert
+			if tc.expectedErrString != "" {
+				assert.EqualError(t, result.Err(), tc.expectedErrString)
+			} else {
+				assert.NoError(t, result.Err())
+			}
+			condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeStorageReady)
+			require.NotNil(t, condition, "condition")
+			assert.Equal(t, tc.expectedStatus, condition.Status, "condition status")
+			assert.Equal(t, tc.expectedReason, condition.Reason, "condition reason")
+			assert.Equal(t, tc.expectedMessage, condition.Message, "condition message")
+			assert.Equal(t, instance.Generation, condition.ObservedGeneration, "observed generation")
+		})
+	}
+}
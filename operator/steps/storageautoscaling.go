@@ -0,0 +1,211 @@
+package steps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxRecordedStorageResizes is the number of automatic resizes that are kept in the status of an instance.
+const maxRecordedStorageResizes = 10
+
+// Reasons of the events about storage autoscaling.
+const (
+	// StorageAutoscaledReason is the reason of the event when the StorageCapacity of an instance has been increased automatically.
+	StorageAutoscaledReason = "StorageAutoscaled"
+	// StorageAutoscalingLimitReachedReason is the reason of the event when the StorageCapacity of an instance can't be increased further.
+	StorageAutoscalingLimitReachedReason = "StorageAutoscalingLimitReached"
+)
+
+// VolumeUsage is the usage of a mounted volume in bytes.
+type VolumeUsage struct {
+	CapacityBytes int64
+	UsedBytes     int64
+}
+
+// VolumeUsageReader reads the usage of the volume of a PersistentVolumeClaim that is mounted by a pod.
+type VolumeUsageReader interface {
+	// ReadVolumeUsage returns the usage of the volume of the given claim that is mounted by the given pod.
+	// It returns nil if the pod doesn't mount the claim.
+	ReadVolumeUsage(ctx context.Context, pod *corev1.Pod, claimName string) (*VolumeUsage, error)
+}
+
+// KubeletVolumeUsageReader is a VolumeUsageReader that reads the stats summary of the kubelet through the node proxy of the Kubernetes API.
+type KubeletVolumeUsageReader struct {
+	Clientset kubernetes.Interface
+}
+
+// kubeletStatsSummary is the part of the stats summary of the kubelet that contains the usage of the volumes.
+type kubeletStatsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Volumes []struct {
+			PVCRef *struct {
+				Name string `json:"name"`
+			} `json:"pvcRef,omitempty"`
+			CapacityBytes *int64 `json:"capacityBytes,omitempty"`
+			UsedBytes     *int64 `json:"usedBytes,omitempty"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// ReadVolumeUsage implements VolumeUsageReader.
+func (r *KubeletVolumeUsageReader) ReadVolumeUsage(ctx context.Context, pod *corev1.Pod, claimName string) (*VolumeUsage, error) {
+	raw, err := r.Clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").Name(pod.Spec.NodeName).SubResource("proxy", "stats", "summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get stats summary of node %s: %w", pod.Spec.NodeName, err)
+	}
+	return parseVolumeUsage(raw, pod, claimName)
+}
+
+// parseVolumeUsage returns the usage of the volume of the given claim that is mounted by the given pod from the given stats summary of a kubelet.
+func parseVolumeUsage(raw []byte, pod *corev1.Pod, claimName string) (*VolumeUsage, error) {
+	summary := kubeletStatsSummary{}
+	if err := json.Unmarshal(raw, &summary); err != nil {
+		return nil, fmt.Errorf("cannot parse stats summary: %w", err)
+	}
+	for _, podStats := range summary.Pods {
+		if podStats.PodRef.Name != pod.Name || podStats.PodRef.Namespace != pod.Namespace {
+			continue
+		}
+		for _, volume := range podStats.Volumes {
+			if volume.PVCRef == nil || volume.PVCRef.Name != claimName || volume.CapacityBytes == nil || volume.UsedBytes == nil {
+				continue
+			}
+			return &VolumeUsage{CapacityBytes: *volume.CapacityBytes, UsedBytes: *volume.UsedBytes}, nil
+		}
+	}
+	return nil, nil
+}
+
+// AutoscaleStorageFn returns a func that increases the StorageCapacity of the instance by the increment of its v1alpha1.StorageAutoscaling,
+// once the usage of its volume reaches the threshold.
+// The capacity doesn't exceed the maximum of the autoscaling nor the maximum storage capacity in the ResourceMaxima of the config.
+// The usage and each increase are recorded in the status of the instance, and each increase is recorded in an event.
+// Reaching the maximum is recorded in the status as well, and in a warning event once it's reached.
+//
+// The usage is only observed if the VolumeUsageReader is in the context,
+// and while the volume isn't being expanded or migrated, so that the capacity is increased only once per expansion.
+// Instances deployed with v1alpha1.StrategyCloudNativePG are skipped, since CloudNativePG manages its own volumes.
+func AutoscaleStorageFn() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+		reader, exists := pipeline.LoadFromContext(ctx, VolumeUsageReaderKey{})
+		if !exists || !isStorageAutoscalingPossible(instance) {
+			return nil
+		}
+		kube := GetClientFromContext(ctx)
+		config := GetConfigFromContext(ctx)
+		pvc := getFromContextOrPanic(ctx, PersistentVolumeClaimKey{}).(*corev1.PersistentVolumeClaim)
+
+		pod := &corev1.Pod{}
+		err := kube.Get(ctx, client.ObjectKey{Name: getPrimaryPodName(), Namespace: pvc.Namespace}, pod)
+		if err != nil || pod.Spec.NodeName == "" {
+			return client.IgnoreNotFound(err)
+		}
+		usage, err := reader.(VolumeUsageReader).ReadVolumeUsage(ctx, pod, pvc.Name)
+		if err != nil {
+			return fmt.Errorf("cannot read usage of volume %s: %w", pvc.Name, err)
+		}
+		if usage == nil || usage.CapacityBytes <= 0 {
+			return nil
+		}
+		usedPercentage := usage.UsedBytes * 100 / usage.CapacityBytes
+		status := instance.Status.DeepCopy()
+		if status.StorageAutoscaling == nil {
+			status.StorageAutoscaling = &v1alpha1.StorageAutoscalingStatus{}
+		}
+		status.StorageAutoscaling.UsedPercentage = usedPercentage
+		status.StorageAutoscaling.LastObservedTime = metav1.Now()
+
+		previous := instance.Spec.Parameters.Resources.StorageCapacity
+		capacity, limitReached := getAutoscaledStorageCapacity(config, instance, usedPercentage)
+		if limitReached && !status.StorageAutoscaling.LimitReached {
+			recordEvent(ctx, instance, corev1.EventTypeWarning, StorageAutoscalingLimitReachedReason,
+				"Volume usage is %d%%, but storage capacity %s cannot be increased beyond the maximum", usedPercentage, previous)
+		}
+		status.StorageAutoscaling.LimitReached = limitReached
+		if capacity == nil {
+			instance.Status = *status
+			return kube.Status().Update(ctx, instance)
+		}
+
+		log := controllerruntime.LoggerFrom(ctx)
+		log.Info("Increasing storage capacity", "usedPercentage", usedPercentage, "previousCapacity", previous, "capacity", capacity)
+		instance.Spec.Parameters.Resources.StorageCapacity = capacity
+		if err := kube.Update(ctx, instance); err != nil {
+			return fmt.Errorf("cannot increase storage capacity from %s to %s: %w", previous, capacity, err)
+		}
+		recordEvent(ctx, instance, corev1.EventTypeNormal, StorageAutoscaledReason,
+			"Increased storage capacity from %s to %s, volume usage is %d%%", previous, capacity, usedPercentage)
+		status.StorageAutoscaling.Resizes = append(status.StorageAutoscaling.Resizes, v1alpha1.StorageResize{
+			Time:             status.StorageAutoscaling.LastObservedTime,
+			UsedPercentage:   usedPercentage,
+			PreviousCapacity: previous.DeepCopy(),
+			Capacity:         capacity.DeepCopy(),
+		})
+		if count := len(status.StorageAutoscaling.Resizes); count > maxRecordedStorageResizes {
+			status.StorageAutoscaling.Resizes = status.StorageAutoscaling.Resizes[count-maxRecordedStorageResizes:]
+		}
+		// The update of the spec returns the persisted status, which doesn't contain the changes of the previous steps yet.
+		instance.Status = *status
+		return kube.Status().Update(ctx, instance)
+	}
+}
+
+// isStorageAutoscalingPossible returns true if the instance has storage autoscaling enabled and its volume is neither being expanded nor migrated.
+func isStorageAutoscalingPossible(instance *v1alpha1.PostgresqlStandalone) bool {
+	resources := instance.Spec.Parameters.Resources
+	observed := instance.Status.StorageCapacity
+	return resources.StorageAutoscaling != nil &&
+		resources.StorageCapacity != nil &&
+		instance.Status.DeploymentStrategy != v1alpha1.StrategyCloudNativePG &&
+		instance.Status.StorageMigration == nil &&
+		instance.Status.StorageResizePhase == "" &&
+		observed != nil && observed.Cmp(*resources.StorageCapacity) >= 0
+}
+
+// getAutoscaledStorageCapacity returns the increased StorageCapacity of the instance if the given usage reaches the threshold of its v1alpha1.StorageAutoscaling.
+// It returns nil if the capacity doesn't need to be increased,
+// and limitReached is true if the capacity needs to be increased but is already at the maximum.
+func getAutoscaledStorageCapacity(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone, usedPercentage int64) (capacity *resource.Quantity, limitReached bool) {
+	autoscaling := instance.Spec.Parameters.Resources.StorageAutoscaling
+	current := instance.Spec.Parameters.Resources.StorageCapacity
+	if usedPercentage < autoscaling.ThresholdPercentage {
+		return nil, false
+	}
+	increased := current.DeepCopy()
+	increased.Add(autoscaling.Increment)
+	for _, maximum := range []*resource.Quantity{autoscaling.Maximum, config.Spec.ResourceMaxima.StorageCapacity} {
+		if maximum != nil && increased.Cmp(*maximum) > 0 {
+			increased = maximum.DeepCopy()
+		}
+	}
+	if increased.Cmp(*current) <= 0 {
+		return nil, true
+	}
+	return &increased, false
+}
+
+// recordEvent records an event for the given object if there is an event recorder in the context.
+func recordEvent(ctx context.Context, obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder, exists := pipeline.LoadFromContext(ctx, EventRecorderKey{}); exists {
+		recorder.(record.EventRecorder).Eventf(obj, eventType, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,120 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+type StorageAutoscalingSuite struct {
+	operatortest.Suite
+}
+
+func TestStorageAutoscalingSuite(t *testing.T) {
+	suite.Run(t, new(StorageAutoscalingSuite))
+}
+
+func (ts *StorageAutoscalingSuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+}
+
+// fakeVolumeUsageReader is a VolumeUsageReader that returns a fixed usage.
+type fakeVolumeUsageReader struct {
+	usage VolumeUsage
+}
+
+func (f *fakeVolumeUsageReader) ReadVolumeUsage(_ context.Context, _ *corev1.Pod, _ string) (*VolumeUsage, error) {
+	return &f.usage, nil
+}
+
+func (ts *StorageAutoscalingSuite) Test_AutoscaleStorage() {
+	// Arrange
+	deploymentNamespace := "storage-autoscaling"
+	ts.EnsureNS("my-app")
+	ts.EnsureNS(deploymentNamespace)
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Resources.StorageCapacity = parseResource("10Gi")
+	instance.Spec.Parameters.Resources.StorageAutoscaling = &v1alpha1.StorageAutoscaling{ThresholdPercentage: 80, Increment: resource.MustParse("5Gi")}
+	ts.EnsureResources(instance)
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	instance.Status.StorageCapacity = parseResource("10Gi")
+	ts.UpdateStatus(instance)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: getPrimaryPodName(), Namespace: deploymentNamespace},
+		Spec: corev1.PodSpec{
+			NodeName:   "node",
+			Containers: []corev1.Container{{Name: "postgresql", Image: "postgres"}},
+		},
+	}
+	ts.EnsureResources(pod)
+	pvc := newPVC(deploymentNamespace)
+
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	config.Spec.ResourceMaxima.StorageCapacity = parseResource("12Gi")
+	reader := &fakeVolumeUsageReader{usage: VolumeUsage{CapacityBytes: 100, UsedBytes: 90}}
+	recorder := record.NewFakeRecorder(10)
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	pipeline.StoreInContext(ts.Context, PersistentVolumeClaimKey{}, pvc)
+	pipeline.StoreInContext(ts.Context, VolumeUsageReaderKey{}, reader)
+	pipeline.StoreInContext(ts.Context, EventRecorderKey{}, recorder)
+
+	// Act
+	err := AutoscaleStorageFn()(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	result := &v1alpha1.PostgresqlStandalone{}
+	ts.FetchResource(types.NamespacedName{Name: "instance", Namespace: "my-app"}, result)
+	ts.Assert().Equal("12Gi", result.Spec.Parameters.Resources.StorageCapacity.String(), "capacity limited by resource maxima")
+	ts.Require().NotNil(result.Status.StorageAutoscaling, "autoscaling status")
+	ts.Assert().Equal(int64(90), result.Status.StorageAutoscaling.UsedPercentage)
+	ts.Require().Len(result.Status.StorageAutoscaling.Resizes, 1)
+	resize := result.Status.StorageAutoscaling.Resizes[0]
+	ts.Assert().Equal("10Gi", resize.PreviousCapacity.String())
+	ts.Assert().Equal("12Gi", resize.Capacity.String())
+	ts.Assert().Equal(deploymentNamespace, result.Status.DeploymentNamespace, "status of previous steps is kept")
+	ts.Require().Len(recorder.Events, 1)
+	ts.Assert().Equal("Normal StorageAutoscaled Increased storage capacity from 10Gi to 12Gi, volume usage is 90%", <-recorder.Events)
+
+	// Act: observe again while the volume is being expanded
+	err = AutoscaleStorageFn()(ts.Context)
+	ts.Require().NoError(err)
+
+	// Assert
+	ts.FetchResource(types.NamespacedName{Name: "instance", Namespace: "my-app"}, result)
+	ts.Assert().Equal("12Gi", result.Spec.Parameters.Resources.StorageCapacity.String(), "capacity not increased during expansion")
+	ts.Assert().Len(result.Status.StorageAutoscaling.Resizes, 1)
+
+	// Act: observe twice at the maximum after the expansion
+	instance.Status.StorageCapacity = parseResource("12Gi")
+	ts.Require().NoError(AutoscaleStorageFn()(ts.Context))
+	ts.Require().NoError(AutoscaleStorageFn()(ts.Context))
+
+	// Assert
+	ts.FetchResource(types.NamespacedName{Name: "instance", Namespace: "my-app"}, result)
+	ts.Assert().True(result.Status.StorageAutoscaling.LimitReached, "limit reached")
+	ts.Require().Len(recorder.Events, 1, "warning recorded only once")
+	ts.Assert().Equal("Warning StorageAutoscalingLimitReached Volume usage is 90%, but storage capacity 12Gi cannot be increased beyond the maximum", <-recorder.Events)
+
+	// Act: observe usage below the threshold
+	reader.usage.UsedBytes = 50
+	ts.Require().NoError(AutoscaleStorageFn()(ts.Context))
+
+	// Assert
+	ts.FetchResource(types.NamespacedName{Name: "instance", Namespace: "my-app"}, result)
+	ts.Assert().False(result.Status.StorageAutoscaling.LimitReached, "limit no longer reached")
+	ts.Assert().Len(recorder.Events, 0)
+}
@@ -0,0 +1,111 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseVolumeUsage(t *testing.T) {
+	summary := `{"node":{"nodeName":"node"},"pods":[
+		{"podRef":{"name":"postgresql-0","namespace":"other"},"volume":[{"name":"data","pvcRef":{"name":"postgresql-data","namespace":"other"},"capacityBytes":100,"usedBytes":10}]},
+		{"podRef":{"name":"postgresql-0","namespace":"sv-postgresql-s-instance"},"volume":[
+			{"name":"dshm","capacityBytes":64,"usedBytes":0},
+			{"name":"data","pvcRef":{"name":"postgresql-data","namespace":"sv-postgresql-s-instance"},"capacityBytes":1000,"usedBytes":850}
+		]}
+	]}`
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "postgresql-0", Namespace: "sv-postgresql-s-instance"}}
+	tests := map[string]struct {
+		givenSummary   string
+		givenClaimName string
+		expectedUsage  *VolumeUsage
+		expectedError  string
+	}{
+		"GivenSummary_WhenPodMountsClaim_ThenExpectUsage": {
+			givenSummary:   summary,
+			givenClaimName: "postgresql-data",
+			expectedUsage:  &VolumeUsage{CapacityBytes: 1000, UsedBytes: 850},
+		},
+		"GivenSummary_WhenPodDoesNotMountClaim_ThenExpectNil": {
+			givenSummary:   summary,
+			givenClaimName: "postgresql-data-fast",
+		},
+		"GivenInvalidSummary_ThenExpectError": {
+			givenSummary:  "<html>",
+			expectedError: "cannot parse stats summary: invalid character '<' looking for beginning of value",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			usage, err := parseVolumeUsage([]byte(tc.givenSummary), pod, tc.givenClaimName)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedUsage, usage)
+		})
+	}
+}
+
+func TestGetAutoscaledStorageCapacity(t *testing.T) {
+	tests := map[string]struct {
+		givenUsedPercentage int64
+		givenMaximum        *resource.Quantity
+		givenConfigMaximum  *resource.Quantity
+		expectedCapacity    *resource.Quantity
+		expectedLimit       bool
+	}{
+		"GivenUsageBelowThreshold_ThenExpectNil": {
+			givenUsedPercentage: 79,
+		},
+		"GivenUsageAtThreshold_ThenExpectIncrement": {
+			givenUsedPercentage: 80,
+			expectedCapacity:    parseResource("15Gi"),
+		},
+		"GivenUsageAboveThreshold_WhenIncrementExceedsMaximum_ThenExpectMaximum": {
+			givenUsedPercentage: 95,
+			givenMaximum:        parseResource("12Gi"),
+			expectedCapacity:    parseResource("12Gi"),
+		},
+		"GivenUsageAboveThreshold_WhenIncrementExceedsConfigMaximum_ThenExpectConfigMaximum": {
+			givenUsedPercentage: 95,
+			givenMaximum:        parseResource("100Gi"),
+			givenConfigMaximum:  parseResource("11Gi"),
+			expectedCapacity:    parseResource("11Gi"),
+		},
+		"GivenUsageAboveThreshold_WhenCapacityAtMaximum_ThenExpectLimitReached": {
+			givenUsedPercentage: 95,
+			givenMaximum:        parseResource("10Gi"),
+			expectedLimit:       true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := &v1alpha1.PostgresqlStandalone{}
+			instance.Spec.Parameters.Resources.StorageCapacity = parseResource("10Gi")
+			instance.Spec.Parameters.Resources.StorageAutoscaling = &v1alpha1.StorageAutoscaling{
+				ThresholdPercentage: 80,
+				Increment:           resource.MustParse("5Gi"),
+				Maximum:             tc.givenMaximum,
+			}
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.ResourceMaxima.StorageCapacity = tc.givenConfigMaximum
+
+			capacity, limitReached := getAutoscaledStorageCapacity(config, instance, tc.givenUsedPercentage)
+
+			assert.Equal(t, tc.expectedLimit, limitReached, "limit reached")
+			if tc.expectedCapacity == nil {
+				assert.Nil(t, capacity)
+				return
+			}
+			require.NotNil(t, capacity)
+			assert.Equal(t, tc.expectedCapacity.String(), capacity.String())
+		})
+	}
+}
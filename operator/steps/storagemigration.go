@@ -0,0 +1,359 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// StorageMigrationLabelKey identifies the pods of the jobs that migrate the storage of an instance.
+	// The network policy of the deployment allows these pods to connect to PostgreSQL.
+	StorageMigrationLabelKey = "postgresql.appcat.vshn.io/storage-migration"
+	// migrationDefaultImageRepository is the repository of the image that backs up and restores the data if the config doesn't specify an image.
+	migrationDefaultImageRepository = "docker.io/bitnami/postgresql"
+	// migrationDumpDir is the directory where the migration jobs mount the PVC that holds the backup.
+	migrationDumpDir = "/migration"
+	// migrationSummaryScript prints the databases and the number of rows in each of their tables.
+	// The summaries before and after the migration have to be equal.
+	migrationSummaryScript = `dbs=$(psql -At -v ON_ERROR_STOP=1 --dbname=postgres -c "SELECT datname FROM pg_database WHERE datallowconn ORDER BY datname") && ` +
+		`printf '%s\n' "$dbs" | while IFS= read -r db; do echo "database $db" && psql -At -v ON_ERROR_STOP=1 --dbname="$db" -c "` +
+		`SELECT table_schema, table_name, (xpath('/row/c/text()', query_to_xml(format('SELECT count(*) AS c FROM %I.%I', table_schema, table_name), false, true, '')))[1]::text ` +
+		`FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema NOT IN ('pg_catalog', 'information_schema') ORDER BY 1, 2" || exit 1; done`
+	// migrationTerminateConnectionsCommand terminates the connections of clients that connected before the network policy blocked them.
+	migrationTerminateConnectionsCommand = `psql -v ON_ERROR_STOP=1 --dbname=postgres --output=/dev/null -c "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE pid <> pg_backend_pid() AND backend_type = 'client backend'"`
+	// migrationBackupCommand dumps all databases onto the migration PVC and records the summary of the source data.
+	migrationBackupCommand = migrationTerminateConnectionsCommand + " && pg_dumpall --clean --if-exists --file=" + migrationDumpDir + "/dump.sql && " +
+		"{ " + migrationSummaryScript + "; } > " + migrationDumpDir + "/source-summary.txt"
+	// migrationRestoreCommand restores the dump of migrationBackupCommand and fails if the restored data doesn't match the summary of the source data.
+	// The restore stops at the first error, except for dropping and creating the postgres role, which is the connected superuser and exists already.
+	migrationRestoreCommand = "sed -e '/^DROP ROLE IF EXISTS postgres;$/d' -e '/^CREATE ROLE postgres;$/d' " + migrationDumpDir + "/dump.sql | psql -v ON_ERROR_STOP=1 --dbname=postgres && " +
+		"{ " + migrationSummaryScript + "; } > " + migrationDumpDir + "/target-summary.txt && " +
+		"diff " + migrationDumpDir + "/source-summary.txt " + migrationDumpDir + "/target-summary.txt"
+)
+
+// migrationJobResources are the resources of the container of the migration jobs.
+// They're declared explicitly, so that the jobs can run under the ResourceQuota of the deployment namespace, see getResourceQuotaHard.
+var migrationJobResources = corev1.ResourceRequirements{
+	Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+	Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("256Mi")},
+}
+
+// MigrateStorageFn returns a func that migrates the data of the instance to another PVC if the storage class of the instance changes.
+// The migration spans multiple reconciliations and is tracked in the status of the instance:
+//  1. Once the deployment is ready, a PVC with the new storage class is created and clients are blocked from connecting to PostgreSQL.
+//     Once the deployment is ready again, a job dumps all databases onto a temporary PVC.
+//  2. The deployment is switched to the new PVC, on which PostgreSQL initializes an empty data directory.
+//  3. Once the deployment is ready again, a job restores the dump and verifies that every table has the same number of rows as before.
+//     Only after the verification succeeded, the previous PVC and the temporary resources are deleted.
+//
+// Only the migration jobs can connect to PostgreSQL until the migration is finished or failed, see isStorageMigrationInProgress.
+// This way, no changes are written after the backup, and the instance is marked as in maintenance meanwhile.
+// Hibernated instances aren't migrated until they are resumed.
+// If a job fails, the migration stops and the deployment is switched back to the previous PVC, which still holds the data as of the backup.
+// The new PVC and the migration resources are kept for inspection, they are deleted once the storage class of the instance changes again, which starts a new migration.
+func MigrateStorageFn(labelSet labels.Set) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		instance := GetInstanceFromContext(ctx)
+
+		migration := instance.Status.StorageMigration
+		if migration != nil && migration.Phase == v1alpha1.StorageMigrationPhaseFailed && migration.StorageClassName != instance.Spec.Parameters.Resources.StorageClassName {
+			// The storage class changed again after a failed migration, start over.
+			if err := deleteStorageMigrationResources(ctx, false); err != nil {
+				return err
+			}
+			instance.Status.StorageMigration = nil
+			migration = nil
+		}
+		if migration == nil {
+			if !isStorageMigrationRequired(instance) || instance.Spec.Parameters.Hibernated || !getDeploymentStrategyFromContext(ctx).IsReady(ctx) {
+				return nil
+			}
+			return startStorageMigration(ctx, labelSet)
+		}
+		switch migration.Phase {
+		case v1alpha1.StorageMigrationPhaseBackingUp:
+			return continueStorageBackup(ctx, labelSet)
+		case v1alpha1.StorageMigrationPhaseRestoring:
+			return continueStorageRestore(ctx, labelSet)
+		}
+		return nil
+	}
+}
+
+// isStorageMigrationInProgress returns true if the instance is backing up or restoring its data for a storage migration.
+func isStorageMigrationInProgress(instance *v1alpha1.PostgresqlStandalone) bool {
+	migration := instance.Status.StorageMigration
+	return migration != nil && migration.Phase != v1alpha1.StorageMigrationPhaseFailed
+}
+
+// isStorageMigrationRequired returns true if the instance specifies a storage class that differs from the observed storage class of its PVC.
+// Instances that are deployed with the v1alpha1.StrategyCloudNativePG manage their storage with CloudNativePG and are never migrated.
+func isStorageMigrationRequired(instance *v1alpha1.PostgresqlStandalone) bool {
+	desired, observed := instance.Spec.Parameters.Resources.StorageClassName, instance.Status.StorageClassName
+	return desired != "" && observed != "" && desired != observed && instance.Status.DeploymentStrategy != v1alpha1.StrategyCloudNativePG
+}
+
+func startStorageMigration(ctx context.Context, labelSet labels.Set) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	config := GetConfigFromContext(ctx)
+	ns := instance.Status.GetDeploymentNamespace()
+
+	storageClass := instance.Spec.Parameters.Resources.StorageClassName
+	migration := &v1alpha1.StorageMigrationStatus{
+		Phase:                  v1alpha1.StorageMigrationPhaseBackingUp,
+		StorageClassName:       storageClass,
+		SourceStorageClassName: instance.Status.StorageClassName,
+		SourceClaimName:        getInstancePVCName(instance),
+		TargetClaimName:        fmt.Sprintf("%s-%s", getPVCName(), storageClass),
+	}
+	for name, class := range map[string]*string{
+		getMigrationPVCName():     config.Spec.Persistence.StorageClassName,
+		migration.TargetClaimName: &storageClass,
+	} {
+		pvc := newPVC(ns)
+		pvc.Name = name
+		pvc.Spec.AccessModes = config.Spec.Persistence.AccessModes
+		pvc.Spec.StorageClassName = class
+		_, err := controllerutil.CreateOrUpdate(ctx, kube, pvc, func() error {
+			propagateMetadata(ctx, pvc)
+			pvc.Labels = labels.Merge(pvc.Labels, labelSet)
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = *instance.Spec.Parameters.Resources.StorageCapacity
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Block the clients first, the backup job runs once the deployment becomes ready again.
+	instance.Status.StorageMigration = migration
+	setMaintenanceCondition(instance, conditions.InMaintenance(), fmt.Sprintf("Backing up data for the migration to storage class %s", storageClass))
+	if err := kube.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	return getDeploymentStrategyFromContext(ctx).Ensure(ctx, labelSet)
+}
+
+func continueStorageBackup(ctx context.Context, labelSet labels.Set) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	migration := instance.Status.StorageMigration
+
+	if !getDeploymentStrategyFromContext(ctx).IsReady(ctx) {
+		return nil
+	}
+	if err := ensureMigrationJob(ctx, labelSet, getMigrationBackupJobName(), migrationBackupCommand); err != nil {
+		return err
+	}
+	job, err := getMigrationJob(ctx, getMigrationBackupJobName())
+	if err != nil {
+		return err
+	}
+	switch {
+	case isJobFinished(job, batchv1.JobFailed):
+		return failStorageMigration(ctx, labelSet, fmt.Sprintf("Backing up data for the migration to storage class %s failed, see job %s", migration.StorageClassName, job.Name))
+	case !isJobFinished(job, batchv1.JobComplete):
+		return nil
+	}
+
+	// Switch the deployment to the new PVC, the restore job runs once the deployment becomes ready again.
+	migration.Phase = v1alpha1.StorageMigrationPhaseRestoring
+	instance.Status.PersistentVolumeClaimName = migration.TargetClaimName
+	instance.Status.StorageClassName = migration.StorageClassName
+	setMaintenanceCondition(instance, conditions.InMaintenance(), fmt.Sprintf("Restoring data to storage class %s", migration.StorageClassName))
+	if err := kube.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	return getDeploymentStrategyFromContext(ctx).Ensure(ctx, labelSet)
+}
+
+func continueStorageRestore(ctx context.Context, labelSet labels.Set) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	migration := instance.Status.StorageMigration
+
+	if !getDeploymentStrategyFromContext(ctx).IsReady(ctx) {
+		return nil
+	}
+	if err := ensureMigrationJob(ctx, labelSet, getMigrationRestoreJobName(), migrationRestoreCommand); err != nil {
+		return err
+	}
+	job, err := getMigrationJob(ctx, getMigrationRestoreJobName())
+	if err != nil {
+		return err
+	}
+	switch {
+	case isJobFinished(job, batchv1.JobFailed):
+		return failStorageMigration(ctx, labelSet, fmt.Sprintf("Restoring data to storage class %s failed, see job %s. The instance was switched back to PVC %s", migration.StorageClassName, job.Name, migration.SourceClaimName))
+	case !isJobFinished(job, batchv1.JobComplete):
+		return nil
+	}
+
+	// The restore job only completes if the restored data matches the summary of the source data.
+	if err := deleteStorageMigrationResources(ctx, true); err != nil {
+		return err
+	}
+	instance.Status.StorageMigration = nil
+	setMaintenanceCondition(instance, conditions.MaintenanceSuccess(), fmt.Sprintf("Migrated data to storage class %s", migration.StorageClassName))
+	if err := kube.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	// Allow the clients to connect again.
+	return getDeploymentStrategyFromContext(ctx).Ensure(ctx, labelSet)
+}
+
+// failStorageMigration stops the migration and allows the clients to connect to PostgreSQL again.
+// If the deployment already uses the target PVC, it is switched back to the source PVC first,
+// since the target PVC may only hold part of the data.
+func failStorageMigration(ctx context.Context, labelSet labels.Set, message string) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	migration := instance.Status.StorageMigration
+
+	if migration.Phase == v1alpha1.StorageMigrationPhaseRestoring {
+		instance.Status.PersistentVolumeClaimName = migration.SourceClaimName
+		instance.Status.StorageClassName = migration.SourceStorageClassName
+	}
+	migration.Phase = v1alpha1.StorageMigrationPhaseFailed
+	setMaintenanceCondition(instance, conditions.MaintenanceFailed(message), message)
+	if err := kube.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	return getDeploymentStrategyFromContext(ctx).Ensure(ctx, labelSet)
+}
+
+// deleteStorageMigrationResources deletes the jobs and the temporary PVC of the migration in the status of the instance.
+// If the migration succeeded, the source PVC is deleted, otherwise the target PVC is deleted unless the instance already uses it.
+func deleteStorageMigrationResources(ctx context.Context, succeeded bool) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	migration := instance.Status.StorageMigration
+	ns := instance.Status.GetDeploymentNamespace()
+
+	claims := []string{getMigrationPVCName()}
+	if succeeded {
+		claims = append(claims, migration.SourceClaimName)
+	} else if migration.TargetClaimName != getInstancePVCName(instance) {
+		claims = append(claims, migration.TargetClaimName)
+	}
+	objects := []client.Object{
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getMigrationBackupJobName(), Namespace: ns}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: getMigrationRestoreJobName(), Namespace: ns}},
+	}
+	for _, name := range claims {
+		pvc := newPVC(ns)
+		pvc.Name = name
+		objects = append(objects, pvc)
+	}
+	for _, obj := range objects {
+		if err := kube.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureMigrationJob creates a job that runs the given command against PostgreSQL as superuser with the temporary migration PVC mounted at migrationDumpDir.
+// Existing jobs are left unchanged, since the pod template of a job is immutable.
+// It returns an error if a job of a previous migration is still being deleted.
+func ensureMigrationJob(ctx context.Context, labelSet labels.Set, name, command string) error {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+	config := GetConfigFromContext(ctx)
+	ns := instance.Status.GetDeploymentNamespace()
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+	err := kube.Get(ctx, client.ObjectKeyFromObject(job), job)
+	if err == nil && !job.DeletionTimestamp.IsZero() {
+		return fmt.Errorf("job %s of a previous storage migration is still being deleted", name)
+	}
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+	job.Labels = labelSet
+	podLabels := labels.Merge(labelSet, labels.Set{StorageMigrationLabelKey: "true"})
+	setMigrationJobSpec(job, instance, config, getDeploymentStrategyFromContext(ctx).ServiceName(), podLabels, command)
+	return kube.Create(ctx, job)
+}
+
+func setMigrationJobSpec(job *batchv1.Job, instance *v1alpha1.PostgresqlStandalone, config *v1alpha1.PostgresqlStandaloneOperatorConfig, serviceName string, podLabels labels.Set, command string) {
+	image := config.Spec.Persistence.MigrationImage
+	if image == "" {
+		image = fmt.Sprintf("%s:%s", migrationDefaultImageRepository, strings.TrimPrefix(instance.Spec.Parameters.MajorVersion.String(), "v"))
+	}
+	job.Spec.BackoffLimit = pointer.Int32(2)
+	job.Spec.Template.Labels = podLabels
+	job.Spec.Template.Spec = corev1.PodSpec{
+		RestartPolicy:   corev1.RestartPolicyNever,
+		SecurityContext: newRestrictedPodSecurityContext(),
+		Volumes: []corev1.Volume{
+			{Name: "migration", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: getMigrationPVCName()}}},
+		},
+		Containers: []corev1.Container{{
+			Name:            "migration",
+			Image:           image,
+			SecurityContext: newRestrictedSecurityContext(),
+			Command:         []string{"/bin/sh", "-c", command},
+			Env: []corev1.EnvVar{
+				{Name: "PGHOST", Value: serviceName},
+				{Name: "PGPORT", Value: fmt.Sprintf("%d", postgresqlPort)},
+				{Name: "PGUSER", Value: "postgres"},
+				{Name: "PGPASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: getCredentialSecretName()},
+					Key:                  "postgres-password",
+				}}},
+			},
+			VolumeMounts: []corev1.VolumeMount{{Name: "migration", MountPath: migrationDumpDir}},
+			Resources:    *migrationJobResources.DeepCopy(),
+		}},
+	}
+}
+
+func getMigrationJob(ctx context.Context, name string) (*batchv1.Job, error) {
+	kube := GetClientFromContext(ctx)
+	instance := GetInstanceFromContext(ctx)
+
+	job := &batchv1.Job{}
+	err := kube.Get(ctx, client.ObjectKey{Name: name, Namespace: instance.Status.GetDeploymentNamespace()}, job)
+	return job, err
+}
+
+// isJobFinished returns true if the job has a true condition of the given type.
+func isJobFinished(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func setMaintenanceCondition(instance *v1alpha1.PostgresqlStandalone, condition metav1.Condition, message string) {
+	meta.SetStatusCondition(&instance.Status.Conditions, conditions.Builder().With(condition).WithMessage(message).WithGeneration(instance).Build())
+}
+
+func getMigrationPVCName() string {
+	return fmt.Sprintf("%s-migration", getDeploymentName())
+}
+
+func getMigrationBackupJobName() string {
+	return fmt.Sprintf("%s-migration-backup", getDeploymentName())
+}
+
+func getMigrationRestoreJobName() string {
+	return fmt.Sprintf("%s-migration-restore", getDeploymentName())
+}
@@ -0,0 +1,237 @@
+//go:build integration
+
+package steps
+
+import (
+	"context"
+	"testing"
+
+	pipeline "github.com/ccremer/go-command-pipeline"
+	"github.com/stretchr/testify/suite"
+	"github.com/vshn/appcat-service-postgresql/apis/conditions"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	"github.com/vshn/appcat-service-postgresql/operator/operatortest"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type StorageMigrationSuite struct {
+	operatortest.Suite
+}
+
+func TestStorageMigrationSuite(t *testing.T) {
+	suite.Run(t, new(StorageMigrationSuite))
+}
+
+func (ts *StorageMigrationSuite) BeforeTest(suiteName, testName string) {
+	ts.Context = pipeline.MutableContext(context.Background())
+	SetClientInContext(ts.Context, ts.Client)
+	ts.RegisterScheme(batchv1.AddToScheme)
+}
+
+// fakeStrategy is a DeploymentStrategy that only records invocations of Ensure.
+type fakeStrategy struct {
+	ready   bool
+	ensured int
+}
+
+func (f *fakeStrategy) Ensure(_ context.Context, _ labels.Set) error { f.ensured++; return nil }
+func (f *fakeStrategy) Observe(_ context.Context) error              { return nil }
+func (f *fakeStrategy) IsReady(_ context.Context) bool               { return f.ready }
+func (f *fakeStrategy) Delete(_ context.Context) error               { return nil }
+func (f *fakeStrategy) ServiceName() string                          { return getDeploymentName() }
+
+func (ts *StorageMigrationSuite) Test_MigrateStorage() {
+	// Arrange
+	deploymentNamespace := "storage-migration"
+	ts.EnsureNS("my-app")
+	ts.EnsureNS(deploymentNamespace)
+	instance := newInstance("instance", "my-app")
+	instance.Spec.Parameters.Resources.StorageClassName = "fast"
+	ts.EnsureResources(instance)
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	instance.Status.StorageClassName = "standard"
+	ts.UpdateStatus(instance)
+	source := newPVC(deploymentNamespace)
+	source.Name = getPVCName()
+	source.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	source.Spec.Resources.Requests[corev1.ResourceStorage] = *instance.Spec.Parameters.Resources.StorageCapacity
+	ts.EnsureResources(source)
+
+	config := newPostgresqlStandaloneOperatorConfig("config", "postgresql-system")
+	config.Spec.Persistence.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	strategy := &fakeStrategy{ready: true}
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, config)
+	pipeline.StoreInContext(ts.Context, DeploymentStrategyKey{}, strategy)
+	migrate := MigrateStorageFn(labels.Set{"test": "label"})
+
+	// Act: start migration
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Require().NotNil(instance.Status.StorageMigration, "migration status")
+	ts.Assert().Equal(v1alpha1.StorageMigrationPhaseBackingUp, instance.Status.StorageMigration.Phase)
+	ts.Assert().Equal("postgresql-data-fast", instance.Status.StorageMigration.TargetClaimName)
+	ts.Assert().True(meta.IsStatusConditionTrue(instance.Status.Conditions, conditions.TypeInMaintenance), "in maintenance")
+	ts.Assert().True(isStorageMigrationInProgress(instance), "clients blocked")
+	ts.Assert().Equal(1, strategy.ensured, "deployment updated to block clients")
+	target := &corev1.PersistentVolumeClaim{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql-data-fast", Namespace: deploymentNamespace}, target)
+	ts.Assert().Equal("fast", *target.Spec.StorageClassName)
+	backupJob := &batchv1.Job{}
+	err := ts.Client.Get(ts.Context, types.NamespacedName{Name: getMigrationBackupJobName(), Namespace: deploymentNamespace}, backupJob)
+	AssertResourceNotExists(ts.T(), backupJob.DeletionTimestamp, err)
+
+	// Act: start backup
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.FetchResource(types.NamespacedName{Name: getMigrationBackupJobName(), Namespace: deploymentNamespace}, backupJob)
+	ts.Assert().Equal("true", backupJob.Spec.Template.Labels[StorageMigrationLabelKey])
+	ts.Assert().Equal("docker.io/bitnami/postgresql:14", backupJob.Spec.Template.Spec.Containers[0].Image)
+
+	// Act: finish backup
+	ts.completeJob(backupJob)
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Assert().Equal(v1alpha1.StorageMigrationPhaseRestoring, instance.Status.StorageMigration.Phase)
+	ts.Assert().Equal("postgresql-data-fast", instance.Status.PersistentVolumeClaimName)
+	ts.Assert().Equal("fast", instance.Status.StorageClassName)
+	ts.Assert().Equal(2, strategy.ensured, "deployment switched to new claim")
+
+	// Act: start and finish restore
+	ts.Require().NoError(migrate(ts.Context))
+	restoreJob := &batchv1.Job{}
+	ts.FetchResource(types.NamespacedName{Name: getMigrationRestoreJobName(), Namespace: deploymentNamespace}, restoreJob)
+	ts.completeJob(restoreJob)
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Assert().Nil(instance.Status.StorageMigration, "migration status")
+	condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeInMaintenance)
+	ts.Require().NotNil(condition)
+	ts.Assert().Equal(conditions.ReasonMaintenanceSuccess, condition.Reason)
+	ts.Assert().Equal(3, strategy.ensured, "deployment updated to allow clients")
+	for _, name := range []string{getPVCName(), getMigrationPVCName()} {
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := ts.Client.Get(ts.Context, types.NamespacedName{Name: name, Namespace: deploymentNamespace}, pvc)
+		AssertResourceNotExists(ts.T(), pvc.DeletionTimestamp, err)
+	}
+}
+
+func (ts *StorageMigrationSuite) Test_MigrateStorage_WhenBackupFails_ThenKeepSourceClaimUntilStorageClassChanges() {
+	// Arrange
+	deploymentNamespace := "storage-migration-failure"
+	ts.EnsureNS("my-app")
+	ts.EnsureNS(deploymentNamespace)
+	instance := newInstance("failing-instance", "my-app")
+	instance.Spec.Parameters.Resources.StorageClassName = "fast"
+	ts.EnsureResources(instance)
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	instance.Status.StorageClassName = "standard"
+	ts.UpdateStatus(instance)
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, newPostgresqlStandaloneOperatorConfig("config", "postgresql-system"))
+	strategy := &fakeStrategy{ready: true}
+	pipeline.StoreInContext(ts.Context, DeploymentStrategyKey{}, strategy)
+	migrate := MigrateStorageFn(labels.Set{})
+	ts.Require().NoError(migrate(ts.Context))
+	ts.Require().NoError(migrate(ts.Context))
+	backupJob := &batchv1.Job{}
+	ts.FetchResource(types.NamespacedName{Name: getMigrationBackupJobName(), Namespace: deploymentNamespace}, backupJob)
+
+	// Act
+	backupJob.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+	ts.UpdateStatus(backupJob)
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Assert().Equal(v1alpha1.StorageMigrationPhaseFailed, instance.Status.StorageMigration.Phase)
+	ts.Assert().Equal(getPVCName(), getInstancePVCName(instance), "claim of instance")
+	condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeInMaintenance)
+	ts.Require().NotNil(condition)
+	ts.Assert().Equal(conditions.ReasonMaintenanceFailure, condition.Reason)
+	ts.Assert().Contains(condition.Message, getMigrationBackupJobName())
+	ts.Assert().False(isStorageMigrationInProgress(instance), "clients allowed")
+	ts.Assert().Equal(2, strategy.ensured, "deployment updated to allow clients")
+
+	// Act: choose another storage class
+	instance.Spec.Parameters.Resources.StorageClassName = "bulk"
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Assert().Equal(v1alpha1.StorageMigrationPhaseBackingUp, instance.Status.StorageMigration.Phase)
+	ts.Assert().Equal("bulk", instance.Status.StorageMigration.StorageClassName)
+	target := &corev1.PersistentVolumeClaim{}
+	err := ts.Client.Get(ts.Context, types.NamespacedName{Name: "postgresql-data-fast", Namespace: deploymentNamespace}, target)
+	AssertResourceNotExists(ts.T(), target.DeletionTimestamp, err)
+}
+
+func (ts *StorageMigrationSuite) Test_MigrateStorage_WhenRestoreFails_ThenSwitchBackToSourceClaim() {
+	// Arrange
+	deploymentNamespace := "storage-migration-restore-failure"
+	ts.EnsureNS("my-app")
+	ts.EnsureNS(deploymentNamespace)
+	instance := newInstance("failing-restore-instance", "my-app")
+	instance.Spec.Parameters.Resources.StorageClassName = "fast"
+	ts.EnsureResources(instance)
+	instance.Status.DeploymentNamespace = deploymentNamespace
+	instance.Status.StorageClassName = "standard"
+	ts.UpdateStatus(instance)
+	SetInstanceInContext(ts.Context, instance)
+	pipeline.StoreInContext(ts.Context, ConfigKey{}, newPostgresqlStandaloneOperatorConfig("config", "postgresql-system"))
+	strategy := &fakeStrategy{ready: true}
+	pipeline.StoreInContext(ts.Context, DeploymentStrategyKey{}, strategy)
+	migrate := MigrateStorageFn(labels.Set{})
+	ts.Require().NoError(migrate(ts.Context))
+	ts.Require().NoError(migrate(ts.Context))
+	backupJob := &batchv1.Job{}
+	ts.FetchResource(types.NamespacedName{Name: getMigrationBackupJobName(), Namespace: deploymentNamespace}, backupJob)
+	ts.completeJob(backupJob)
+	ts.Require().NoError(migrate(ts.Context))
+	ts.Require().NoError(migrate(ts.Context))
+	ts.Require().Equal("postgresql-data-fast", instance.Status.PersistentVolumeClaimName)
+	restoreJob := &batchv1.Job{}
+	ts.FetchResource(types.NamespacedName{Name: getMigrationRestoreJobName(), Namespace: deploymentNamespace}, restoreJob)
+
+	// Act
+	restoreJob.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+	ts.UpdateStatus(restoreJob)
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Assert().Equal(v1alpha1.StorageMigrationPhaseFailed, instance.Status.StorageMigration.Phase)
+	ts.Assert().Equal(getPVCName(), instance.Status.PersistentVolumeClaimName, "claim of instance")
+	ts.Assert().Equal("standard", instance.Status.StorageClassName, "storage class of instance")
+	condition := meta.FindStatusCondition(instance.Status.Conditions, conditions.TypeInMaintenance)
+	ts.Require().NotNil(condition)
+	ts.Assert().Equal(conditions.ReasonMaintenanceFailure, condition.Reason)
+	ts.Assert().Contains(condition.Message, getMigrationRestoreJobName())
+	ts.Assert().False(isStorageMigrationInProgress(instance), "clients allowed")
+	ts.Assert().Equal(3, strategy.ensured, "deployment switched back to source claim")
+	target := &corev1.PersistentVolumeClaim{}
+	ts.FetchResource(types.NamespacedName{Name: "postgresql-data-fast", Namespace: deploymentNamespace}, target)
+
+	// Act: reconcile again
+	ts.Require().NoError(migrate(ts.Context))
+
+	// Assert
+	ts.Assert().Equal(v1alpha1.StorageMigrationPhaseFailed, instance.Status.StorageMigration.Phase, "migration not restarted")
+	ts.Assert().Equal(3, strategy.ensured, "deployment unchanged")
+}
+
+func (ts *StorageMigrationSuite) completeJob(job *batchv1.Job) {
+	now := metav1.Now()
+	job.Status.StartTime = &now
+	job.Status.CompletionTime = &now
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	ts.UpdateStatus(job)
+	ts.Require().NoError(ts.Client.Get(ts.Context, client.ObjectKeyFromObject(job), job))
+}
@@ -0,0 +1,162 @@
+package steps
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Defaults of v1alpha1.TuningSpec.
+const (
+	defaultSharedBuffersPercentage      = 25
+	defaultEffectiveCacheSizePercentage = 75
+	defaultMaintenanceWorkMemPercentage = 5
+	defaultWorkMemPercentage            = 25
+	defaultConnectionsPerGiB            = 100
+	defaultMinConnections               = 20
+	defaultMaxConnections               = 500
+	// minWorkMemKB is the minimum value of `work_mem` that PostgreSQL accepts.
+	minWorkMemKB = 64
+	// minWorkerProcesses is the default of `max_worker_processes`, which is kept for small instances.
+	minWorkerProcesses = 8
+)
+
+// Markers of the blocks in a PostgreSQL configuration that contain the settings managed by the operator, see withManagedSettings.
+const (
+	derivedSettingsBegin  = "# BEGIN settings derived by " + v1alpha1.Group
+	derivedSettingsEnd    = "# END settings derived by " + v1alpha1.Group
+	instanceSettingsBegin = "# BEGIN settings of the PostgresqlStandalone instance"
+	instanceSettingsEnd   = "# END settings of the PostgresqlStandalone instance"
+)
+
+// getPostgresqlSettings returns the PostgreSQL settings of the instance.
+// The settings that are derived from the resources (see deriveSettings) are overridden by the given parameters of the platform,
+// which are overridden by the PostgresqlSettings of the instance.
+func getPostgresqlSettings(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone, platformParameters map[string]string) map[string]string {
+	settings := deriveSettings(config, instance)
+	for _, parameters := range []map[string]string{platformParameters, instance.Spec.Parameters.PostgresqlSettings} {
+		for name, value := range parameters {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// getDerivedSettings returns the settings that are derived from the resources of the instance without the settings that the instance overrides.
+func getDerivedSettings(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) map[string]string {
+	settings := deriveSettings(config, instance)
+	for name := range instance.Spec.Parameters.PostgresqlSettings {
+		delete(settings, name)
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+	return settings
+}
+
+// deriveSettings computes memory and connection settings from the memory and settings for parallel workers from the CPU of the instance.
+// The formula is configured with the v1alpha1.TuningSpec of the config.
+// It returns an empty map if tuning is disabled.
+func deriveSettings(config *v1alpha1.PostgresqlStandaloneOperatorConfig, instance *v1alpha1.PostgresqlStandalone) map[string]string {
+	settings := map[string]string{}
+	tuning := config.Spec.Tuning
+	if tuning.Disabled {
+		return settings
+	}
+	resources := getComputeResources(config, instance)
+
+	if memory := getLimitOrRequest(resources, corev1.ResourceMemory); memory != nil {
+		memoryKB := memory.Value() / 1024
+		sharedBuffersKB := memoryKB * withDefault(tuning.SharedBuffersPercentage, defaultSharedBuffersPercentage) / 100
+		connections := memoryKB * withDefault(tuning.ConnectionsPerGiB, defaultConnectionsPerGiB) / (1024 * 1024)
+		connections = clamp(connections, withDefault(tuning.MinConnections, defaultMinConnections), withDefault(tuning.MaxConnections, defaultMaxConnections))
+		workMemKB := (memoryKB - sharedBuffersKB) * withDefault(tuning.WorkMemPercentage, defaultWorkMemPercentage) / 100 / connections
+
+		settings["shared_buffers"] = formatKB(sharedBuffersKB)
+		settings["effective_cache_size"] = formatKB(memoryKB * withDefault(tuning.EffectiveCacheSizePercentage, defaultEffectiveCacheSizePercentage) / 100)
+		settings["maintenance_work_mem"] = formatKB(memoryKB * withDefault(tuning.MaintenanceWorkMemPercentage, defaultMaintenanceWorkMemPercentage) / 100)
+		settings["work_mem"] = formatKB(max64(workMemKB, minWorkMemKB))
+		settings["max_connections"] = fmt.Sprintf("%d", connections)
+	}
+	if cpu := getLimitOrRequest(resources, corev1.ResourceCPU); cpu != nil {
+		// Parallel workers are whole processes, so partial CPUs are rounded up.
+		cpus := (cpu.MilliValue() + 999) / 1000
+		settings["max_worker_processes"] = fmt.Sprintf("%d", max64(cpus, minWorkerProcesses))
+		settings["max_parallel_workers"] = fmt.Sprintf("%d", cpus)
+		settings["max_parallel_workers_per_gather"] = fmt.Sprintf("%d", max64(cpus/2, 1))
+	}
+	return settings
+}
+
+// withManagedSettings returns the given PostgreSQL configuration with the blocks of settings managed by the operator replaced by the given settings.
+// The derived settings are prepended and the settings of the instance are appended to the rest of the configuration.
+// Since PostgreSQL uses the last occurrence of a setting, the rest of the configuration overrides derived settings, and the settings of the instance override everything.
+func withManagedSettings(configuration string, derived, instanceSettings map[string]string) string {
+	configuration = removeSettingsBlock(configuration, derivedSettingsBegin, derivedSettingsEnd)
+	configuration = removeSettingsBlock(configuration, instanceSettingsBegin, instanceSettingsEnd)
+	if configuration != "" && !strings.HasSuffix(configuration, "\n") {
+		configuration += "\n"
+	}
+	return renderSettingsBlock(derived, derivedSettingsBegin, derivedSettingsEnd) + configuration + renderSettingsBlock(instanceSettings, instanceSettingsBegin, instanceSettingsEnd)
+}
+
+func removeSettingsBlock(configuration, begin, end string) string {
+	start := strings.Index(configuration, begin)
+	if start < 0 {
+		return configuration
+	}
+	rest := configuration[start:]
+	stop := strings.Index(rest, end)
+	if stop < 0 {
+		return configuration[:start]
+	}
+	return configuration[:start] + strings.TrimPrefix(rest[stop+len(end):], "\n")
+}
+
+func renderSettingsBlock(settings map[string]string, begin, end string) string {
+	if len(settings) == 0 {
+		return ""
+	}
+	return begin + "\n" + renderPostgresqlParameters(settings) + end + "\n"
+}
+
+func getLimitOrRequest(requirements corev1.ResourceRequirements, name corev1.ResourceName) *resource.Quantity {
+	if quantity, exists := requirements.Limits[name]; exists {
+		return &quantity
+	}
+	if quantity, exists := requirements.Requests[name]; exists {
+		return &quantity
+	}
+	return nil
+}
+
+func formatKB(kb int64) string {
+	return fmt.Sprintf("%dkB", kb)
+}
+
+func withDefault(value, defaultValue int64) int64 {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func clamp(value, lower, upper int64) int64 {
+	if value < lower {
+		return lower
+	}
+	if value > upper {
+		return upper
+	}
+	return value
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,136 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vshn/appcat-service-postgresql/apis/postgresql/v1alpha1"
+)
+
+func TestDeriveSettings(t *testing.T) {
+	tests := map[string]struct {
+		givenResources   v1alpha1.ComputeResources
+		givenTuning      v1alpha1.TuningSpec
+		expectedSettings map[string]string
+	}{
+		"GivenNoResources_ThenExpectNoSettings": {
+			expectedSettings: map[string]string{},
+		},
+		"GivenMemoryLimit_ThenExpectMemorySettings": {
+			givenResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("4Gi")},
+			expectedSettings: map[string]string{
+				"shared_buffers":       "1048576kB",
+				"effective_cache_size": "3145728kB",
+				"maintenance_work_mem": "209715kB",
+				"work_mem":             "1966kB",
+				"max_connections":      "400",
+			},
+		},
+		"GivenSmallMemoryRequest_ThenExpectMinimumConnectionsAndWorkMem": {
+			givenResources: v1alpha1.ComputeResources{MemoryRequest: parseResource("64Mi")},
+			expectedSettings: map[string]string{
+				"shared_buffers":       "16384kB",
+				"effective_cache_size": "49152kB",
+				"maintenance_work_mem": "3276kB",
+				"work_mem":             "614kB",
+				"max_connections":      "20",
+			},
+		},
+		"GivenCPULimit_ThenExpectWorkerSettings": {
+			givenResources: v1alpha1.ComputeResources{CPULimit: parseResource("2500m")},
+			expectedSettings: map[string]string{
+				"max_worker_processes":            "8",
+				"max_parallel_workers":            "3",
+				"max_parallel_workers_per_gather": "1",
+			},
+		},
+		"GivenTuning_ThenExpectSettingsFromFormula": {
+			givenResources: v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi"), CPULimit: parseResource("16")},
+			givenTuning:    v1alpha1.TuningSpec{SharedBuffersPercentage: 40, ConnectionsPerGiB: 10, MinConnections: 50},
+			expectedSettings: map[string]string{
+				"shared_buffers":                  "419430kB",
+				"effective_cache_size":            "786432kB",
+				"maintenance_work_mem":            "52428kB",
+				"work_mem":                        "3145kB",
+				"max_connections":                 "50",
+				"max_worker_processes":            "16",
+				"max_parallel_workers":            "16",
+				"max_parallel_workers_per_gather": "8",
+			},
+		},
+		"GivenResources_WhenTuningDisabled_ThenExpectNoSettings": {
+			givenResources:   v1alpha1.ComputeResources{MemoryLimit: parseResource("1Gi"), CPULimit: parseResource("1")},
+			givenTuning:      v1alpha1.TuningSpec{Disabled: true},
+			expectedSettings: map[string]string{},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := &v1alpha1.PostgresqlStandalone{}
+			instance.Spec.Parameters.Resources.ComputeResources = tc.givenResources
+			config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+			config.Spec.Tuning = tc.givenTuning
+
+			assert.Equal(t, tc.expectedSettings, deriveSettings(config, instance))
+		})
+	}
+}
+
+func TestGetPostgresqlSettings(t *testing.T) {
+	instance := &v1alpha1.PostgresqlStandalone{}
+	instance.Spec.Parameters.Resources.MemoryLimit = parseResource("1Gi")
+	instance.Spec.Parameters.PostgresqlSettings = map[string]string{"work_mem": "16MB"}
+	config := &v1alpha1.PostgresqlStandaloneOperatorConfig{}
+
+	settings := getPostgresqlSettings(config, instance, map[string]string{"max_connections": "50", "work_mem": "8MB"})
+	assert.Equal(t, "50", settings["max_connections"], "platform parameters override derived settings")
+	assert.Equal(t, "16MB", settings["work_mem"], "instance settings override everything")
+	assert.Equal(t, "262144kB", settings["shared_buffers"], "derived settings")
+
+	derived := getDerivedSettings(config, instance)
+	assert.NotContains(t, derived, "work_mem", "settings of the instance are not reported as derived")
+	assert.Contains(t, derived, "shared_buffers")
+}
+
+func TestWithManagedSettings(t *testing.T) {
+	derived := map[string]string{"shared_buffers": "128MB"}
+	instanceSettings := map[string]string{"work_mem": "4MB"}
+	expected := "# BEGIN settings derived by postgresql.appcat.vshn.io\nshared_buffers = '128MB'\n# END settings derived by postgresql.appcat.vshn.io\n" +
+		"log_connections = on\n" +
+		"# BEGIN settings of the PostgresqlStandalone instance\nwork_mem = '4MB'\n# END settings of the PostgresqlStandalone instance\n"
+	tests := map[string]struct {
+		givenConfiguration string
+		derived            map[string]string
+		instanceSettings   map[string]string
+		expectedResult     string
+	}{
+		"GivenNoSettings_ThenExpectConfigurationUnchanged": {
+			givenConfiguration: "log_connections = on",
+			expectedResult:     "log_connections = on\n",
+		},
+		"GivenConfiguration_WhenNoManagedBlocks_ThenExpectBlocksAdded": {
+			givenConfiguration: "log_connections = on",
+			derived:            derived,
+			instanceSettings:   instanceSettings,
+			expectedResult:     expected,
+		},
+		"GivenConfiguration_WhenManagedBlocksExist_ThenExpectBlocksReplaced": {
+			givenConfiguration: "# BEGIN settings derived by postgresql.appcat.vshn.io\nshared_buffers = '64MB'\n# END settings derived by postgresql.appcat.vshn.io\n" +
+				"log_connections = on\n" +
+				"# BEGIN settings of the PostgresqlStandalone instance\nwork_mem = '1MB'\n# END settings of the PostgresqlStandalone instance\n",
+			derived:          derived,
+			instanceSettings: instanceSettings,
+			expectedResult:   expected,
+		},
+		"GivenManagedBlocks_WhenNoSettings_ThenExpectBlocksRemoved": {
+			givenConfiguration: expected,
+			expectedResult:     "log_connections = on\n",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := withManagedSettings(tc.givenConfiguration, tc.derived, tc.instanceSettings)
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
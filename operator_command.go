@@ -53,10 +53,41 @@ func newOperatorCommand() *cli.Command {
 				Usage:       "OperatorNamespace name where the operator runs in.",
 				Destination: &standalone.OperatorNamespace, Required: true,
 			},
+			&cli.StringFlag{Name: "operator-service-account", EnvVars: []string{"OPERATOR_SERVICE_ACCOUNT"},
+				Usage:       "Name of the service account that the operator runs with. Only the operator is allowed to change its resources in the deployment namespaces. If empty, all service accounts in the operator namespace are allowed.",
+				Destination: &standalone.OperatorServiceAccount,
+			},
 			&cli.StringFlag{Name: "service-namespace-prefix", EnvVars: envVars("SERVICE_NAMESPACE_PREFIX"),
 				Usage: "Prefix of namespaces where the actual PostgreSQL deployments are deployed in.",
 				Value: standalone.ServiceNamespacePrefix, Destination: &standalone.ServiceNamespacePrefix,
 			},
+			&cli.StringFlag{Name: "service-namespace-naming", EnvVars: envVars("SERVICE_NAMESPACE_NAMING"),
+				Usage: "Naming scheme of namespaces where the actual PostgreSQL deployments are deployed in. " +
+					"Either 'codename' for a random codename, 'hash' for a hash of the namespace and name of the instance, " +
+					"or a template with the placeholders {prefix}, {org}, {namespace} and {name}, e.g. '{prefix}{org}-{name}'.",
+				Value: standalone.NamespaceNamingScheme, Destination: &standalone.NamespaceNamingScheme,
+			},
+			&cli.StringSliceFlag{Name: "admin-groups", EnvVars: envVars("ADMIN_GROUPS"),
+				Usage: "Groups of platform admins, which are allowed to pin instances to a chart version and to change the resources in the deployment namespaces.",
+				Value: cli.NewStringSlice(standalone.AdminGroups...),
+			},
+			&cli.StringSliceFlag{Name: "trusted-users", EnvVars: envVars("TRUSTED_USERS"),
+				Usage: "Users besides the operator which are allowed to change the resources in the deployment namespaces.",
+				Value: cli.NewStringSlice(standalone.TrustedUsers...),
+			},
+			&cli.StringSliceFlag{Name: "trusted-service-account-namespaces", EnvVars: envVars("TRUSTED_SERVICE_ACCOUNT_NAMESPACES"),
+				Usage: "Namespaces whose service accounts are allowed to change the resources in the deployment namespaces, " +
+					"like the namespaces of provider-helm, CloudNativePG, K8up and CSI drivers.",
+				Value: cli.NewStringSlice(standalone.TrustedServiceAccountNamespaces...),
+			},
+			&cli.StringFlag{Name: "helm-cache-dir", EnvVars: envVars("HELM_CACHE_DIR"),
+				Usage: "Directory where charts and repository indexes of the HelmSDK deployment strategy are cached.",
+				Value: standalone.HelmCacheDir, Destination: &standalone.HelmCacheDir,
+			},
+			&cli.DurationFlag{Name: "storage-autoscaling-interval", EnvVars: envVars("STORAGE_AUTOSCALING_INTERVAL"),
+				Usage: "How often the storage usage of instances with storage autoscaling is checked.",
+				Value: standalone.StorageAutoscalingInterval, Destination: &standalone.StorageAutoscalingInterval,
+			},
 		},
 	}
 }
@@ -65,11 +96,14 @@ func (c *operatorCommand) validate(ctx *cli.Context) error {
 	_ = LogMetadata(ctx)
 	log := AppLogger(ctx).WithName(operatorCommandName)
 	log.V(1).Info("validating config")
-	return nil
+	return standalone.ValidateNamespaceNamingScheme(standalone.NamespaceNamingScheme)
 }
 
 func (c *operatorCommand) execute(ctx *cli.Context) error {
 	log := AppLogger(ctx).WithName(operatorCommandName)
+	standalone.AdminGroups = ctx.StringSlice("admin-groups")
+	standalone.TrustedUsers = ctx.StringSlice("trusted-users")
+	standalone.TrustedServiceAccountNamespaces = ctx.StringSlice("trusted-service-account-namespaces")
 	log.Info("Setting up controllers", "config", c)
 	ctrl.SetLogger(log)
 
@@ -90,6 +124,9 @@ func (c *operatorCommand) execute(ctx *cli.Context) error {
 
 		mgr, err := ctrl.NewManager(c.kubeconfig, ctrl.Options{
 			SyncPeriod: &c.SyncInterval,
+			// Only cache the objects of the instances instead of all of them in the cluster.
+			NewCache:              standalone.NewCacheFunc(),
+			ClientDisableCacheFor: standalone.UncachedObjects(),
 			// controller-runtime uses both ConfigMaps and Leases for leader election by default.
 			// Leases expire after 15 seconds, with a 10-second renewal deadline.
 			// We've observed leader loss due to renewal deadlines being exceeded when under high load - i.e.
@@ -70,6 +70,9 @@ provider_helm_version ?= $(shell go mod edit -json | jq -r '.Require[] | select(
 k8up_version ?= $(shell go mod edit -json | jq -r '.Require[] | select(.Path == "github.com/k8up-io/k8up/v2") | .Version')
 provider_helm_download_root ?= https://raw.githubusercontent.com/crossplane-contrib/provider-helm/$(provider_helm_version)/package/crds
 k8up_download_root ?= https://raw.githubusercontent.com/k8up-io/k8up/$(k8up_version)/config/crd/apiextensions.k8s.io/v1/base/
+# CloudNativePG isn't a Go dependency, its Cluster resource is handled as unstructured object
+cnpg_version ?= v1.16.0
+cnpg_download_root ?= https://raw.githubusercontent.com/cloudnative-pg/cloudnative-pg/$(cnpg_version)/config/crd/bases
 
 .envtest_crd_dir:
 	@mkdir -p $(envtest_crd_dir)
@@ -84,7 +87,10 @@ $(envtest_crd_dir)/helm.crossplane.io_providerconfigs.yaml: $(.envtest_crd_dir)
 $(envtest_crd_dir)/k8up.io_schedules.yaml: $(.envtest_crd_dir)
 	curl -sSL -o $@ $(k8up_download_root)/k8up.io_schedules.yaml
 
-.envtest_crds: .envtest_crd_dir $(envtest_crd_dir)/helm.crossplane.io_releases.yaml $(envtest_crd_dir)/helm.crossplane.io_providerconfigs.yaml  $(envtest_crd_dir)/k8up.io_schedules.yaml
+$(envtest_crd_dir)/postgresql.cnpg.io_clusters.yaml: $(.envtest_crd_dir)
+	curl -sSL -o $@ $(cnpg_download_root)/postgresql.cnpg.io_clusters.yaml
+
+.envtest_crds: .envtest_crd_dir $(envtest_crd_dir)/helm.crossplane.io_releases.yaml $(envtest_crd_dir)/helm.crossplane.io_providerconfigs.yaml  $(envtest_crd_dir)/k8up.io_schedules.yaml $(envtest_crd_dir)/postgresql.cnpg.io_clusters.yaml
 
 ####
 #### S3 Bucket